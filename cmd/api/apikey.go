@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/db"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+const apiKeyUsage = `usage: api apikey <command> [-tenant SLUG] [flags]
+
+commands:
+  issue   -name NAME -scopes availability:read,orders:write [-branches 1,2] [-quota N] [-expires RFC3339]
+  list    [-all]
+  rotate  -id ID [-grace 30m]
+  revoke  -id ID
+  usage   -id ID [-days 30]
+`
+
+// cliActor is recorded in the audit log for changes made from the command line.
+var cliActor = model.Actor{Type: model.ActorSystem, ID: "cli"}
+
+// runAPIKey manages API keys directly against the database, without a running
+// server. It returns the process exit code.
+func runAPIKey(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, apiKeyUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		id         = fs.Int64("id", 0, "key id")
+		name       = fs.String("name", "", "key name, e.g. the partner")
+		scopes     = fs.String("scopes", "", "comma-separated scopes")
+		branches   = fs.String("branches", "", "comma-separated branch ids (default: every branch)")
+		quota      = fs.Int("quota", 0, "daily request quota (default: unlimited)")
+		expires    = fs.String("expires", "", "expiry as RFC3339 (default: never)")
+		all        = fs.Bool("all", false, "include revoked and expired keys")
+		grace      = fs.Duration("grace", 0, "how long the old key keeps working after rotation")
+		days       = fs.Int("days", 30, "days of usage to show")
+		tenantSlug = fs.String("tenant", "default", "slug of the tenant owning the keys")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	database, err := db.Open()
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	defer func() { _ = database.Close() }()
+
+	repo := repository.NewAPIKeyRepository(database)
+	ctx := context.Background()
+
+	t, err := repository.NewTenantRepository(database).BySlug(ctx, *tenantSlug)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: tenant %q: %v\n", *tenantSlug, err)
+		return 1
+	}
+	ctx = tenant.WithTenant(ctx, t)
+
+	var out any
+	switch args[0] {
+	case "issue":
+		var n repository.NewAPIKey
+		if n, err = parseNewAPIKey(*name, *scopes, *branches, *quota, *expires); err == nil {
+			var key model.APIKey
+			var secret string
+			key, secret, err = repo.Issue(ctx, cliActor, n)
+			out = map[string]any{"api_key": key, "key": secret}
+		}
+	case "list":
+		out, err = repo.List(ctx, *all)
+	case "rotate":
+		if err = requireID(*id); err == nil {
+			var key model.APIKey
+			var secret string
+			key, secret, err = repo.Rotate(ctx, cliActor, *id, *grace)
+			out = map[string]any{"api_key": key, "key": secret}
+		}
+	case "revoke":
+		if err = requireID(*id); err == nil {
+			out, err = repo.Revoke(ctx, cliActor, *id)
+		}
+	case "usage":
+		if err = requireID(*id); err == nil {
+			out, err = repo.Usage(ctx, *id, *days)
+		}
+	default:
+		fmt.Fprint(stderr, apiKeyUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(out)
+	return 0
+}
+
+func requireID(id int64) error {
+	if id <= 0 {
+		return errors.New("-id is required")
+	}
+	return nil
+}
+
+func parseNewAPIKey(name, scopes, branches string, quota int, expires string) (repository.NewAPIKey, error) {
+	n := repository.NewAPIKey{Name: strings.TrimSpace(name)}
+	if n.Name == "" {
+		return n, errors.New("-name is required")
+	}
+
+	for _, s := range strings.Split(scopes, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !authz.ValidScope(s) {
+			return n, fmt.Errorf("unknown scope %q", s)
+		}
+		n.Scopes = append(n.Scopes, s)
+	}
+	if len(n.Scopes) == 0 {
+		return n, errors.New("-scopes is required")
+	}
+
+	for _, s := range strings.Split(branches, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id <= 0 {
+			return n, fmt.Errorf("invalid branch id %q", s)
+		}
+		n.BranchIDs = append(n.BranchIDs, id)
+	}
+
+	if quota < 0 {
+		return n, errors.New("-quota must be positive")
+	}
+	if quota > 0 {
+		n.DailyQuota = &quota
+	}
+
+	if expires != "" {
+		t, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			return n, fmt.Errorf("-expires: %w", err)
+		}
+		n.ExpiresAt = &t
+	}
+	return n, nil
+}
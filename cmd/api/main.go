@@ -3,12 +3,25 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	_ "time/tzdata" // branch time zones must resolve even on images without zoneinfo
 
+	"github.com/idlistic/go-backend-api-sample/internal/config"
 	"github.com/idlistic/go-backend-api-sample/internal/router"
 )
 
 func main() {
-	r, cleanup, err := router.New()
+	// `go run ./cmd/api apikey ...` manages partner keys without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKey(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r, cleanup, err := router.New(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
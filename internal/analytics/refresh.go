@@ -0,0 +1,43 @@
+// Package analytics keeps the reporting views of 016_create_analytics.sql
+// up to date.
+package analytics
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Refresher rebuilds the reporting views; ran is false when another replica
+// was already doing it.
+type Refresher interface {
+	Refresh(ctx context.Context) (ran bool, err error)
+}
+
+// RunRefresh refreshes the views once at start and then every interval,
+// until ctx is cancelled. interval <= 0 disables refreshing, e.g. when the
+// views are refreshed by an external scheduler.
+func RunRefresh(ctx context.Context, r Refresher, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		start := time.Now()
+		ran, err := r.Refresh(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("analytics refresh: %v", err)
+		} else if ran {
+			log.Printf("analytics refresh: done in %s", time.Since(start).Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package apikey adapts stored partner API keys to auth principals.
+package apikey
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+// Authenticator implements auth.KeyAuthenticator on top of the key repository.
+type Authenticator struct {
+	repo *repository.APIKeyRepository
+}
+
+func NewAuthenticator(repo *repository.APIKeyRepository) *Authenticator {
+	return &Authenticator{repo: repo}
+}
+
+func (a *Authenticator) AuthenticateKey(ctx context.Context, key string) (auth.Principal, error) {
+	k, err := a.repo.Authenticate(ctx, key, time.Now())
+	switch {
+	case errors.Is(err, repository.ErrAPIKeyInvalid):
+		return auth.Principal{}, auth.ErrInvalidAPIKey
+	case errors.Is(err, repository.ErrAPIKeyQuotaExceeded):
+		return auth.Principal{}, auth.ErrQuotaExceeded
+	case err != nil:
+		return auth.Principal{}, err
+	}
+
+	// keys carry no roles: they act as a customer limited to their scopes,
+	// owning the orders they create through their subject
+	return auth.Principal{
+		Subject:   k.Subject,
+		Name:      k.Name,
+		APIKeyID:  k.ID,
+		TenantID:  k.TenantID,
+		Scopes:    k.Scopes,
+		BranchIDs: k.BranchIDs,
+	}, nil
+}
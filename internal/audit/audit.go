@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/requestid"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+// Entity types.
+const (
+	EntityBranch   = "branch"
+	EntityTimeslot = "timeslot"
+	EntityOrder    = "order"
+	EntityAPIKey   = "api_key"
+	EntityWebhook  = "webhook"
+	EntityResource = "resource"
+	EntityService  = "service"
+)
+
+// Entry is one change to record. Before is nil for creations, After for deletions.
+type Entry struct {
+	Actor      model.Actor
+	Action     string // <entity>.<verb>, e.g. "timeslot.update"
+	EntityType string
+	EntityID   string
+	Before     any
+	After      any
+}
+
+// Change is the before/after value of one top-level field.
+type Change struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// Record writes e inside tx, so the trail commits or rolls back with the
+// change. The entry belongs to the tenant in ctx, if any.
+func Record(ctx context.Context, tx *sql.Tx, e Entry) error {
+	before, err := marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(e.After)
+	if err != nil {
+		return err
+	}
+	diff, err := json.Marshal(Diff(before, after))
+	if err != nil {
+		return err
+	}
+
+	const q = `
+INSERT INTO audit_log (actor_type, actor_id, action, entity_type, entity_id, before, after, diff, request_id, tenant_id)
+VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6::jsonb, $7::jsonb, $8::jsonb, NULLIF($9, ''), NULLIF($10, 0));
+`
+	var tenantID int64
+	if t, ok := tenant.FromContext(ctx); ok {
+		tenantID = t.ID
+	}
+	_, err = tx.ExecContext(ctx, q,
+		string(e.Actor.Type), e.Actor.ID, e.Action, e.EntityType, e.EntityID,
+		nullJSON(before), nullJSON(after), string(diff), requestid.FromContext(ctx), tenantID,
+	)
+	return err
+}
+
+// Diff compares two JSON objects field by field (top level only). A missing
+// side is treated as an empty object, so creations list every field.
+func Diff(before, after []byte) map[string]Change {
+	var b, a map[string]json.RawMessage
+	_ = json.Unmarshal(before, &b)
+	_ = json.Unmarshal(after, &a)
+
+	keys := make([]string, 0, len(a)+len(b))
+	seen := make(map[string]bool, len(a)+len(b))
+	for k := range b {
+		keys, seen[k] = append(keys, k), true
+	}
+	for k := range a {
+		if !seen[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]Change)
+	for _, k := range keys {
+		from, to := b[k], a[k]
+		if bytes.Equal(compact(from), compact(to)) {
+			continue
+		}
+		out[k] = Change{From: orNull(from), To: orNull(to)}
+	}
+	return out
+}
+
+func marshal(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func nullJSON(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return string(b)
+}
+
+func compact(raw json.RawMessage) []byte {
+	if raw == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+func orNull(raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return json.RawMessage("null")
+	}
+	return raw
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string // "" for a missing side
+		want          string
+	}{
+		{"creation lists every field", "", `{"id":1,"name":"Main"}`, `{"id":{"from":null,"to":1},"name":{"from":null,"to":"Main"}}`},
+		{"deletion lists every field", `{"id":1,"name":"Main"}`, "", `{"id":{"from":1,"to":null},"name":{"from":"Main","to":null}}`},
+		{"only changed fields", `{"id":1,"name":"Main","capacity":2}`, `{"id":1,"name":"Main","capacity":3}`, `{"capacity":{"from":2,"to":3}}`},
+		{"added and removed fields", `{"id":1,"old":true}`, `{"id":1,"new":"x"}`, `{"new":{"from":null,"to":"x"},"old":{"from":true,"to":null}}`},
+		{"formatting is not a change", `{"hours": [ {"day": 1} ]}`, `{"hours":[{"day":1}]}`, `{}`},
+		{"nested values compare whole", `{"policy":{"max":1,"min":0}}`, `{"policy":{"max":2,"min":0}}`, `{"policy":{"from":{"max":1,"min":0},"to":{"max":2,"min":0}}}`},
+		{"nothing on either side", "", "", `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after []byte
+			if tt.before != "" {
+				before = []byte(tt.before)
+			}
+			if tt.after != "" {
+				after = []byte(tt.after)
+			}
+			got, err := json.Marshal(Diff(before, after))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Diff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
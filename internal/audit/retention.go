@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Purger deletes audit entries older than a cutoff.
+type Purger interface {
+	Purge(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// RunRetention purges entries older than keep, once at start and then every
+// interval, until ctx is cancelled. keep <= 0 disables retention (keep forever).
+func RunRetention(ctx context.Context, p Purger, keep, interval time.Duration) {
+	if keep <= 0 {
+		return
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		n, err := p.Purge(ctx, time.Now().Add(-keep))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("audit retention: %v", err)
+		} else if n > 0 {
+			log.Printf("audit retention: purged %d entries", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// APIKeyHeader carries partner API keys.
+const APIKeyHeader = "X-API-Key"
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	ErrQuotaExceeded = errors.New("api key daily quota exceeded")
+)
+
+// KeyAuthenticator resolves an API key to its principal. It returns
+// ErrInvalidAPIKey for unknown, revoked or expired keys and ErrQuotaExceeded
+// once the key's daily quota is used up.
+type KeyAuthenticator interface {
+	AuthenticateKey(ctx context.Context, key string) (Principal, error)
+}
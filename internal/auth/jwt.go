@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Verifier validates compact JWS tokens signed with HS256 or RS256.
+// Only algorithms with a configured key are accepted; "none" never is.
+type Verifier struct {
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey // by kid; "" = key without kid
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// VerifierConfig configures NewVerifier. At least one of HMACSecret or RSAKeys is required.
+type VerifierConfig struct {
+	HMACSecret []byte
+	RSAKeys    map[string]*rsa.PublicKey
+	Issuer     string // if set, "iss" must match
+	Audience   string // if set, "aud" must contain it
+	Leeway     time.Duration
+}
+
+func NewVerifier(cfg VerifierConfig) (*Verifier, error) {
+	if len(cfg.HMACSecret) == 0 && len(cfg.RSAKeys) == 0 {
+		return nil, errors.New("auth: no verification keys configured")
+	}
+	if len(cfg.HMACSecret) > 0 && len(cfg.HMACSecret) < 32 {
+		return nil, errors.New("auth: HS256 secret must be at least 32 bytes")
+	}
+	return &Verifier{
+		hmacSecret: cfg.HMACSecret,
+		rsaKeys:    cfg.RSAKeys,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		leeway:     cfg.Leeway,
+		now:        time.Now,
+	}, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+type claims struct {
+	Subject   string          `json:"sub"`
+	Name      string          `json:"name"`
+	Roles     []string        `json:"roles"`
+	Tenant    string          `json:"tenant"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"` // string or array
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+}
+
+// Verify checks signature and registered claims and returns the principal.
+func (v *Verifier) Verify(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrInvalidToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch h.Alg {
+	case "HS256":
+		if len(v.hmacSecret) == 0 {
+			return Principal{}, ErrInvalidToken
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return Principal{}, ErrInvalidToken
+		}
+	case "RS256":
+		key := v.rsaKey(h.Kid)
+		if key == nil {
+			return Principal{}, ErrInvalidToken
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return Principal{}, ErrInvalidToken
+		}
+	default:
+		return Principal{}, ErrInvalidToken
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if err := v.validate(c); err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{Subject: c.Subject, Name: c.Name, Roles: c.Roles, Tenant: c.Tenant}, nil
+}
+
+func (v *Verifier) rsaKey(kid string) *rsa.PublicKey {
+	if k, ok := v.rsaKeys[kid]; ok {
+		return k
+	}
+	// a token without kid is fine when exactly one key is configured
+	if kid == "" && len(v.rsaKeys) == 1 {
+		for _, k := range v.rsaKeys {
+			return k
+		}
+	}
+	return nil
+}
+
+func (v *Verifier) validate(c claims) error {
+	now := v.now()
+
+	if c.Subject == "" {
+		return ErrInvalidToken
+	}
+	if c.ExpiresAt == nil {
+		return ErrInvalidToken // tokens must expire
+	}
+	if now.After(time.Unix(*c.ExpiresAt, 0).Add(v.leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*c.NotBefore, 0)) {
+		return ErrInvalidToken
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return ErrInvalidToken
+	}
+	if v.audience != "" && !audienceContains(c.Audience, v.audience) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func audienceContains(raw json.RawMessage, want string) bool {
+	var one string
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return one == want
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		for _, a := range many {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("decode segment: %w", err)
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func segment(v any) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signHS256 builds a token signed with key under alg HS256.
+func signHS256(key []byte, hdr, c map[string]any) string {
+	signed := segment(hdr) + "." + segment(c)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, hdr, c map[string]any) string {
+	t.Helper()
+	signed := segment(hdr) + "." + segment(c)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS stores key's public half as a JWKS document and loads it back.
+func writeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) map[string]*rsa.PublicKey {
+	t.Helper()
+	set := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	b, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVerifier(VerifierConfig{
+		HMACSecret: []byte(testSecret),
+		RSAKeys:    writeJWKS(t, "k1", rsaKey),
+		Issuer:     "https://issuer.test",
+		Audience:   "booking-api",
+		Leeway:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testNow }
+
+	claims := func(change func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"sub":    "u1",
+			"roles":  []string{"staff:1"},
+			"tenant": "acme",
+			"iss":    "https://issuer.test",
+			"aud":    []string{"other", "booking-api"},
+			"exp":    testNow.Add(time.Hour).Unix(),
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	hs := map[string]any{"alg": "HS256", "typ": "JWT"}
+	rs := map[string]any{"alg": "RS256", "kid": "k1", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"HS256", signHS256([]byte(testSecret), hs, claims(nil)), nil},
+		{"RS256", signRS256(t, rsaKey, rs, claims(nil)), nil},
+		{"audience as string", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["aud"] = "booking-api" })), nil},
+		{"within leeway", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["exp"] = testNow.Add(-10 * time.Second).Unix() })), nil},
+
+		{"HS256 wrong secret", signHS256([]byte("another secret of at least 32 bytes"), hs, claims(nil)), ErrInvalidToken},
+		{"RS256 wrong key", signRS256(t, otherKey, rs, claims(nil)), ErrInvalidToken},
+		{"alg confusion: HS256 with RSA public key", signHS256(pubDER, map[string]any{"alg": "HS256", "kid": "k1"}, claims(nil)), ErrInvalidToken},
+		{"alg none", segment(map[string]any{"alg": "none"}) + "." + segment(claims(nil)) + ".", ErrInvalidToken},
+		{"alg none with signature", signHS256([]byte(testSecret), map[string]any{"alg": "none"}, claims(nil)), ErrInvalidToken},
+		{"unknown kid", signRS256(t, rsaKey, map[string]any{"alg": "RS256", "kid": "k2"}, claims(nil)), ErrInvalidToken},
+		{"expired", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["exp"] = testNow.Add(-time.Minute).Unix() })), ErrTokenExpired},
+		{"no exp", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { delete(c, "exp") })), ErrInvalidToken},
+		{"not yet valid", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["nbf"] = testNow.Add(time.Minute).Unix() })), ErrInvalidToken},
+		{"wrong issuer", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["iss"] = "https://evil.test" })), ErrInvalidToken},
+		{"wrong audience", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { c["aud"] = "other" })), ErrInvalidToken},
+		{"no subject", signHS256([]byte(testSecret), hs, claims(func(c map[string]any) { delete(c, "sub") })), ErrInvalidToken},
+		{"malformed", "not.a.token", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify: got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != "u1" || p.Tenant != "acme" || len(p.Roles) != 1) {
+				t.Errorf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgWithoutKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RS256 only: an HS256 token is refused even when "signed" with the
+	// public key, the classic algorithm confusion
+	v, err := NewVerifier(VerifierConfig{RSAKeys: writeJWKS(t, "", rsaKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testNow }
+
+	c := map[string]any{"sub": "u1", "exp": testNow.Add(time.Hour).Unix()}
+	if _, err := v.Verify(signHS256(pubDER, map[string]any{"alg": "HS256"}, c)); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("HS256 without secret: got %v, want ErrInvalidToken", err)
+	}
+	// a single key also verifies tokens without kid
+	if _, err := v.Verify(signRS256(t, rsaKey, map[string]any{"alg": "RS256"}, c)); err != nil {
+		t.Errorf("RS256 without kid: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+var (
+	problemUnauthenticated = problem.New(http.StatusUnauthorized, problem.CodeUnauthenticated, "authentication required")
+	problemInvalidToken    = problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "invalid bearer token")
+	problemTokenExpired    = problem.New(http.StatusUnauthorized, problem.CodeTokenExpired, "bearer token expired")
+	problemInvalidAPIKey   = problem.New(http.StatusUnauthorized, problem.CodeInvalidAPIKey, "invalid api key")
+	problemQuotaExceeded   = problem.New(http.StatusTooManyRequests, problem.CodeAPIKeyQuotaExceeded, "api key daily quota exceeded")
+)
+
+// Middleware authenticates "Authorization: Bearer <jwt>" or an X-API-Key
+// header (WebSocket handshakes may carry the JWT as a subprotocol, see
+// WebSocketBearerPrefix) and stores the principal in the request context. Requests without
+// credentials pass through anonymously (see Require); bad credentials are
+// rejected with 401. A nil verifier rejects every token, so a server without
+// keys fails closed; keys may be nil to disable API keys.
+func Middleware(v *Verifier, keys KeyAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if key := r.Header.Get(APIKeyHeader); key != "" {
+				serveWithAPIKey(w, r, next, keys, key)
+				return
+			}
+
+			authz := r.Header.Get("Authorization")
+			if authz == "" {
+				if token, ok := websocketBearer(r); ok {
+					authz = "Bearer " + token
+				}
+			}
+			if authz == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			scheme, token, ok := strings.Cut(authz, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || v == nil {
+				unauthorized(w, r, problemInvalidToken, `Bearer error="invalid_token"`)
+				return
+			}
+
+			p, err := v.Verify(strings.TrimSpace(token))
+			if err != nil {
+				if errors.Is(err, ErrTokenExpired) {
+					unauthorized(w, r, problemTokenExpired, `Bearer error="invalid_token", error_description="expired"`)
+					return
+				}
+				unauthorized(w, r, problemInvalidToken, `Bearer error="invalid_token"`)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// Require rejects anonymous requests with 401, except for the listed methods
+// (e.g. GET on a public listing).
+func Require(next http.Handler, publicMethods ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range publicMethods {
+			if r.Method == m {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if _, ok := FromContext(r.Context()); !ok {
+			unauthorized(w, r, problemUnauthenticated, "Bearer")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveWithAPIKey authenticates key and calls next, or writes 401 / 429.
+func serveWithAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, keys KeyAuthenticator, key string) {
+	if keys == nil || r.Header.Get("Authorization") != "" {
+		// one credential per request, so a key can never widen a token or vice versa
+		unauthorized(w, r, problemInvalidAPIKey, "ApiKey")
+		return
+	}
+
+	p, err := keys.AuthenticateKey(r.Context(), key)
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		// quotas reset at midnight UTC
+		now := time.Now().UTC()
+		reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+		problem.Write(w, r, problemQuotaExceeded)
+		return
+	case errors.Is(err, ErrInvalidAPIKey):
+		unauthorized(w, r, problemInvalidAPIKey, "ApiKey")
+		return
+	case err != nil:
+		problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error"))
+		return
+	}
+
+	next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, p *problem.Problem, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	problem.Write(w, r, p)
+}
+
+// WebSocketBearerPrefix marks a Sec-WebSocket-Protocol entry carrying a JWT,
+// e.g. "bearer.eyJhbGciOi...". Browsers cannot set Authorization on WebSocket
+// handshakes; servers must never select this entry as the protocol.
+const WebSocketBearerPrefix = "bearer."
+
+// HasCredentials reports whether r carries an API key, an Authorization
+// header or a WebSocket bearer token, i.e. anything Middleware would check.
+func HasCredentials(r *http.Request) bool {
+	if r.Header.Get(APIKeyHeader) != "" || r.Header.Get("Authorization") != "" {
+		return true
+	}
+	_, ok := websocketBearer(r)
+	return ok
+}
+
+// websocketBearer returns the token of a WebSocket handshake, if any.
+func websocketBearer(r *http.Request) (string, bool) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return "", false
+	}
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, proto := range strings.Split(v, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(proto), WebSocketBearerPrefix); ok && token != "" {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
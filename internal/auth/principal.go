@@ -0,0 +1,46 @@
+package auth
+
+import "context"
+
+// Principal is the authenticated caller: a user with a JWT, or a partner
+// integration with an API key.
+type Principal struct {
+	Subject string   `json:"sub"`
+	Name    string   `json:"name,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	Tenant  string   `json:"tenant,omitempty"` // tenant slug a JWT is restricted to
+
+	// Set for API keys only; keys are limited to their tenant, scopes and branches.
+	APIKeyID  int64    `json:"-"`
+	TenantID  int64    `json:"-"`
+	Scopes    []string `json:"-"`
+	BranchIDs []int64  `json:"-"` // empty = every branch
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key.
+func (p Principal) IsAPIKey() bool {
+	return p.APIKeyID != 0
+}
+
+// HasRole reports whether the principal carries role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type ctxKey struct{}
+
+// WithPrincipal stores p in ctx.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal, if the request was authenticated.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,89 @@
+// Package availability pushes timeslot seat changes to connected clients.
+// Repositories announce changes with Postgres NOTIFY inside their
+// transactions, so every API replica hears about every commit, and only
+// about committed ones.
+package availability
+
+import "sync"
+
+// Channel is the Postgres notification channel.
+const Channel = "timeslot_changes"
+
+// Change says that timeslots or their orders of a branch on a branch-local
+// date changed; subscribers re-read them.
+type Change struct {
+	BranchID int64  `json:"branch_id"`
+	Date     string `json:"date"` // YYYY-MM-DD
+}
+
+// Hub fans changes out to the subscribers of a branch and date.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[Change]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[Change]map[*Subscription]struct{})}
+}
+
+// Subscription signals on C whenever its branch and date may have changed.
+// Signals coalesce: a slow reader sees one signal for several changes.
+type Subscription struct {
+	C <-chan struct{}
+
+	c   chan struct{}
+	key Change
+	hub *Hub
+}
+
+func (h *Hub) Subscribe(key Change) *Subscription {
+	c := make(chan struct{}, 1)
+	s := &Subscription{C: c, c: c, key: key, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[key] == nil {
+		h.subs[key] = make(map[*Subscription]struct{})
+	}
+	h.subs[key][s] = struct{}{}
+	return s
+}
+
+// Close unsubscribes s.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[s.key], s)
+	if len(h.subs[s.key]) == 0 {
+		delete(h.subs, s.key)
+	}
+}
+
+func (s *Subscription) signal() {
+	select {
+	case s.c <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// Publish signals the subscribers of c.
+func (h *Hub) Publish(c Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[c] {
+		s.signal()
+	}
+}
+
+// PublishAll signals every subscriber, e.g. after notifications may have
+// been missed.
+func (h *Hub) PublishAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for s := range subs {
+			s.signal()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package availability
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Listen feeds hub from Postgres notifications until ctx is cancelled,
+// reconnecting with backoff. Notifications sent while disconnected are lost,
+// so every subscriber is signalled once listening resumes.
+func Listen(ctx context.Context, db *sql.DB, hub *Hub) {
+	wait := time.Second
+	for {
+		err := listen(ctx, db, hub)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("availability listener: %v (retrying in %v)", err, wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, time.Minute)
+	}
+}
+
+// listen holds one pooled connection for LISTEN until it fails. The
+// connection is discarded afterwards rather than returned to the pool still
+// listening.
+func listen(ctx context.Context, db *sql.DB, hub *Hub) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	var listenErr error
+	_ = conn.Raw(func(dc any) error {
+		pc := dc.(*stdlib.Conn).Conn()
+		if _, listenErr = pc.Exec(ctx, "LISTEN "+Channel); listenErr != nil {
+			return driver.ErrBadConn
+		}
+		hub.PublishAll()
+
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				listenErr = err
+				return driver.ErrBadConn
+			}
+			var c Change
+			if err := json.Unmarshal([]byte(n.Payload), &c); err != nil {
+				log.Printf("availability listener: bad payload %q", n.Payload)
+				continue
+			}
+			hub.Publish(c)
+		}
+	})
+	return listenErr
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds application settings read from the environment.
+// Database settings are still read by package db.
+type Config struct {
+	// Development (APP_ENV=development) relaxes checks that only make sense in
+	// production: webhooks may then use http and local addresses.
+	Development bool
+
+	// AuditRetention is how long audit_log rows are kept; 0 keeps them forever.
+	AuditRetention time.Duration
+
+	// AnalyticsRefresh is how often the reporting views are rebuilt; 0 leaves
+	// it to an external scheduler.
+	AnalyticsRefresh time.Duration
+
+	// JWT verification. Without a secret or JWKS file every bearer token is
+	// rejected and only public endpoints work.
+	JWTSecret   string // HS256 shared secret
+	JWKSFile    string // local JWKS document with RS256 public keys
+	JWTIssuer   string
+	JWTAudience string
+
+	// Rate limiting per client, in requests per minute with a burst allowance.
+	// A per-minute value of 0 disables that budget.
+	RateLimitStore       string // "memory" (per replica) or "postgres" (shared)
+	RateLimitReadPerMin  int
+	RateLimitReadBurst   int
+	RateLimitWritePerMin int
+	RateLimitWriteBurst  int
+	RateLimitAuthPerMin  int // requests with credentials per IP, before they are checked
+	RateLimitAuthBurst   int
+	RateLimitTrustProxy  bool
+
+	CORS CORS
+
+	// TenantFallback is the tenant slug serving requests whose host matches no
+	// tenant; "" rejects them. TenantRLS runs queries so that Postgres
+	// row-level security (migrations/rls) can check the tenant too.
+	TenantFallback string
+	TenantRLS      bool
+
+	// Webhook delivery. WebhookDispatch=false leaves events queued, e.g. on
+	// replicas that should only serve requests.
+	WebhookDispatch    bool
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+}
+
+// CORS is the cross-origin policy for browser clients.
+type CORS struct {
+	// Exact origins ("https://app.example.com"), subdomain patterns
+	// ("https://*.example.com") or "*" for any origin.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration // how long browsers may cache a preflight; 0 = not sent
+}
+
+func Load() (Config, error) {
+	var c Config
+
+	days, err := getInt("AUDIT_RETENTION_DAYS", 365)
+	if err != nil {
+		return Config{}, err
+	}
+	c.AuditRetention = time.Duration(days) * 24 * time.Hour
+
+	refresh, err := getInt("ANALYTICS_REFRESH_MINUTES", 15)
+	if err != nil {
+		return Config{}, err
+	}
+	c.AnalyticsRefresh = time.Duration(refresh) * time.Minute
+
+	c.Development = getEnv("APP_ENV", "production") == "development"
+
+	c.JWTSecret = getEnv("JWT_HS256_SECRET", "")
+	c.JWKSFile = getEnv("JWT_JWKS_FILE", "")
+	c.JWTIssuer = getEnv("JWT_ISSUER", "")
+	c.JWTAudience = getEnv("JWT_AUDIENCE", "")
+
+	c.RateLimitStore = getEnv("RATE_LIMIT_STORE", "memory")
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "postgres" {
+		return Config{}, fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres, got %q", c.RateLimitStore)
+	}
+	for _, v := range []struct {
+		key string
+		def int
+		dst *int
+	}{
+		{"RATE_LIMIT_READ_PER_MINUTE", 300, &c.RateLimitReadPerMin},
+		{"RATE_LIMIT_READ_BURST", 60, &c.RateLimitReadBurst},
+		{"RATE_LIMIT_WRITE_PER_MINUTE", 30, &c.RateLimitWritePerMin},
+		{"RATE_LIMIT_WRITE_BURST", 10, &c.RateLimitWriteBurst},
+		{"RATE_LIMIT_AUTH_PER_MINUTE", 600, &c.RateLimitAuthPerMin},
+		{"RATE_LIMIT_AUTH_BURST", 120, &c.RateLimitAuthBurst},
+	} {
+		if *v.dst, err = getInt(v.key, v.def); err != nil {
+			return Config{}, err
+		}
+	}
+	c.RateLimitTrustProxy = getEnv("RATE_LIMIT_TRUST_PROXY", "false") == "true"
+
+	c.CORS = CORS{
+		AllowedOrigins: getList("CORS_ALLOWED_ORIGINS", "http://localhost:5173,http://127.0.0.1:5173"),
+		AllowedMethods: getList("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE"),
+		AllowedHeaders: getList("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-API-Key,X-Request-ID,Accept-Language"),
+		ExposedHeaders: getList("CORS_EXPOSED_HEADERS",
+			"X-Request-ID,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy,Retry-After"),
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "true") == "true",
+	}
+	maxAge, err := getInt("CORS_MAX_AGE_SECONDS", 86400)
+	if err != nil {
+		return Config{}, err
+	}
+	c.CORS.MaxAge = time.Duration(maxAge) * time.Second
+	for _, o := range c.CORS.AllowedOrigins {
+		if o == "*" && c.CORS.AllowCredentials {
+			return Config{}, fmt.Errorf("CORS_ALLOWED_ORIGINS=* cannot be combined with CORS_ALLOW_CREDENTIALS=true")
+		}
+	}
+
+	// unlike other settings, an explicitly empty TENANT_DEFAULT is meaningful
+	c.TenantFallback = "default"
+	if v, ok := os.LookupEnv("TENANT_DEFAULT"); ok {
+		c.TenantFallback = strings.TrimSpace(v)
+	}
+	c.TenantRLS = getEnv("TENANT_RLS", "false") == "true"
+
+	c.WebhookDispatch = getEnv("WEBHOOK_DISPATCH", "true") == "true"
+	if c.WebhookMaxAttempts, err = getInt("WEBHOOK_MAX_ATTEMPTS", 10); err != nil {
+		return Config{}, err
+	}
+	timeout, err := getInt("WEBHOOK_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return Config{}, err
+	}
+	c.WebhookTimeout = time.Duration(timeout) * time.Second
+
+	return c, nil
+}
+
+func getEnv(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// getList splits a comma-separated variable, dropping blanks.
+func getList(key, def string) []string {
+	var out []string
+	for _, v := range strings.Split(getEnv(key, def), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func getInt(key string, def int) (int, error) {
+	v := getEnv(key, "")
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", key, v)
+	}
+	return n, nil
+}
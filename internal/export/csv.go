@@ -0,0 +1,67 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+type csvWriter struct {
+	w   *csv.Writer
+	buf []string
+}
+
+func newCSV(w io.Writer, header []string) (*csvWriter, error) {
+	// a BOM makes Excel read the file as UTF-8 (Thai customer names)
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return nil, err
+	}
+	c := &csvWriter{w: csv.NewWriter(w)}
+	if err := c.w.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *csvWriter) WriteRow(values []any) error {
+	c.buf = c.buf[:0]
+	for _, v := range values {
+		c.buf = append(c.buf, csvValue(v))
+	}
+	// csv.Writer buffers; rows reach the client every few KB
+	return c.w.Write(c.buf)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return neutralizeFormula(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// neutralizeFormula keeps spreadsheets from evaluating user-supplied text
+// (e.g. a customer named "=HYPERLINK(...)") by prefixing a quote.
+func neutralizeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+// Package export streams tabular data as CSV or XLSX, one row at a time,
+// so exports never hold the whole result in memory.
+package export
+
+import (
+	"fmt"
+	"io"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// ParseFormat accepts "csv" (also the default for "") and "xlsx".
+func ParseFormat(s string) (Format, bool) {
+	switch Format(s) {
+	case "", FormatCSV:
+		return FormatCSV, true
+	case FormatXLSX:
+		return FormatXLSX, true
+	}
+	return "", false
+}
+
+// ContentType returns the media type of f.
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer writes rows after a header. Values are strings, integers, bools or
+// nil (an empty cell). Close must be called to finish the file.
+type Writer interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+// New starts a file of format f with the header row; sheet names the XLSX
+// worksheet.
+func New(f Format, w io.Writer, sheet string, header []string) (Writer, error) {
+	switch f {
+	case FormatCSV:
+		return newCSV(w, header)
+	case FormatXLSX:
+		return newXLSX(w, sheet, header)
+	}
+	return nil, fmt.Errorf("export: unknown format %q", f)
+}
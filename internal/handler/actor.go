@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+// actorFrom derives the acting party at branchID from the authenticated
+// principal. Principals holding a staff-or-higher role for that branch act as
+// staff; everyone else, including anonymous callers, is a customer — the most
+// restricted type. branchID 0 only matches global grants.
+func actorFrom(r *http.Request, branchID int64) model.Actor {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		return model.Actor{Type: model.ActorCustomer}
+	}
+	if authz.Can(p, authz.ActAsStaff, branchID) {
+		return model.Actor{Type: model.ActorStaff, ID: p.Subject}
+	}
+	return model.Actor{Type: model.ActorCustomer, ID: p.Subject}
+}
+
+// authorize writes a 403 problem and returns false unless the caller may
+// perform a at branchID.
+func authorize(w http.ResponseWriter, r *http.Request, a authz.Action, branchID int64) bool {
+	p, _ := auth.FromContext(r.Context())
+	if authz.Can(p, a, branchID) {
+		return true
+	}
+	problem.Write(w, r, problemForbidden)
+	return false
+}
+
+// requireScope writes a 403 problem and returns false when the caller is an
+// API key without scope for branchID. Users pass; their roles decide.
+func requireScope(w http.ResponseWriter, r *http.Request, scope authz.Scope, branchID int64) bool {
+	p, _ := auth.FromContext(r.Context())
+	if authz.Allows(p, scope, branchID) {
+		return true
+	}
+	problem.Write(w, r, problemInsufficientScope)
+	return false
+}
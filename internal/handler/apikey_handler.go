@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+const (
+	maxAPIKeyNameLen = 100
+	apiKeyUsageDays  = 30
+	maxRotateGrace   = 7 * 24 * 60 // minutes
+)
+
+type APIKeyHandler struct {
+	repo *repository.APIKeyRepository
+}
+
+func NewAPIKeyHandler(repo *repository.APIKeyRepository) *APIKeyHandler {
+	return &APIKeyHandler{repo: repo}
+}
+
+// IssueAPIKeyRequest is the body of POST /admin/api-keys.
+type IssueAPIKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	BranchIDs  []int64    `json:"branch_ids"`  // omitted/empty = every branch
+	DailyQuota *int       `json:"daily_quota"` // omitted = unlimited
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+// RotateAPIKeyRequest is the optional body of POST /admin/api-keys/{id}/rotate.
+type RotateAPIKeyRequest struct {
+	GraceMinutes int `json:"grace_minutes"` // how long the old key keeps working; 0 = revoke now
+}
+
+// Handle serves /admin/api-keys. Admins only.
+func (h *APIKeyHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, authz.ManageAPIKeys, 0) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Issue(w, r)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// HandleItem serves /admin/api-keys/{id}, /rotate and /revoke. Admins only.
+func (h *APIKeyHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, authz.ManageAPIKeys, 0) {
+		return
+	}
+
+	seg := pathSegments(r, "/admin/api-keys/")
+	if len(seg) == 0 || len(seg) > 2 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		h.Get(w, r, id)
+	case len(seg) == 2 && seg[1] == "rotate" && r.Method == http.MethodPost:
+		h.Rotate(w, r, id)
+	case len(seg) == 2 && seg[1] == "revoke" && r.Method == http.MethodPost:
+		h.Revoke(w, r, id)
+	case len(seg) == 2 && seg[1] != "rotate" && seg[1] != "revoke":
+		problem.Write(w, r, problemNotFound)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	includeInactive := r.URL.Query().Get("include_inactive") == "true"
+
+	items, err := h.repo.List(r.Context(), includeInactive)
+	if err != nil {
+		writeError(w, r, err, "detail.query_api_keys_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// Get returns a key with its daily usage over the last 30 days.
+func (h *APIKeyHandler) Get(w http.ResponseWriter, r *http.Request, id int64) {
+	key, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_api_keys_failed")
+		return
+	}
+
+	usage, err := h.repo.Usage(r.Context(), id, apiKeyUsageDays)
+	if err != nil {
+		writeError(w, r, err, "detail.query_api_keys_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"api_key": key,
+		"usage":   usage,
+	})
+}
+
+// Issue creates a key. The plaintext "key" is only ever returned here.
+func (h *APIKeyHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	var req IssueAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(time.Now()); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	key, secret, err := h.repo.Issue(r.Context(), actorFrom(r, 0), repository.NewAPIKey{
+		Name:       req.Name,
+		Scopes:     req.Scopes,
+		BranchIDs:  req.BranchIDs,
+		DailyQuota: req.DailyQuota,
+		ExpiresAt:  req.ExpiresAt,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.save_api_key_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"api_key": key,
+		"key":     secret,
+	})
+}
+
+// Rotate replaces a key; the new plaintext is only ever returned here.
+func (h *APIKeyHandler) Rotate(w http.ResponseWriter, r *http.Request, id int64) {
+	var req RotateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+	if req.GraceMinutes < 0 || req.GraceMinutes > maxRotateGrace {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "grace_minutes", Code: problem.FieldOutOfRange}))
+		return
+	}
+
+	key, secret, err := h.repo.Rotate(r.Context(), actorFrom(r, 0), id, time.Duration(req.GraceMinutes)*time.Minute)
+	if err != nil {
+		writeError(w, r, err, "detail.save_api_key_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"api_key": key,
+		"key":     secret,
+	})
+}
+
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request, id int64) {
+	key, err := h.repo.Revoke(r.Context(), actorFrom(r, 0), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_api_key_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"api_key": key,
+	})
+}
+
+// validate trims the name and checks the request.
+func (req *IssueAPIKeyRequest) validate(now time.Time) *problem.Problem {
+	var fe fieldErrors
+
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.Name == "":
+		fe.add("name", problem.FieldRequired)
+	case utf8.RuneCountInString(req.Name) > maxAPIKeyNameLen:
+		fe.add("name", problem.FieldTooLong)
+	}
+
+	if len(req.Scopes) == 0 {
+		fe.add("scopes", problem.FieldRequired)
+	}
+	seen := make(map[string]bool, len(req.Scopes))
+	for _, s := range req.Scopes {
+		switch {
+		case !authz.ValidScope(s):
+			fe.add("scopes", problem.FieldInvalid)
+		case seen[s]:
+			fe.add("scopes", problem.FieldDuplicate)
+		}
+		seen[s] = true
+	}
+
+	for _, id := range req.BranchIDs {
+		if id <= 0 {
+			fe.add("branch_ids", problem.FieldPositiveInt)
+			break
+		}
+	}
+	if req.DailyQuota != nil && *req.DailyQuota < 1 {
+		fe.add("daily_quota", problem.FieldPositiveInt)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		fe.add("expires_at", problem.FieldOutOfRange)
+	}
+
+	return fe.problem()
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+type AuditHandler struct {
+	repo *repository.AuditRepository
+}
+
+func NewAuditHandler(repo *repository.AuditRepository) *AuditHandler {
+	return &AuditHandler{repo: repo}
+}
+
+// List serves GET /admin/audit?entity_type=&entity_id=&actor_id=&from=&to=&before_id=&limit=
+// from/to are RFC3339 instants; pass the last id as before_id to get the next page.
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+	if !authorize(w, r, authz.ReadAudit, 0) {
+		return
+	}
+
+	q := r.URL.Query()
+	f := repository.AuditFilter{
+		EntityType: q.Get("entity_type"),
+		EntityID:   q.Get("entity_id"),
+		ActorID:    q.Get("actor_id"),
+		Limit:      defaultAuditLimit,
+	}
+
+	var fe fieldErrors
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fe.add(p.name, problem.FieldTimestampFormat)
+				continue
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("before_id"); v != "" {
+		id, ok := parseID(v)
+		if !ok {
+			fe.add("before_id", problem.FieldPositiveInt)
+		}
+		f.BeforeID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			fe.add("limit", problem.FieldOutOfRange)
+		}
+		f.Limit = n
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	items, err := h.repo.List(r.Context(), f)
+	if err != nil {
+		writeError(w, r, err, "detail.query_audit_failed")
+		return
+	}
+
+	resp := map[string]any{
+		"count": len(items),
+		"items": items,
+	}
+	if len(items) == f.Limit {
+		resp["next_before_id"] = items[len(items)-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
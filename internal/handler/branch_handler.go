@@ -1,25 +1,91 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
 	"github.com/idlistic/go-backend-api-sample/internal/repository"
 )
 
 type BranchHandler struct {
-	repo *repository.BranchRepository
+	repo   *repository.BranchRepository
+	orders *repository.OrderRepository
 }
 
-func NewBranchHandler(repo *repository.BranchRepository) *BranchHandler {
-	return &BranchHandler{repo: repo}
+func NewBranchHandler(repo *repository.BranchRepository, orders *repository.OrderRepository) *BranchHandler {
+	return &BranchHandler{repo: repo, orders: orders}
+}
+
+// BranchRequest is the body of POST /branches and PATCH /branches/{id}.
+// Omitted fields are left unchanged on PATCH.
+type BranchRequest struct {
+	Name              *string                  `json:"name"`
+	Timezone          *string                  `json:"timezone"`
+	Address           *string                  `json:"address"`
+	Phone             *string                  `json:"phone"`
+	OperatingHours    *[]model.OperatingHours  `json:"operating_hours"`
+	BookingPolicy     *model.BookingPolicy     `json:"booking_policy"`
+	CancelPolicy      *model.CancelPolicy      `json:"cancellation_policy"`
+	ReliabilityPolicy *model.ReliabilityPolicy `json:"reliability_policy"`
+	NoOverlap         *bool                    `json:"no_overlap"`
+}
+
+// Handle serves /branches.
+func (h *BranchHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// HandleItem serves /branches/{id}, /branches/{id}/archive,
+// /branches/{id}/calendar.ics and /branches/{id}/calendar-token.
+func (h *BranchHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	seg := pathSegments(r, "/branches/")
+	if len(seg) == 0 || len(seg) > 2 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		h.Get(w, r, id)
+	case len(seg) == 1 && r.Method == http.MethodPatch:
+		h.Update(w, r, id)
+	case len(seg) == 2 && seg[1] == "archive" && r.Method == http.MethodPost:
+		h.Archive(w, r, id)
+	case len(seg) == 2 && seg[1] == "calendar.ics" && r.Method == http.MethodGet:
+		h.CalendarFeed(w, r, id)
+	case len(seg) == 2 && seg[1] == "calendar-token" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		h.CalendarToken(w, r, id)
+	case len(seg) == 2 && seg[1] != "archive" && seg[1] != "calendar.ics" && seg[1] != "calendar-token":
+		problem.Write(w, r, problemNotFound)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
 }
 
 func (h *BranchHandler) List(w http.ResponseWriter, r *http.Request) {
-	items, err := h.repo.List(r.Context())
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
+
+	items, err := h.repo.List(r.Context(), includeArchived)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error": "failed to query branches",
-		})
+		writeError(w, r, err, "detail.query_branches_failed")
 		return
 	}
 
@@ -28,3 +94,208 @@ func (h *BranchHandler) List(w http.ResponseWriter, r *http.Request) {
 		"count": len(items),
 	})
 }
+
+func (h *BranchHandler) Get(w http.ResponseWriter, r *http.Request, id int64) {
+	branch, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_branches_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"branch": branch,
+	})
+}
+
+func (h *BranchHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, authz.ManageBranches, 0) {
+		return
+	}
+
+	var req BranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(true); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	b := model.Branch{
+		Name:     *req.Name,
+		Timezone: *req.Timezone,
+		// defaults match the column defaults
+		BookingPolicy:     model.BookingPolicy{MinLeadMinutes: 0, MaxAdvanceDays: 60},
+		CancelPolicy:      model.CancelPolicy{CustomerDeadlineMinutes: 120, StaffDeadlineMinutes: 0},
+		ReliabilityPolicy: model.ReliabilityPolicy{WindowDays: 90, LateCancelMinutes: 1440, ConfirmDeadlineMinutes: 120},
+	}
+	if req.Address != nil {
+		b.Address = *req.Address
+	}
+	if req.Phone != nil {
+		b.Phone = *req.Phone
+	}
+	if req.OperatingHours != nil {
+		b.OperatingHours = *req.OperatingHours
+	}
+	if req.BookingPolicy != nil {
+		b.BookingPolicy = *req.BookingPolicy
+	}
+	if req.CancelPolicy != nil {
+		b.CancelPolicy = *req.CancelPolicy
+	}
+	if req.ReliabilityPolicy != nil {
+		b.ReliabilityPolicy = *req.ReliabilityPolicy
+	}
+	if req.NoOverlap != nil {
+		b.NoOverlap = *req.NoOverlap
+	}
+
+	branch, err := h.repo.Create(r.Context(), actorFrom(r, 0), b)
+	if err != nil {
+		writeError(w, r, err, "detail.save_branch_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"branch": branch,
+	})
+}
+
+func (h *BranchHandler) Update(w http.ResponseWriter, r *http.Request, id int64) {
+	if !authorize(w, r, authz.ManageBranches, id) {
+		return
+	}
+
+	var req BranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(false); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	branch, err := h.repo.Update(r.Context(), actorFrom(r, id), id, repository.BranchUpdate{
+		Name:              req.Name,
+		Timezone:          req.Timezone,
+		Address:           req.Address,
+		Phone:             req.Phone,
+		OperatingHours:    req.OperatingHours,
+		BookingPolicy:     req.BookingPolicy,
+		CancelPolicy:      req.CancelPolicy,
+		ReliabilityPolicy: req.ReliabilityPolicy,
+		NoOverlap:         req.NoOverlap,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.save_branch_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"branch": branch,
+	})
+}
+
+func (h *BranchHandler) Archive(w http.ResponseWriter, r *http.Request, id int64) {
+	if !authorize(w, r, authz.ManageBranches, id) {
+		return
+	}
+
+	branch, err := h.repo.Archive(r.Context(), actorFrom(r, id), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_branch_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"branch": branch,
+	})
+}
+
+// validate trims string fields in place and checks them; name and timezone
+// are mandatory on create only.
+func (req *BranchRequest) validate(create bool) *problem.Problem {
+	var fe fieldErrors
+
+	for _, s := range []*string{req.Name, req.Timezone, req.Address, req.Phone} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+
+	if req.Name == nil && create || req.Name != nil && *req.Name == "" {
+		fe.add("name", problem.FieldRequired)
+	}
+
+	switch {
+	case req.Timezone == nil && create || req.Timezone != nil && *req.Timezone == "":
+		fe.add("timezone", problem.FieldRequired)
+	case req.Timezone != nil:
+		// time.LoadLocation accepts "Local"; only real IANA names are allowed here.
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "Local" {
+			fe.add("timezone", problem.FieldTimezone)
+		}
+	}
+
+	if req.OperatingHours != nil {
+		seen := make(map[time.Weekday]bool, 7)
+		for _, oh := range *req.OperatingHours {
+			switch {
+			case oh.Weekday < time.Sunday || oh.Weekday > time.Saturday:
+				fe.add("operating_hours.weekday", problem.FieldOutOfRange)
+			case seen[oh.Weekday]:
+				fe.add("operating_hours.weekday", problem.FieldDuplicate)
+			case !validClock(oh.OpenTime):
+				fe.add("operating_hours.open_time", problem.FieldTimeFormat)
+			case !validClock(oh.CloseTime):
+				fe.add("operating_hours.close_time", problem.FieldTimeFormat)
+			case oh.CloseTime <= oh.OpenTime:
+				fe.add("operating_hours.close_time", problem.FieldTimeOrder)
+			}
+			seen[oh.Weekday] = true
+		}
+	}
+
+	if bp := req.BookingPolicy; bp != nil {
+		if bp.MinLeadMinutes < 0 || bp.MinLeadMinutes > 30*24*60 {
+			fe.add("booking_policy.min_lead_minutes", problem.FieldOutOfRange)
+		}
+		if bp.MaxAdvanceDays < 1 || bp.MaxAdvanceDays > 730 {
+			fe.add("booking_policy.max_advance_days", problem.FieldOutOfRange)
+		}
+	}
+
+	if cp := req.CancelPolicy; cp != nil {
+		if cp.CustomerDeadlineMinutes < 0 || cp.CustomerDeadlineMinutes > 30*24*60 {
+			fe.add("cancellation_policy.customer_deadline_minutes", problem.FieldOutOfRange)
+		}
+		if cp.StaffDeadlineMinutes < 0 || cp.StaffDeadlineMinutes > 30*24*60 {
+			fe.add("cancellation_policy.staff_deadline_minutes", problem.FieldOutOfRange)
+		}
+	}
+
+	if rp := req.ReliabilityPolicy; rp != nil {
+		if rp.WindowDays < 1 || rp.WindowDays > 730 {
+			fe.add("reliability_policy.window_days", problem.FieldOutOfRange)
+		}
+		if rp.LateCancelMinutes < 0 || rp.LateCancelMinutes > 30*24*60 {
+			fe.add("reliability_policy.late_cancel_minutes", problem.FieldOutOfRange)
+		}
+		if rp.ConfirmDeadlineMinutes < 0 || rp.ConfirmDeadlineMinutes > 30*24*60 {
+			fe.add("reliability_policy.confirm_deadline_minutes", problem.FieldOutOfRange)
+		}
+		if t := rp.ConfirmThreshold; t != nil && (*t < 1 || *t > 1000) {
+			fe.add("reliability_policy.confirm_threshold", problem.FieldOutOfRange)
+		}
+		if t := rp.BlockThreshold; t != nil && (*t < 1 || *t > 1000) {
+			fe.add("reliability_policy.block_threshold", problem.FieldOutOfRange)
+		}
+	}
+
+	return fe.problem()
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/ical"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+// The branch feed covers bookings from calendarFeedPastDays ago to
+// calendarFeedDays ahead (branch-local dates).
+const (
+	calendarFeedPastDays = 30
+	calendarFeedDays     = 90
+)
+
+// Calendar serves GET /orders/{id}.ics, open to the order's owner and to
+// staff of its branch.
+func (h *OrderHandler) Calendar(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	e, err := h.repo.CalendarEntry(r.Context(), actorFrom(r, branchID), orderID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+
+	writeCalendar(w, fmt.Sprintf("order-%d.ics", orderID), ical.Calendar{
+		Location: loc,
+		Events:   []ical.Event{calendarEvent(r, e, "Booking at "+e.BranchName)},
+	})
+}
+
+// CalendarFeed serves GET /branches/{id}/calendar.ics?token= — the branch's
+// bookings as a subscribable calendar. Calendar apps cannot authenticate, so
+// the feed token stands in for staff credentials. Cancelled bookings stay in
+// the feed with STATUS:CANCELLED so subscribers drop them.
+func (h *BranchHandler) CalendarFeed(w http.ResponseWriter, r *http.Request, id int64) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		problem.Write(w, r, problemInvalidCalendarToken)
+		return
+	}
+	if err := h.repo.CheckCalendarToken(r.Context(), id, token); err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+
+	branch, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+	loc, err := branch.Location()
+	if err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+
+	today := time.Now().In(loc)
+	entries, err := h.orders.CalendarEntries(r.Context(), id,
+		today.AddDate(0, 0, -calendarFeedPastDays).Format("2006-01-02"),
+		today.AddDate(0, 0, calendarFeedDays).Format("2006-01-02"),
+	)
+	if err != nil {
+		writeError(w, r, err, "detail.query_calendar_failed")
+		return
+	}
+
+	c := ical.Calendar{Name: branch.Name, Location: loc, Events: make([]ical.Event, 0, len(entries))}
+	for _, e := range entries {
+		c.Events = append(c.Events, calendarEvent(r, e, e.Order.CustomerName))
+	}
+	writeCalendar(w, "calendar.ics", c)
+}
+
+// CalendarToken serves POST (issue or replace) and DELETE (revoke)
+// /branches/{id}/calendar-token.
+func (h *BranchHandler) CalendarToken(w http.ResponseWriter, r *http.Request, id int64) {
+	if !authorize(w, r, authz.ManageCalendarFeeds, id) {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := h.repo.RevokeCalendarToken(r.Context(), actorFrom(r, id), id); err != nil {
+			writeError(w, r, err, "detail.save_calendar_token_failed")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	token, err := h.repo.IssueCalendarToken(r.Context(), actorFrom(r, id), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_calendar_token_failed")
+		return
+	}
+
+	// shown once; only a hash is stored
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"branch_id": id,
+		"token":     token,
+		"feed_path": "/branches/" + strconv.FormatInt(id, 10) + "/calendar.ics?token=" + token,
+	})
+}
+
+// calendarEvent turns an order into a VEVENT. The UID is stable per order and
+// tenant, so downloads and feeds describe the same event.
+func calendarEvent(r *http.Request, e model.OrderCalendarEntry, summary string) ical.Event {
+	o := e.Order
+	t, _ := tenant.FromContext(r.Context())
+
+	location := e.BranchName
+	if e.BranchAddress != "" {
+		location += ", " + e.BranchAddress
+	}
+	status := ical.StatusConfirmed
+	switch o.Status {
+	case "cancelled":
+		status = ical.StatusCancelled
+	case "unconfirmed":
+		status = ical.StatusTentative
+	}
+
+	return ical.Event{
+		UID:          fmt.Sprintf("order-%d@%s", o.ID, t.Slug),
+		Sequence:     e.Sequence,
+		Created:      o.CreatedAt,
+		LastModified: o.UpdatedAt,
+		Start:        o.StartsAt,
+		End:          o.EndsAt,
+		Summary:      summary,
+		Location:     location,
+		Description:  fmt.Sprintf("Order #%d (%s)", o.ID, o.Status),
+		Status:       status,
+	}
+}
+
+func writeCalendar(w http.ResponseWriter, filename string, c ical.Calendar) {
+	var buf bytes.Buffer
+	_ = ical.Encode(&buf, c, time.Now())
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+var (
+	problemNotFound          = problem.New(http.StatusNotFound, problem.CodeNotFound, "resource not found")
+	problemMethodNotAllowed  = problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, "method not allowed")
+	problemInvalidJSON       = problem.New(http.StatusBadRequest, problem.CodeInvalidJSON, "invalid json body")
+	problemInternal          = problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+	problemForbidden         = problem.New(http.StatusForbidden, problem.CodeForbidden, "you are not allowed to perform this action")
+	problemInsufficientScope = problem.New(http.StatusForbidden, problem.CodeInsufficientScope, "api key lacks the required scope for this branch")
+
+	problemInvalidCalendarToken = problem.New(http.StatusUnauthorized, problem.CodeInvalidCalendarToken, "invalid calendar feed token")
+
+	problemTimeslotOverlap = problem.New(http.StatusConflict, problem.CodeTimeslotOverlap, "timeslot overlaps another timeslot of the branch")
+)
+
+// sentinelProblems maps repository sentinel errors to their public problem.
+// Add new domain errors here instead of switching on them in each handler.
+var sentinelProblems = []struct {
+	err error
+	p   *problem.Problem
+}{
+	{repository.ErrTimeslotNotFound, problem.New(http.StatusNotFound, problem.CodeTimeslotNotFound, "timeslot not found")},
+	{repository.ErrTimeslotInactive, problem.New(http.StatusConflict, problem.CodeTimeslotInactive, "timeslot is inactive")},
+	{repository.ErrTimeslotFullyBooked, problem.New(http.StatusConflict, problem.CodeTimeslotFullyBooked, "timeslot is fully booked")},
+	{repository.ErrOrderNotFound, problem.New(http.StatusNotFound, problem.CodeOrderNotFound, "order not found")},
+	{repository.ErrOrderNotCancellable, problem.New(http.StatusConflict, problem.CodeOrderNotCancellable, "order is not cancellable")},
+	{repository.ErrBranchNotFound, problem.New(http.StatusNotFound, problem.CodeBranchNotFound, "branch not found")},
+	{repository.ErrBranchNameTaken, problem.New(http.StatusConflict, problem.CodeBranchNameTaken, "branch name already exists")},
+	{repository.ErrBranchInactive, problem.New(http.StatusConflict, problem.CodeBranchInactive, "branch is inactive")},
+	{repository.ErrBookingWindowClosed, problem.New(http.StatusUnprocessableEntity, problem.CodeBookingWindowClosed, "booking window closed")},
+	{repository.ErrBookingTooFarInAdvance, problem.New(http.StatusUnprocessableEntity, problem.CodeBookingTooFarAhead, "booking too far in advance")},
+	{repository.ErrOrderNotReschedulable, problem.New(http.StatusConflict, problem.CodeOrderNotReschedulable, "order is not reschedulable")},
+	{repository.ErrRescheduleSameTimeslot, problem.New(http.StatusConflict, problem.CodeSameTimeslot, "order is already in this timeslot")},
+	{repository.ErrCapacityBelowReserved, problem.New(http.StatusConflict, problem.CodeCapacityBelowReserved, "capacity is below reserved seats")},
+	{repository.ErrOrderNotOwned, problem.New(http.StatusForbidden, problem.CodeOrderNotOwned, "order belongs to another customer")},
+	{repository.ErrOrderNotCheckable, problem.New(http.StatusConflict, problem.CodeOrderNotCheckable, "order cannot be checked in")},
+	{repository.ErrAPIKeyNotFound, problem.New(http.StatusNotFound, problem.CodeAPIKeyNotFound, "api key not found")},
+	{repository.ErrAPIKeyRevoked, problem.New(http.StatusConflict, problem.CodeAPIKeyRevoked, "api key is revoked or expired")},
+	{repository.ErrWebhookNotFound, problem.New(http.StatusNotFound, problem.CodeWebhookNotFound, "webhook endpoint not found")},
+	{repository.ErrWebhookDeliveryNotFound, problem.New(http.StatusNotFound, problem.CodeDeliveryNotFound, "webhook delivery not found")},
+	{repository.ErrCalendarTokenInvalid, problemInvalidCalendarToken},
+	{repository.ErrCustomerBlocked, problem.New(http.StatusForbidden, problem.CodeBookingBlocked, "too many no-shows or late cancellations to book at this branch")},
+	{repository.ErrConfirmationWindowClosed, problem.New(http.StatusUnprocessableEntity, problem.CodeConfirmWindowClosed, "slot starts too soon to confirm the booking")},
+	{repository.ErrOrderNotConfirmable, problem.New(http.StatusConflict, problem.CodeOrderNotConfirmable, "order cannot be confirmed")},
+	{repository.ErrOrderNotMarkable, problem.New(http.StatusConflict, problem.CodeOrderNotMarkable, "order cannot be marked as no-show")},
+	{repository.ErrSlotNotStarted, problem.New(http.StatusConflict, problem.CodeSlotNotStarted, "timeslot has not started yet")},
+	{repository.ErrResourceNotFound, problem.New(http.StatusNotFound, problem.CodeResourceNotFound, "resource not found")},
+	{repository.ErrResourceNameTaken, problem.New(http.StatusConflict, problem.CodeResourceNameTaken, "resource name already exists in this branch")},
+	{repository.ErrResourceNotAssigned, problem.New(http.StatusUnprocessableEntity, problem.CodeResourceNotAssigned, "resource does not serve this timeslot")},
+	{repository.ErrResourceUnavailable, problem.New(http.StatusConflict, problem.CodeResourceUnavailable, "resource is not available for this timeslot")},
+	{repository.ErrResourceInUse, problem.New(http.StatusConflict, problem.CodeResourceInUse, "resource holds bookings in this timeslot")},
+	{repository.ErrCapacityFromResources, problem.New(http.StatusConflict, problem.CodeCapacityFromResources, "capacity is set by the timeslot's resources")},
+	{repository.ErrServiceNotFound, problem.New(http.StatusNotFound, problem.CodeServiceNotFound, "service not found")},
+	{repository.ErrServiceNameTaken, problem.New(http.StatusConflict, problem.CodeServiceNameTaken, "service name already exists in this branch")},
+	{repository.ErrServiceInactive, problem.New(http.StatusConflict, problem.CodeServiceInactive, "service is inactive")},
+	{repository.ErrServiceDoesNotFit, problem.New(http.StatusConflict, problem.CodeServiceDoesNotFit, "service does not fit the consecutive timeslots")},
+	{repository.ErrTimeslotOverlap, problemTimeslotOverlap},
+	{repository.ErrCancellationDeadlinePassed, problem.New(http.StatusUnprocessableEntity, problem.CodeCancelDeadline, "cancellation deadline passed")},
+}
+
+// problemFor resolves err to a problem; unknown errors become a 500 carrying
+// the given detail message ID (never the raw error text).
+func problemFor(err error, detail string) *problem.Problem {
+	var p *problem.Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var overlap *repository.TimeslotOverlapError
+	if errors.As(err, &overlap) {
+		return problemTimeslotOverlap.WithConflict(overlap.Conflict)
+	}
+	for _, s := range sentinelProblems {
+		if errors.Is(err, s.err) {
+			return s.p
+		}
+	}
+	return problemInternal.WithDetail(detail)
+}
+
+// writeError writes the problem for err.
+func writeError(w http.ResponseWriter, r *http.Request, err error, detail string) {
+	problem.Write(w, r, problemFor(err, detail))
+}
+
+// fieldErrors collects validation failures for a single request.
+type fieldErrors []problem.FieldError
+
+// add records a failure; the message comes from the "field.<code>" catalog entry.
+func (fe *fieldErrors) add(field, code string) {
+	*fe = append(*fe, problem.FieldError{Field: field, Code: code})
+}
+
+// problem returns nil when nothing failed.
+func (fe fieldErrors) problem() *problem.Problem {
+	if len(fe) == 0 {
+		return nil
+	}
+	return problem.Validation(fe...)
+}
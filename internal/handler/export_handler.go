@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/export"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+// maxExportDays bounds the date range of one export.
+const maxExportDays = 92
+
+type ExportHandler struct {
+	orders    *repository.OrderRepository
+	timetable *repository.TimetableRepository
+	branches  *repository.BranchRepository
+}
+
+func NewExportHandler(orders *repository.OrderRepository, timetable *repository.TimetableRepository, branches *repository.BranchRepository) *ExportHandler {
+	return &ExportHandler{orders: orders, timetable: timetable, branches: branches}
+}
+
+// exportColumn is a selectable column; value renders a row in the branch's
+// time zone.
+type exportColumn[T any] struct {
+	name  string
+	value func(row T, loc *time.Location) any
+}
+
+var orderExportColumns = []exportColumn[model.Order]{
+	{"id", func(o model.Order, _ *time.Location) any { return o.ID }},
+	{"timeslot_id", func(o model.Order, _ *time.Location) any { return o.TimeslotID }},
+	{"resource_id", func(o model.Order, _ *time.Location) any {
+		if o.ResourceID == nil {
+			return nil
+		}
+		return *o.ResourceID
+	}},
+	{"service_id", func(o model.Order, _ *time.Location) any {
+		if o.ServiceID == nil {
+			return nil
+		}
+		return *o.ServiceID
+	}},
+	{"service_date", func(o model.Order, loc *time.Location) any { return o.StartsAt.In(loc).Format("2006-01-02") }},
+	{"start_time", func(o model.Order, loc *time.Location) any { return o.StartsAt.In(loc).Format("15:04") }},
+	{"end_time", func(o model.Order, loc *time.Location) any { return o.EndsAt.In(loc).Format("15:04") }},
+	{"customer_name", func(o model.Order, _ *time.Location) any { return o.CustomerName }},
+	{"customer_id", func(o model.Order, _ *time.Location) any { return stringOrNil(o.CustomerID) }},
+	{"status", func(o model.Order, _ *time.Location) any { return o.Status }},
+	{"cancel_reason", func(o model.Order, _ *time.Location) any {
+		if o.CancelReason == nil {
+			return nil
+		}
+		return string(*o.CancelReason)
+	}},
+	{"cancel_note", func(o model.Order, _ *time.Location) any { return stringOrNil(o.CancelNote) }},
+	{"cancelled_at", func(o model.Order, loc *time.Location) any { return localTimestamp(o.CancelledAt, loc) }},
+	{"checked_in_at", func(o model.Order, loc *time.Location) any { return localTimestamp(o.CheckedInAt, loc) }},
+	{"no_show_at", func(o model.Order, loc *time.Location) any { return localTimestamp(o.NoShowAt, loc) }},
+	{"confirmed_at", func(o model.Order, loc *time.Location) any { return localTimestamp(o.ConfirmedAt, loc) }},
+	{"created_at", func(o model.Order, loc *time.Location) any { return localTimestamp(&o.CreatedAt, loc) }},
+	{"updated_at", func(o model.Order, loc *time.Location) any { return localTimestamp(&o.UpdatedAt, loc) }},
+}
+
+var orderExportDefaults = []string{"id", "service_date", "start_time", "end_time", "customer_name", "status", "created_at"}
+
+// timetableRow is a slot with one of its orders (nil for a slot without).
+type timetableRow struct {
+	slot  model.Timeslot
+	order *model.Order
+}
+
+var timetableExportColumns = []exportColumn[timetableRow]{
+	{"timeslot_id", func(r timetableRow, _ *time.Location) any { return r.slot.ID }},
+	{"service_date", func(r timetableRow, _ *time.Location) any { return r.slot.ServiceDate }},
+	{"start_time", func(r timetableRow, loc *time.Location) any { return r.slot.StartsAt.In(loc).Format("15:04") }},
+	{"end_time", func(r timetableRow, loc *time.Location) any { return r.slot.EndsAt.In(loc).Format("15:04") }},
+	{"capacity", func(r timetableRow, _ *time.Location) any { return r.slot.Capacity }},
+	{"reserved", func(r timetableRow, _ *time.Location) any { return r.slot.Reserved }},
+	{"available", func(r timetableRow, _ *time.Location) any { return max(r.slot.Capacity-r.slot.Reserved, 0) }},
+	{"is_active", func(r timetableRow, _ *time.Location) any { return r.slot.IsActive }},
+	{"order_id", func(r timetableRow, _ *time.Location) any {
+		if r.order == nil {
+			return nil
+		}
+		return r.order.ID
+	}},
+	{"customer_name", func(r timetableRow, _ *time.Location) any {
+		if r.order == nil {
+			return nil
+		}
+		return r.order.CustomerName
+	}},
+	{"status", func(r timetableRow, _ *time.Location) any {
+		if r.order == nil {
+			return nil
+		}
+		return r.order.Status
+	}},
+	{"booked_at", func(r timetableRow, loc *time.Location) any {
+		if r.order == nil {
+			return nil
+		}
+		return localTimestamp(&r.order.CreatedAt, loc)
+	}},
+	{"checked_in_at", func(r timetableRow, loc *time.Location) any {
+		if r.order == nil {
+			return nil
+		}
+		return localTimestamp(r.order.CheckedInAt, loc)
+	}},
+}
+
+var timetableExportDefaults = []string{"service_date", "start_time", "end_time", "capacity", "reserved", "order_id", "customer_name", "status"}
+
+// exportRequest is the parsed query of an export.
+type exportRequest struct {
+	branchRange
+	format  export.Format
+	columns []string // nil = defaults
+	loc     *time.Location
+}
+
+// Orders serves GET /exports/orders?branch_id=&from=&to=&format=&columns=.
+func (h *ExportHandler) Orders(w http.ResponseWriter, r *http.Request) {
+	req, cols, ok := prepareExport(w, r, h.branches, orderExportColumns, orderExportDefaults)
+	if !ok {
+		return
+	}
+
+	out, err := startExport(w, req, "orders", cols)
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	err = h.orders.EachInRange(r.Context(), req.branchID, req.from, req.to, func(o model.Order) error {
+		return out.WriteRow(exportValues(cols, o, req.loc))
+	})
+	finishExport(out, err)
+}
+
+// Timetable serves GET /exports/timetable?branch_id=&from=&to=&format=&columns=,
+// one row per active order plus one per slot without orders.
+func (h *ExportHandler) Timetable(w http.ResponseWriter, r *http.Request) {
+	req, cols, ok := prepareExport(w, r, h.branches, timetableExportColumns, timetableExportDefaults)
+	if !ok {
+		return
+	}
+
+	out, err := startExport(w, req, "timetable", cols)
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	err = h.timetable.EachInRange(r.Context(), req.branchID, req.from, req.to, func(t model.Timeslot, o *model.Order) error {
+		return out.WriteRow(exportValues(cols, timetableRow{slot: t, order: o}, req.loc))
+	})
+	finishExport(out, err)
+}
+
+// prepareExport validates the query and authorizes the caller, writing a
+// problem and returning false on failure. Nothing is written on success.
+func prepareExport[T any](
+	w http.ResponseWriter,
+	r *http.Request,
+	branches *repository.BranchRepository,
+	all []exportColumn[T],
+	defaults []string,
+) (exportRequest, []exportColumn[T], bool) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return exportRequest{}, nil, false
+	}
+
+	q := r.URL.Query()
+	var fe fieldErrors
+	req := exportRequest{branchRange: parseBranchRange(r, &fe)}
+	var ok bool
+	if req.format, ok = export.ParseFormat(q.Get("format")); !ok {
+		fe.add("format", problem.FieldInvalid)
+	}
+
+	names := defaults
+	if v := q.Get("columns"); v != "" {
+		names = strings.Split(v, ",")
+	}
+	cols := make([]exportColumn[T], 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		idx := slices.IndexFunc(all, func(c exportColumn[T]) bool { return c.name == name })
+		if idx < 0 {
+			fe.add("columns", problem.FieldInvalid)
+			break
+		}
+		if slices.ContainsFunc(cols, func(c exportColumn[T]) bool { return c.name == name }) {
+			fe.add("columns", problem.FieldDuplicate)
+			break
+		}
+		cols = append(cols, all[idx])
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return exportRequest{}, nil, false
+	}
+	if !authorize(w, r, authz.ViewBranchOrders, req.branchID) {
+		return exportRequest{}, nil, false
+	}
+
+	loc, err := branches.Location(r.Context(), req.branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.export_failed")
+		return exportRequest{}, nil, false
+	}
+	req.loc = loc
+	if p := req.resolve(loc, maxExportDays); p != nil {
+		problem.Write(w, r, p)
+		return exportRequest{}, nil, false
+	}
+	return req, cols, true
+}
+
+// startExport sends the headers and the header row; from here on failures
+// can no longer become problem responses.
+func startExport[T any](w http.ResponseWriter, req exportRequest, name string, cols []exportColumn[T]) (export.Writer, error) {
+	filename := fmt.Sprintf("%s_branch%d_%s_%s.%s", name, req.branchID, req.from, req.to, req.format)
+	w.Header().Set("Content-Type", req.format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.name
+	}
+	return export.New(req.format, w, name, header)
+}
+
+// finishExport completes the file, or aborts the response so the client sees
+// a broken download rather than a silently truncated file.
+func finishExport(out export.Writer, err error) {
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func exportValues[T any](cols []exportColumn[T], row T, loc *time.Location) []any {
+	values := make([]any, len(cols))
+	for i, c := range cols {
+		values[i] = c.value(row, loc)
+	}
+	return values
+}
+
+func stringOrNil(s *string) any {
+	if s == nil {
+		return nil
+	}
+	return *s
+}
+
+// localTimestamp formats t as a branch-local wall clock time, which
+// spreadsheets recognise as a date-time.
+func localTimestamp(t *time.Time, loc *time.Location) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.In(loc).Format("2006-01-02 15:04:05")
+}
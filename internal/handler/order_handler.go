@@ -3,27 +3,45 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
 	"github.com/idlistic/go-backend-api-sample/internal/repository"
 )
 
 type OrderHandler struct {
-	repo *repository.OrderRepository
+	repo     *repository.OrderRepository
+	branches *repository.BranchRepository
 }
 
-func NewOrderHandler(repo *repository.OrderRepository) *OrderHandler {
-	return &OrderHandler{repo: repo}
+func NewOrderHandler(repo *repository.OrderRepository, branches *repository.BranchRepository) *OrderHandler {
+	return &OrderHandler{repo: repo, branches: branches}
 }
 
 type CreateOrderRequest struct {
 	BranchID     int64  `json:"branch_id"`
 	TimeslotID   int64  `json:"timeslot_id"`
+	ResourceID   int64  `json:"resource_id"` // optional; any free resource of the slot when omitted
+	ServiceID    int64  `json:"service_id"`  // optional; the slot is the service's start
 	CustomerName string `json:"customer_name"`
 }
 
+type CancelOrderRequest struct {
+	Reason model.CancelReason `json:"reason"`
+	Note   string             `json:"note"` // required when reason is "other"
+}
+
+type RescheduleOrderRequest struct {
+	TimeslotID int64  `json:"timeslot_id"`
+	Note       string `json:"note"`
+}
+
+const maxCancelNoteLen = 500
+
 func (h *OrderHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -31,46 +49,47 @@ func (h *OrderHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.Create(w, r)
 	default:
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
-			"error": "method not allowed",
-		})
+		problem.Write(w, r, problemMethodNotAllowed)
 	}
 }
 func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	var req CreateOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "invalid json body",
-		})
+		problem.Write(w, r, problemInvalidJSON)
 		return
 	}
 
 	req.CustomerName = strings.TrimSpace(req.CustomerName)
 
-	if req.BranchID <= 0 || req.TimeslotID <= 0 || req.CustomerName == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "branch_id, timeslot_id, customer_name are required",
-		})
+	var fe fieldErrors
+	if req.BranchID <= 0 {
+		fe.add("branch_id", problem.FieldRequired)
+	}
+	if req.TimeslotID <= 0 {
+		fe.add("timeslot_id", problem.FieldRequired)
+	}
+	if req.ResourceID < 0 {
+		fe.add("resource_id", problem.FieldPositiveInt)
+	}
+	if req.ServiceID < 0 {
+		fe.add("service_id", problem.FieldPositiveInt)
+	}
+	if req.CustomerName == "" {
+		fe.add("customer_name", problem.FieldRequired)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !requireScope(w, r, authz.ScopeWriteOrders, req.BranchID) {
 		return
 	}
 
-	order, err := h.repo.CreateWithTimeslotReservation(r.Context(), req.BranchID, req.TimeslotID, req.CustomerName)
+	order, err := h.repo.CreateWithTimeslotReservation(r.Context(), actorFrom(r, req.BranchID), req.BranchID, req.TimeslotID, req.ResourceID, req.ServiceID, req.CustomerName)
 	if err != nil {
-		switch err {
-		case repository.ErrTimeslotNotFound:
-			writeJSON(w, http.StatusNotFound, map[string]any{"error": "timeslot not found"})
-			return
-		case repository.ErrTimeslotInactive:
-			writeJSON(w, http.StatusConflict, map[string]any{"error": "timeslot inactive"})
-			return
-		case repository.ErrTimeslotFullyBooked:
-			writeJSON(w, http.StatusConflict, map[string]any{"error": "timeslot fully booked"})
-			return
-		default:
-			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to create order"})
-			return
-		}
+		writeError(w, r, err, "detail.create_order_failed")
+		return
 	}
 
 	writeJSON(w, http.StatusCreated, map[string]any{
@@ -78,47 +97,105 @@ func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
-	// Expect: PATCH /orders/{id}/cancel
-	if r.Method != http.MethodPatch {
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]any{
-			"error": "method not allowed",
-		})
+// HandleItem serves /orders/{id}/cancel, /reschedule, /confirm, /check-in,
+// /no-show, /history and /orders/{id}.ics. The order's branch is resolved first so every action is
+// authorized against it.
+func (h *OrderHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	seg := pathSegments(r, "/orders/")
+	if len(seg) == 1 && strings.HasSuffix(seg[0], ".ics") {
+		seg = []string{strings.TrimSuffix(seg[0], ".ics"), ".ics"}
+	}
+	if len(seg) != 2 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	orderID, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	route, ok := orderItemRoutes[seg[1]]
+	if !ok {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+	if r.Method != route.method {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	branchID, err := h.repo.BranchOf(r.Context(), orderID)
+	if err != nil {
+		writeError(w, r, err, route.detail)
+		return
+	}
+	h.serveItem(w, r, route, orderID, branchID)
+}
+
+// serveItem checks the route's key scope and runs it for an order of
+// branchID. The action itself still checks the caller's role: check-in and
+// no-show need staff, which keys never are.
+func (h *OrderHandler) serveItem(w http.ResponseWriter, r *http.Request, route orderItemRoute, orderID, branchID int64) {
+	if !requireScope(w, r, route.scope, branchID) {
 		return
 	}
+	route.serve(h, w, r, orderID, branchID)
+}
+
+// orderItemRoute is an action of HandleItem and the API key scope it needs.
+type orderItemRoute struct {
+	method, detail string
+	scope          authz.Scope
+	serve          func(*OrderHandler, http.ResponseWriter, *http.Request, int64, int64)
+}
 
-	path := r.URL.Path // e.g. /orders/123/cancel
-	const prefix = "/orders/"
-	const suffix = "/cancel"
+var orderItemRoutes = map[string]orderItemRoute{
+	"cancel":     {http.MethodPatch, "detail.cancel_order_failed", authz.ScopeWriteOrders, (*OrderHandler).Cancel},
+	"reschedule": {http.MethodPatch, "detail.reschedule_order_failed", authz.ScopeWriteOrders, (*OrderHandler).Reschedule},
+	"confirm":    {http.MethodPatch, "detail.confirm_order_failed", authz.ScopeWriteOrders, (*OrderHandler).Confirm},
+	"check-in":   {http.MethodPatch, "detail.check_in_order_failed", authz.ScopeWriteOrders, (*OrderHandler).CheckIn},
+	"no-show":    {http.MethodPatch, "detail.mark_no_show_failed", authz.ScopeWriteOrders, (*OrderHandler).MarkNoShow},
+	"history":    {http.MethodGet, "detail.query_order_history_failed", authz.ScopeReadOrders, (*OrderHandler).History},
+	".ics":       {http.MethodGet, "detail.query_calendar_failed", authz.ScopeReadOrders, (*OrderHandler).Calendar},
+}
 
-	if len(path) <= len(prefix)+len(suffix) || path[:len(prefix)] != prefix || path[len(path)-len(suffix):] != suffix {
-		writeJSON(w, http.StatusNotFound, map[string]any{"error": "not found"})
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	var req CancelOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
 		return
 	}
 
-	idStr := path[len(prefix) : len(path)-len(suffix)]
-	orderID, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil || orderID <= 0 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "invalid order id",
-		})
+	req.Note = strings.TrimSpace(req.Note)
+
+	var fe fieldErrors
+	switch {
+	case req.Reason == "":
+		fe.add("reason", problem.FieldRequired)
+	case !req.Reason.Valid():
+		fe.add("reason", problem.FieldInvalid)
+	case req.Reason == model.CancelOther && req.Note == "":
+		fe.add("note", problem.FieldRequired)
+	}
+	if utf8.RuneCountInString(req.Note) > maxCancelNoteLen {
+		fe.add("note", problem.FieldTooLong)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
 		return
 	}
 
-	order, err := h.repo.CancelAndReleaseTimeslot(r.Context(), orderID)
+	order, err := h.repo.CancelAndReleaseTimeslot(r.Context(), orderID, repository.CancelRequest{
+		Actor:  actorFrom(r, branchID),
+		Reason: req.Reason,
+		Note:   req.Note,
+	})
 	if err != nil {
-		switch err {
-		case repository.ErrOrderNotFound:
-			writeJSON(w, http.StatusNotFound, map[string]any{"error": "order not found"})
-			return
-		case repository.ErrOrderNotCancellable:
-			writeJSON(w, http.StatusConflict, map[string]any{"error": "order not cancellable"})
-			return
-		default:
-			// if timeslot missing etc.
-			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to cancel order"})
-			return
-		}
+		// if timeslot missing etc.
+		writeError(w, r, err, "detail.cancel_order_failed")
+		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
@@ -126,37 +203,172 @@ func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
-	branchIDStr := r.URL.Query().Get("branch_id")
-	date := r.URL.Query().Get("date")
+func (h *OrderHandler) Reschedule(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	var req RescheduleOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	req.Note = strings.TrimSpace(req.Note)
+
+	var fe fieldErrors
+	if req.TimeslotID <= 0 {
+		fe.add("timeslot_id", problem.FieldRequired)
+	}
+	if utf8.RuneCountInString(req.Note) > maxCancelNoteLen {
+		fe.add("note", problem.FieldTooLong)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	order, err := h.repo.Reschedule(r.Context(), orderID, req.TimeslotID, repository.RescheduleRequest{
+		Actor: actorFrom(r, branchID),
+		Note:  req.Note,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.reschedule_order_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"order": order,
+	})
+}
 
-	if branchIDStr == "" || date == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "branch_id and date are required",
-		})
+// CheckIn marks a customer as arrived; staff of the order's branch only.
+func (h *OrderHandler) CheckIn(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	if !authorize(w, r, authz.CheckIn, branchID) {
 		return
 	}
 
-	branchID, err := strconv.ParseInt(branchIDStr, 10, 64)
-	if err != nil || branchID <= 0 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "branch_id must be a positive integer",
-		})
+	order, err := h.repo.CheckIn(r.Context(), actorFrom(r, branchID), orderID)
+	if err != nil {
+		writeError(w, r, err, "detail.check_in_order_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"order": order,
+	})
+}
+
+// Confirm confirms an unconfirmed booking; open to the order's owner and to
+// staff of its branch.
+func (h *OrderHandler) Confirm(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	order, err := h.repo.Confirm(r.Context(), actorFrom(r, branchID), orderID)
+	if err != nil {
+		writeError(w, r, err, "detail.confirm_order_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"order": order,
+	})
+}
+
+// MarkNoShow records that the customer did not come; staff of the order's
+// branch only, once the slot has started.
+func (h *OrderHandler) MarkNoShow(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	if !authorize(w, r, authz.CheckIn, branchID) {
+		return
+	}
+
+	order, err := h.repo.MarkNoShow(r.Context(), actorFrom(r, branchID), orderID)
+	if err != nil {
+		writeError(w, r, err, "detail.mark_no_show_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"order": order,
+	})
+}
+
+// Reliability serves GET /reliability?branch_id=&customer_id=: a customer's
+// no-shows and late cancellations under the branch's policy. Customers may
+// only look up themselves (customer_id defaults to the caller); staff of the
+// branch may look up anyone.
+func (h *OrderHandler) Reliability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
 		return
 	}
 
-	if _, err := time.Parse("2006-01-02", date); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "date must be YYYY-MM-DD",
-		})
+	q := r.URL.Query()
+	var (
+		fe       fieldErrors
+		branchID int64
+		ok       bool
+	)
+	if v := q.Get("branch_id"); v == "" {
+		fe.add("branch_id", problem.FieldRequired)
+	} else if branchID, ok = parseID(v); !ok {
+		fe.add("branch_id", problem.FieldPositiveInt)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	p, _ := auth.FromContext(r.Context())
+	customerID := strings.TrimSpace(q.Get("customer_id"))
+	switch {
+	case customerID == "" || customerID == p.Subject:
+		customerID = p.Subject
+	case !authorize(w, r, authz.ViewBranchOrders, branchID):
+		return
+	}
+
+	rec, err := h.repo.Reliability(r.Context(), branchID, customerID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reliability_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"branch_id":   branchID,
+		"reliability": rec,
+	})
+}
+
+// History is open to the order's owner and to staff of its branch.
+func (h *OrderHandler) History(w http.ResponseWriter, r *http.Request, orderID, branchID int64) {
+	items, err := h.repo.History(r.Context(), actorFrom(r, branchID), orderID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_order_history_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"order_id": orderID,
+		"count":    len(items),
+		"items":    items,
+	})
+}
+
+func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
+	branchID, date, p := parseBranchAndDate(r)
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	// the branch listing exposes other customers' bookings
+	if !authorize(w, r, authz.ViewBranchOrders, branchID) {
+		return
+	}
+
+	date, err := resolveBranchDate(r.Context(), h.branches, branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_orders_failed")
 		return
 	}
 
 	items, err := h.repo.ListByBranchAndDate(r.Context(), branchID, date)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error": "failed to query orders",
-		})
+		writeError(w, r, err, "detail.query_orders_failed")
 		return
 	}
 
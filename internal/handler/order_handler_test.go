@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+func TestOrderItemRouteScopes(t *testing.T) {
+	keyWith := func(scope authz.Scope) auth.Principal {
+		return auth.Principal{Subject: "key:1", APIKeyID: 1, TenantID: 1, Scopes: []string{string(scope)}}
+	}
+	reads := []string{"history", ".ics"}
+	writes := []string{"cancel", "reschedule", "confirm"}
+	// pass the scope check but need staff; see TestOrderStaffActionsRefuseKeys
+	staff := []string{"check-in", "no-show"}
+
+	tests := []struct {
+		name    string
+		p       auth.Principal
+		allowed []string
+	}{
+		{"availability:read", keyWith(authz.ScopeReadAvailability), nil},
+		{"orders:read", keyWith(authz.ScopeReadOrders), reads},
+		{"orders:write", keyWith(authz.ScopeWriteOrders), append(writes, staff...)},
+		{"user", auth.Principal{Subject: "u1"}, append(append(reads, writes...), staff...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for action, route := range orderItemRoutes {
+				want := false
+				for _, a := range tt.allowed {
+					want = want || a == action
+				}
+
+				r := httptest.NewRequest(route.method, "/orders/1/"+action, nil)
+				r = r.WithContext(auth.WithPrincipal(r.Context(), tt.p))
+				rec := httptest.NewRecorder()
+				got := requireScope(rec, r, route.scope, 1)
+				if got != want {
+					t.Errorf("%s: allowed = %v, want %v", action, got, want)
+				}
+				if !got && rec.Code != http.StatusForbidden {
+					t.Errorf("%s: status = %d, want 403", action, rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderStaffActionsRefuseKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		p    auth.Principal
+	}{
+		{"orders:write key", auth.Principal{Subject: "key:1", APIKeyID: 1, TenantID: 1, Scopes: []string{string(authz.ScopeWriteOrders)}}},
+		{"customer", auth.Principal{Subject: "u1"}},
+	}
+	// the role check comes before the repository, so a bare handler will do
+	h := &OrderHandler{}
+	for _, tt := range tests {
+		for _, action := range []string{"check-in", "no-show"} {
+			t.Run(tt.name+" "+action, func(t *testing.T) {
+				route := orderItemRoutes[action]
+				r := httptest.NewRequest(route.method, "/orders/1/"+action, nil)
+				r = r.WithContext(auth.WithPrincipal(r.Context(), tt.p))
+				rec := httptest.NewRecorder()
+				h.serveItem(rec, r, route, 1, 1)
+				if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"`+problem.CodeForbidden+`"`) {
+					t.Errorf("status = %d, body = %s; want 403 %s", rec.Code, rec.Body, problem.CodeForbidden)
+				}
+			})
+		}
+	}
+}
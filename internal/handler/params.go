@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+// parseBranchAndDate validates the common ?branch_id=&date= query pair.
+func parseBranchAndDate(r *http.Request) (int64, string, *problem.Problem) {
+	branchIDStr := r.URL.Query().Get("branch_id")
+	date := r.URL.Query().Get("date")
+
+	var fe fieldErrors
+	var branchID int64
+
+	if branchIDStr == "" {
+		fe.add("branch_id", problem.FieldRequired)
+	} else if id, err := strconv.ParseInt(branchIDStr, 10, 64); err != nil || id <= 0 {
+		fe.add("branch_id", problem.FieldPositiveInt)
+	} else {
+		branchID = id
+	}
+
+	// validate date format YYYY-MM-DD (or a branch-relative keyword)
+	if date == "" {
+		fe.add("date", problem.FieldRequired)
+	} else if !validDate(date) {
+		fe.add("date", problem.FieldDateFormat)
+	}
+
+	return branchID, date, fe.problem()
+}
+
+// branchRange is the ?branch_id=&from=&to= query of reports and exports: an
+// inclusive range of branch-local dates.
+type branchRange struct {
+	branchID int64
+	from, to string // YYYY-MM-DD once resolved
+}
+
+// parseBranchRange validates the ?branch_id=&from=&to= query, recording
+// failures in fe. from and to may still be relative dates.
+func parseBranchRange(r *http.Request, fe *fieldErrors) branchRange {
+	q := r.URL.Query()
+	var br branchRange
+	if v := q.Get("branch_id"); v == "" {
+		fe.add("branch_id", problem.FieldRequired)
+	} else if id, ok := parseID(v); ok {
+		br.branchID = id
+	} else {
+		fe.add("branch_id", problem.FieldPositiveInt)
+	}
+	for _, f := range []struct {
+		name string
+		dst  *string
+	}{{"from", &br.from}, {"to", &br.to}} {
+		v := q.Get(f.name)
+		switch {
+		case v == "":
+			fe.add(f.name, problem.FieldRequired)
+		case !validDate(v):
+			fe.add(f.name, problem.FieldDateFormat)
+		}
+		*f.dst = v
+	}
+	return br
+}
+
+// resolve turns relative dates into dates in loc and checks that the range
+// runs forward and spans fewer than maxDays days.
+func (br *branchRange) resolve(loc *time.Location, maxDays int) *problem.Problem {
+	now := time.Now()
+	br.from, _ = model.ResolveDate(loc, now, br.from)
+	br.to, _ = model.ResolveDate(loc, now, br.to)
+	from, _ := time.Parse("2006-01-02", br.from)
+	to, _ := time.Parse("2006-01-02", br.to)
+	if to.Before(from) || to.Sub(from) >= time.Duration(maxDays)*24*time.Hour {
+		return problem.Validation(problem.FieldError{Field: "to", Code: problem.FieldOutOfRange})
+	}
+	return nil
+}
+
+// validDate accepts YYYY-MM-DD or today/tomorrow/yesterday.
+func validDate(s string) bool {
+	switch s {
+	case "today", "tomorrow", "yesterday":
+		return true
+	}
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// resolveBranchDate turns a relative date into the branch-local calendar
+// date; absolute dates are returned without touching the database.
+func resolveBranchDate(ctx context.Context, branches *repository.BranchRepository, branchID int64, date string) (string, error) {
+	if _, err := time.Parse("2006-01-02", date); err == nil {
+		return date, nil
+	}
+	loc, err := branches.Location(ctx, branchID)
+	if err != nil {
+		return "", err
+	}
+	return model.ResolveDate(loc, time.Now(), date)
+}
+
+// pathSegments returns the path below prefix split on "/",
+// e.g. ("/orders/12/cancel", "/orders/") -> ["12", "cancel"].
+func pathSegments(r *http.Request, prefix string) []string {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	if rest == "" {
+		return nil
+	}
+	return strings.Split(rest, "/")
+}
+
+// parseID parses a positive int64 path or query ID.
+func parseID(s string) (int64, bool) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// validClock reports whether s is a zero-padded HH:MM wall clock time,
+// so that clocks can be compared as strings.
+func validClock(s string) bool {
+	_, err := time.Parse("15:04", s)
+	return err == nil && len(s) == len("15:04")
+}
@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+// maxReportDays bounds the date range of one report.
+const maxReportDays = 366
+
+type ReportHandler struct {
+	analytics *repository.AnalyticsRepository
+	branches  *repository.BranchRepository
+}
+
+func NewReportHandler(analytics *repository.AnalyticsRepository, branches *repository.BranchRepository) *ReportHandler {
+	return &ReportHandler{analytics: analytics, branches: branches}
+}
+
+type reportRequest struct {
+	branchRange
+	group string // repository.PeriodDay or PeriodWeek
+}
+
+// Utilization serves GET /reports/utilization: reserved/capacity of active
+// slots per day or week.
+func (h *ReportHandler) Utilization(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.prepare(w, r, true)
+	if !ok {
+		return
+	}
+	items, err := h.analytics.Utilization(r.Context(), req.branchID, req.from, req.to, req.group)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return
+	}
+
+	var total model.Utilization
+	for _, u := range items {
+		total.Slots += u.Slots
+		total.FullSlots += u.FullSlots
+		total.Capacity += u.Capacity
+		total.Reserved += u.Reserved
+	}
+	if total.Capacity > 0 {
+		v := float64(total.Reserved) / float64(total.Capacity)
+		total.Utilization = &v
+	}
+	h.write(w, r, req, total, items)
+}
+
+// Bookings serves GET /reports/bookings: orders booked and cancelled per day
+// or week.
+func (h *ReportHandler) Bookings(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.prepare(w, r, true)
+	if !ok {
+		return
+	}
+	items, err := h.analytics.BookingActivity(r.Context(), req.branchID, req.from, req.to, req.group)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return
+	}
+
+	var bookings, cancellations int
+	for _, a := range items {
+		bookings += a.Bookings
+		cancellations += a.Cancellations
+	}
+	summary := map[string]any{
+		"bookings":          bookings,
+		"cancellations":     cancellations,
+		"cancellation_rate": nil,
+	}
+	if bookings > 0 {
+		summary["cancellation_rate"] = float64(cancellations) / float64(bookings)
+	}
+	h.write(w, r, req, summary, items)
+}
+
+// Heatmap serves GET /reports/heatmap: utilization by weekday and hour.
+func (h *ReportHandler) Heatmap(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.prepare(w, r, false)
+	if !ok {
+		return
+	}
+	items, err := h.analytics.Heatmap(r.Context(), req.branchID, req.from, req.to)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return
+	}
+	h.write(w, r, req, nil, items)
+}
+
+// LeadTimes serves GET /reports/lead-times: how long before their slot
+// orders were booked.
+func (h *ReportHandler) LeadTimes(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.prepare(w, r, false)
+	if !ok {
+		return
+	}
+	items, err := h.analytics.LeadTimes(r.Context(), req.branchID, req.from, req.to)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return
+	}
+
+	orders := 0
+	for _, b := range items {
+		orders += b.Orders
+	}
+	h.write(w, r, req, map[string]any{"orders": orders}, items)
+}
+
+// prepare validates ?branch_id=&from=&to= (and &group= when grouped),
+// authorizes the caller and resolves relative dates in the branch's time
+// zone. On failure it has written the problem and returns false.
+func (h *ReportHandler) prepare(w http.ResponseWriter, r *http.Request, grouped bool) (reportRequest, bool) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return reportRequest{}, false
+	}
+
+	q := r.URL.Query()
+	var fe fieldErrors
+	req := reportRequest{branchRange: parseBranchRange(r, &fe)}
+	if grouped {
+		switch req.group = q.Get("group"); req.group {
+		case "":
+			req.group = repository.PeriodDay
+		case repository.PeriodDay, repository.PeriodWeek:
+		default:
+			fe.add("group", problem.FieldInvalid)
+		}
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return reportRequest{}, false
+	}
+	if !authorize(w, r, authz.ViewReports, req.branchID) {
+		return reportRequest{}, false
+	}
+
+	loc, err := h.branches.Location(r.Context(), req.branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return reportRequest{}, false
+	}
+	if p := req.resolve(loc, maxReportDays); p != nil {
+		problem.Write(w, r, p)
+		return reportRequest{}, false
+	}
+	return req, true
+}
+
+// write sends a report with the time the underlying views were refreshed.
+func (h *ReportHandler) write(w http.ResponseWriter, r *http.Request, req reportRequest, summary, items any) {
+	refreshedAt, err := h.analytics.RefreshedAt(r.Context())
+	if err != nil {
+		writeError(w, r, err, "detail.query_reports_failed")
+		return
+	}
+
+	body := map[string]any{
+		"branch_id":    req.branchID,
+		"from":         req.from,
+		"to":           req.to,
+		"refreshed_at": refreshedAt,
+		"items":        items,
+	}
+	if req.group != "" {
+		body["group"] = req.group
+	}
+	if summary != nil {
+		body["summary"] = summary
+	}
+	writeJSON(w, http.StatusOK, body)
+}
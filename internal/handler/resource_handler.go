@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+const maxResourceNameLen = 100
+
+type ResourceHandler struct {
+	repo *repository.ResourceRepository
+}
+
+func NewResourceHandler(repo *repository.ResourceRepository) *ResourceHandler {
+	return &ResourceHandler{repo: repo}
+}
+
+// ResourceRequest is the body of POST /resources and PATCH /resources/{id}.
+// Omitted fields are left unchanged on PATCH; the branch cannot be changed.
+type ResourceRequest struct {
+	BranchID     int64                         `json:"branch_id"` // POST only
+	Kind         *model.ResourceKind           `json:"kind"`
+	Name         *string                       `json:"name"`
+	IsActive     *bool                         `json:"is_active"`
+	Availability *[]model.ResourceAvailability `json:"availability"`
+}
+
+// Handle serves /resources.
+func (h *ResourceHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// HandleItem serves /resources/{id}.
+func (h *ResourceHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	seg := pathSegments(r, "/resources/")
+	if len(seg) != 1 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.Get(w, r, id)
+	case http.MethodPatch:
+		h.Update(w, r, id)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// List serves GET /resources?branch_id=, inactive resources included.
+func (h *ResourceHandler) List(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(r.URL.Query().Get("branch_id"), 10, 64)
+	if err != nil || branchID <= 0 {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "branch_id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	items, err := h.repo.List(r.Context(), branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_resources_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+func (h *ResourceHandler) Get(w http.ResponseWriter, r *http.Request, id int64) {
+	res, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_resources_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resource": res,
+	})
+}
+
+func (h *ResourceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req ResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(true); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !authorize(w, r, authz.ManageResources, req.BranchID) {
+		return
+	}
+
+	res := model.Resource{
+		BranchID: req.BranchID,
+		Kind:     *req.Kind,
+		Name:     *req.Name,
+		IsActive: true,
+	}
+	if req.IsActive != nil {
+		res.IsActive = *req.IsActive
+	}
+	if req.Availability != nil {
+		res.Availability = *req.Availability
+	}
+
+	out, err := h.repo.Create(r.Context(), actorFrom(r, req.BranchID), res)
+	if err != nil {
+		writeError(w, r, err, "detail.save_resource_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"resource": out,
+	})
+}
+
+func (h *ResourceHandler) Update(w http.ResponseWriter, r *http.Request, id int64) {
+	branchID, err := h.repo.BranchOf(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_resource_failed")
+		return
+	}
+	if !authorize(w, r, authz.ManageResources, branchID) {
+		return
+	}
+
+	var req ResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(false); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	out, err := h.repo.Update(r.Context(), actorFrom(r, branchID), id, repository.ResourceUpdate{
+		Kind:         req.Kind,
+		Name:         req.Name,
+		IsActive:     req.IsActive,
+		Availability: req.Availability,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.save_resource_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resource": out,
+	})
+}
+
+// validate trims the name and checks the request; branch, kind and name are
+// mandatory on create only.
+func (req *ResourceRequest) validate(create bool) *problem.Problem {
+	var fe fieldErrors
+
+	if create && req.BranchID <= 0 {
+		fe.add("branch_id", problem.FieldRequired)
+	}
+
+	switch {
+	case req.Kind == nil && create:
+		fe.add("kind", problem.FieldRequired)
+	case req.Kind != nil && !req.Kind.Valid():
+		fe.add("kind", problem.FieldInvalid)
+	}
+
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+	}
+	switch {
+	case req.Name == nil && create || req.Name != nil && *req.Name == "":
+		fe.add("name", problem.FieldRequired)
+	case req.Name != nil && utf8.RuneCountInString(*req.Name) > maxResourceNameLen:
+		fe.add("name", problem.FieldTooLong)
+	}
+
+	if req.Availability != nil {
+		type key struct {
+			weekday time.Weekday
+			start   string
+		}
+		seen := make(map[key]bool, len(*req.Availability))
+		for _, a := range *req.Availability {
+			switch {
+			case a.Weekday < time.Sunday || a.Weekday > time.Saturday:
+				fe.add("availability.weekday", problem.FieldOutOfRange)
+			case !validClock(a.StartTime):
+				fe.add("availability.start_time", problem.FieldTimeFormat)
+			case !validClock(a.EndTime):
+				fe.add("availability.end_time", problem.FieldTimeFormat)
+			case a.EndTime <= a.StartTime:
+				fe.add("availability.end_time", problem.FieldTimeOrder)
+			case seen[key{a.Weekday, a.StartTime}]:
+				fe.add("availability.start_time", problem.FieldDuplicate)
+			}
+			seen[key{a.Weekday, a.StartTime}] = true
+		}
+	}
+
+	return fe.problem()
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+const maxServiceNameLen = 100
+
+type ServiceHandler struct {
+	repo     *repository.ServiceRepository
+	branches *repository.BranchRepository
+}
+
+func NewServiceHandler(repo *repository.ServiceRepository, branches *repository.BranchRepository) *ServiceHandler {
+	return &ServiceHandler{repo: repo, branches: branches}
+}
+
+// ServiceRequest is the body of POST /services and PATCH /services/{id}.
+// Omitted fields are left unchanged on PATCH; the branch cannot be changed.
+type ServiceRequest struct {
+	BranchID        int64    `json:"branch_id"` // POST only
+	Name            *string  `json:"name"`
+	DurationMinutes *int     `json:"duration_minutes"`
+	Price           *string  `json:"price"` // decimal string, e.g. "450.00"; defaults to "0" on POST
+	IsActive        *bool    `json:"is_active"`
+	ResourceIDs     *[]int64 `json:"resource_ids"`
+}
+
+// Handle serves /services.
+func (h *ServiceHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// HandleItem serves /services/{id} and /services/{id}/starts.
+func (h *ServiceHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	seg := pathSegments(r, "/services/")
+	if len(seg) < 1 || len(seg) > 2 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	if len(seg) == 2 {
+		if seg[1] != "starts" {
+			problem.Write(w, r, problemNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			problem.Write(w, r, problemMethodNotAllowed)
+			return
+		}
+		h.Starts(w, r, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.Get(w, r, id)
+	case http.MethodPatch:
+		h.Update(w, r, id)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// List serves GET /services?branch_id=, inactive services included.
+func (h *ServiceHandler) List(w http.ResponseWriter, r *http.Request) {
+	branchID, err := strconv.ParseInt(r.URL.Query().Get("branch_id"), 10, 64)
+	if err != nil || branchID <= 0 {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "branch_id", Code: problem.FieldPositiveInt}))
+		return
+	}
+	if !requireScope(w, r, authz.ScopeReadAvailability, branchID) {
+		return
+	}
+
+	items, err := h.repo.List(r.Context(), branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_services_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+func (h *ServiceHandler) Get(w http.ResponseWriter, r *http.Request, id int64) {
+	svc, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_services_failed")
+		return
+	}
+	if !requireScope(w, r, authz.ScopeReadAvailability, svc.BranchID) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"service": svc,
+	})
+}
+
+// Starts serves GET /services/{id}/starts?date=: the start times at which the
+// service fits into the branch's schedule on that date.
+func (h *ServiceHandler) Starts(w http.ResponseWriter, r *http.Request, id int64) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = "today"
+	}
+	if !validDate(date) {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "date", Code: problem.FieldDateFormat}))
+		return
+	}
+
+	branchID, err := h.repo.BranchOf(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_starts_failed")
+		return
+	}
+	if !requireScope(w, r, authz.ScopeReadAvailability, branchID) {
+		return
+	}
+
+	date, err = resolveBranchDate(r.Context(), h.branches, branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_starts_failed")
+		return
+	}
+
+	items, err := h.repo.Starts(r.Context(), id, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_starts_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"date":  date,
+		"items": items,
+		"count": len(items),
+	})
+}
+
+func (h *ServiceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req ServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(true); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !authorize(w, r, authz.ManageServices, req.BranchID) {
+		return
+	}
+
+	svc := model.Service{
+		BranchID:        req.BranchID,
+		Name:            *req.Name,
+		DurationMinutes: *req.DurationMinutes,
+		Price:           "0",
+		IsActive:        true,
+	}
+	if req.Price != nil {
+		svc.Price = *req.Price
+	}
+	if req.IsActive != nil {
+		svc.IsActive = *req.IsActive
+	}
+	if req.ResourceIDs != nil {
+		svc.ResourceIDs = *req.ResourceIDs
+	}
+
+	out, err := h.repo.Create(r.Context(), actorFrom(r, req.BranchID), svc)
+	if err != nil {
+		writeError(w, r, err, "detail.save_service_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"service": out,
+	})
+}
+
+func (h *ServiceHandler) Update(w http.ResponseWriter, r *http.Request, id int64) {
+	branchID, err := h.repo.BranchOf(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_service_failed")
+		return
+	}
+	if !authorize(w, r, authz.ManageServices, branchID) {
+		return
+	}
+
+	var req ServiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	if p := req.validate(false); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	out, err := h.repo.Update(r.Context(), actorFrom(r, branchID), id, repository.ServiceUpdate{
+		Name:            req.Name,
+		DurationMinutes: req.DurationMinutes,
+		Price:           req.Price,
+		IsActive:        req.IsActive,
+		ResourceIDs:     req.ResourceIDs,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.save_service_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"service": out,
+	})
+}
+
+// validate trims the name and checks the request; branch, name and duration
+// are mandatory on create only.
+func (req *ServiceRequest) validate(create bool) *problem.Problem {
+	var fe fieldErrors
+
+	if create && req.BranchID <= 0 {
+		fe.add("branch_id", problem.FieldRequired)
+	}
+
+	if req.Name != nil {
+		*req.Name = strings.TrimSpace(*req.Name)
+	}
+	switch {
+	case req.Name == nil && create || req.Name != nil && *req.Name == "":
+		fe.add("name", problem.FieldRequired)
+	case req.Name != nil && utf8.RuneCountInString(*req.Name) > maxServiceNameLen:
+		fe.add("name", problem.FieldTooLong)
+	}
+
+	switch {
+	case req.DurationMinutes == nil && create:
+		fe.add("duration_minutes", problem.FieldRequired)
+	case req.DurationMinutes != nil && (*req.DurationMinutes < 5 || *req.DurationMinutes > 24*60):
+		fe.add("duration_minutes", problem.FieldOutOfRange)
+	}
+
+	if req.Price != nil && !validPrice(*req.Price) {
+		fe.add("price", problem.FieldInvalid)
+	}
+
+	if req.ResourceIDs != nil {
+		seen := make(map[int64]bool, len(*req.ResourceIDs))
+		for _, id := range *req.ResourceIDs {
+			switch {
+			case id <= 0:
+				fe.add("resource_ids", problem.FieldPositiveInt)
+			case seen[id]:
+				fe.add("resource_ids", problem.FieldDuplicate)
+			}
+			seen[id] = true
+		}
+	}
+
+	return fe.problem()
+}
+
+// validPrice accepts a non-negative decimal with up to 10 integer and 2
+// fractional digits, the range of the price column.
+func validPrice(s string) bool {
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || len(whole) > 10 || hasFrac && (frac == "" || len(frac) > 2) {
+		return false
+	}
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
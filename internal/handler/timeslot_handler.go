@@ -3,61 +3,230 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
-	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
 	"github.com/idlistic/go-backend-api-sample/internal/repository"
 )
 
 type TimeslotHandler struct {
-	repo *repository.TimeslotRepository
+	repo     *repository.TimeslotRepository
+	branches *repository.BranchRepository
+	hub      *availability.Hub
 }
 
-func NewTimeslotHandler(repo *repository.TimeslotRepository) *TimeslotHandler {
-	return &TimeslotHandler{repo: repo}
+func NewTimeslotHandler(repo *repository.TimeslotRepository, branches *repository.BranchRepository, hub *availability.Hub) *TimeslotHandler {
+	return &TimeslotHandler{repo: repo, branches: branches, hub: hub}
 }
 
 func (h *TimeslotHandler) List(w http.ResponseWriter, r *http.Request) {
-	branchIDStr := r.URL.Query().Get("branch_id")
-	date := r.URL.Query().Get("date")
-
-	if branchIDStr == "" || date == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "branch_id and date are required",
-		})
+	branchID, date, p := parseBranchAndDate(r)
+	if p != nil {
+		problem.Write(w, r, p)
 		return
 	}
-
-	branchID, err := strconv.ParseInt(branchIDStr, 10, 64)
-	if err != nil || branchID <= 0 {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "branch_id must be a positive integer",
-		})
+	if !requireScope(w, r, authz.ScopeReadAvailability, branchID) {
 		return
 	}
 
-	// validate date format YYYY-MM-DD
-	if _, err := time.Parse("2006-01-02", date); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]any{
-			"error": "date must be YYYY-MM-DD",
-		})
+	date, err := resolveBranchDate(r.Context(), h.branches, branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timeslots_failed")
 		return
 	}
 
 	items, err := h.repo.ListByBranchAndDate(r.Context(), branchID, date)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]any{
-			"error": "failed to query timeslots",
-		})
+		writeError(w, r, err, "detail.query_timeslots_failed")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{
+		"date":  date,
 		"items": items,
 		"count": len(items),
 	})
 }
 
+// GenerateTimeslotsRequest is the body of POST /timeslots/generate.
+type GenerateTimeslotsRequest struct {
+	BranchID    int64  `json:"branch_id"`
+	From        string `json:"from"` // optional, YYYY-MM-DD or today/tomorrow; defaults to branch-local today
+	Days        int    `json:"days"`
+	SlotMinutes int    `json:"slot_minutes"`
+	Capacity    int    `json:"capacity"`
+}
+
+// Generate creates slots from the branch's operating hours.
+func (h *TimeslotHandler) Generate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	var req GenerateTimeslotsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	var fe fieldErrors
+	if req.BranchID <= 0 {
+		fe.add("branch_id", problem.FieldRequired)
+	}
+	if req.From != "" && !validDate(req.From) {
+		fe.add("from", problem.FieldDateFormat)
+	}
+	if req.Days < 1 || req.Days > 90 {
+		fe.add("days", problem.FieldOutOfRange)
+	}
+	if req.SlotMinutes < 5 || req.SlotMinutes > 24*60 {
+		fe.add("slot_minutes", problem.FieldOutOfRange)
+	}
+	if req.Capacity < 1 {
+		fe.add("capacity", problem.FieldPositiveInt)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !requireScope(w, r, authz.ScopeWriteTimeslots, req.BranchID) || !authorize(w, r, authz.ManageTimeslots, req.BranchID) {
+		return
+	}
+
+	created, err := h.repo.GenerateFromOperatingHours(r.Context(), actorFrom(r, req.BranchID), repository.GenerateRequest{
+		BranchID:    req.BranchID,
+		From:        req.From,
+		Days:        req.Days,
+		SlotMinutes: req.SlotMinutes,
+		Capacity:    req.Capacity,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.generate_timeslots_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"created": created,
+	})
+}
+
+// UpdateTimeslotRequest is the body of PATCH /timeslots/{id}.
+type UpdateTimeslotRequest struct {
+	Capacity *int  `json:"capacity"`
+	IsActive *bool `json:"is_active"`
+}
+
+// SetTimeslotResourcesRequest is the body of PUT /timeslots/{id}/resources.
+type SetTimeslotResourcesRequest struct {
+	ResourceIDs []int64 `json:"resource_ids"` // empty = capacity is set by hand again
+}
+
+// HandleItem serves PATCH /timeslots/{id} and PUT /timeslots/{id}/resources.
+func (h *TimeslotHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	seg := pathSegments(r, "/timeslots/")
+	if len(seg) == 0 || len(seg) > 2 || len(seg) == 2 && seg[1] != "resources" {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+	method := http.MethodPatch
+	if len(seg) == 2 {
+		method = http.MethodPut
+	}
+	if r.Method != method {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	branchID, err := h.repo.BranchOf(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.update_timeslot_failed")
+		return
+	}
+	if !requireScope(w, r, authz.ScopeWriteTimeslots, branchID) || !authorize(w, r, authz.ManageTimeslots, branchID) {
+		return
+	}
+	if len(seg) == 2 {
+		h.SetResources(w, r, id, branchID)
+		return
+	}
+
+	var req UpdateTimeslotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	var fe fieldErrors
+	if req.Capacity == nil && req.IsActive == nil {
+		fe.add("capacity", problem.FieldRequired)
+	}
+	if req.Capacity != nil && *req.Capacity < 1 {
+		fe.add("capacity", problem.FieldPositiveInt)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	ts, err := h.repo.Update(r.Context(), actorFrom(r, branchID), id, repository.TimeslotUpdate{
+		Capacity: req.Capacity,
+		IsActive: req.IsActive,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.update_timeslot_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"timeslot": ts,
+	})
+}
+
+// SetResources replaces the resources serving a timeslot.
+func (h *TimeslotHandler) SetResources(w http.ResponseWriter, r *http.Request, id, branchID int64) {
+	var req SetTimeslotResourcesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	var fe fieldErrors
+	if req.ResourceIDs == nil {
+		fe.add("resource_ids", problem.FieldRequired)
+	}
+	seen := make(map[int64]bool, len(req.ResourceIDs))
+	for _, rid := range req.ResourceIDs {
+		switch {
+		case rid <= 0:
+			fe.add("resource_ids", problem.FieldPositiveInt)
+		case seen[rid]:
+			fe.add("resource_ids", problem.FieldDuplicate)
+		}
+		seen[rid] = true
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	ts, err := h.repo.SetResources(r.Context(), actorFrom(r, branchID), id, req.ResourceIDs)
+	if err != nil {
+		writeError(w, r, err, "detail.update_timeslot_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"timeslot": ts,
+	})
+}
+
 func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+const (
+	maxImportBytes = 5 << 20
+	maxImportRows  = 5000
+
+	importAllOrNothing = "all_or_nothing"
+	importSkipInvalid  = "skip_invalid"
+)
+
+var problemImportRejected = problem.New(http.StatusUnprocessableEntity, problem.CodeImportRejected, "import rejected, no rows were applied")
+
+// importColumns are the CSV header names; all but active are required.
+var importColumns = []string{"branch", "date", "start", "end", "capacity", "active"}
+
+// Import serves POST /timeslots/import: a CSV with the columns above, one
+// slot per row, upserted on (branch, date, start, end). branch is an id or a
+// branch name, active defaults to true.
+//
+// ?dry_run=true validates everything, including against the database, and
+// writes nothing. ?mode=all_or_nothing (default) rejects the whole file with
+// a 422 listing every bad row; ?mode=skip_invalid applies the good rows and
+// reports the rest.
+func (h *TimeslotHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var fe fieldErrors
+	dryRun := false
+	if s := q.Get("dry_run"); s != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(s); err != nil {
+			fe.add("dry_run", problem.FieldInvalid)
+		}
+	}
+	mode := q.Get("mode")
+	switch mode {
+	case "":
+		mode = importAllOrNothing
+	case importAllOrNothing, importSkipInvalid:
+	default:
+		fe.add("mode", problem.FieldInvalid)
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	branches, err := h.branches.List(r.Context(), true)
+	if err != nil {
+		writeError(w, r, err, "detail.import_timeslots_failed")
+		return
+	}
+	principal, _ := auth.FromContext(r.Context())
+	canImport := func(branchID int64) bool {
+		return authz.Allows(principal, authz.ScopeWriteTimeslots, branchID) &&
+			authz.Can(principal, authz.ManageTimeslots, branchID)
+	}
+	// refuse callers who may import into no branch at all before reading the
+	// file; rows for other branches are still refused one by one below
+	byName := make(map[string]int64, len(branches))
+	allowed := false
+	for _, b := range branches {
+		byName[strings.ToLower(b.Name)] = b.ID
+		allowed = allowed || canImport(b.ID)
+	}
+	if !allowed {
+		problem.Write(w, r, problemForbidden)
+		return
+	}
+
+	file, p := parseImport(http.MaxBytesReader(w, r.Body, maxImportBytes), byName, canImport)
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	errs, total := file.errs, file.total
+
+	allOrNothing := mode == importAllOrNothing
+	actorAt := func(branchID int64) model.Actor { return actorFrom(r, branchID) }
+	res, err := h.repo.Import(r.Context(), actorAt, file.rows, repository.ImportOptions{
+		// a file that is already rejected still gets its rows checked
+		// against the database, so the caller sees every problem at once
+		DryRun:       dryRun || (allOrNothing && len(errs) > 0),
+		AllOrNothing: allOrNothing,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.import_timeslots_failed")
+		return
+	}
+	errs = append(errs, res.Errors...)
+	sortImportErrors(errs)
+
+	if allOrNothing && len(errs) > 0 {
+		p := *problemImportRejected
+		p.Errors = importFieldErrors(errs)
+		problem.Write(w, r, &p)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dry_run": dryRun,
+		"mode":    mode,
+		"applied": res.Applied,
+		"rows":    total,
+		"created": res.Created,
+		"updated": res.Updated,
+		"skipped": total - res.Created - res.Updated,
+		"errors":  problem.LocalizeFields(r, importFieldErrors(errs)),
+	})
+}
+
+// importFile is a parsed import: the valid rows, the errors of the others and
+// the number of non-blank rows.
+type importFile struct {
+	rows  []repository.TimeslotImportRow
+	errs  []repository.ImportRowError
+	total int
+}
+
+// parseImport reads the CSV of Import and validates each row on its own.
+// byName maps lower-cased branch names to ids; canImport tells whether the
+// caller may write a branch's timeslots. A problem rejects the whole file.
+func parseImport(body io.Reader, byName map[string]int64, canImport func(int64) bool) (importFile, *problem.Problem) {
+	cr := csv.NewReader(body)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return importFile{}, csvProblem(err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\uFEFF") // spreadsheet BOM
+		}
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var fe fieldErrors
+	for _, name := range importColumns[:5] {
+		if _, ok := cols[name]; !ok {
+			fe.add("columns."+name, problem.FieldRequired)
+		}
+	}
+	if p := fe.problem(); p != nil {
+		return importFile{}, p
+	}
+
+	var (
+		out  importFile
+		seen = make(map[string]bool)
+	)
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return importFile{}, csvProblem(err)
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		if strings.Join(rec, "") == "" {
+			continue // blank spreadsheet row
+		}
+		out.total++
+		if out.total > maxImportRows {
+			return importFile{}, problem.Validation(problem.FieldError{Field: "body", Code: problem.FieldTooLong})
+		}
+
+		row := repository.TimeslotImportRow{Line: line, IsActive: true}
+		bad := func(field, code string) {
+			out.errs = append(out.errs, repository.ImportRowError{Line: line, Field: field, Code: code})
+		}
+		before := len(out.errs)
+
+		switch s := field("branch"); {
+		case s == "":
+			bad("branch", problem.FieldRequired)
+		default:
+			if id, ok := parseID(s); ok {
+				row.BranchID = id
+			} else if id, ok := byName[strings.ToLower(s)]; ok {
+				row.BranchID = id
+			} else {
+				bad("branch", problem.FieldNotFound)
+			}
+		}
+		if row.BranchID != 0 && !canImport(row.BranchID) {
+			bad("branch", problem.FieldForbidden)
+		}
+
+		row.Date = field("date")
+		if _, err := time.Parse("2006-01-02", row.Date); err != nil {
+			bad("date", problem.FieldDateFormat)
+		}
+		row.Start, row.End = field("start"), field("end")
+		startOK, endOK := validClock(row.Start), validClock(row.End)
+		if !startOK {
+			bad("start", problem.FieldTimeFormat)
+		}
+		if !endOK {
+			bad("end", problem.FieldTimeFormat)
+		}
+		if startOK && endOK && row.End <= row.Start {
+			bad("end", problem.FieldTimeOrder)
+		}
+		if n, err := strconv.Atoi(field("capacity")); err != nil || n < 1 {
+			bad("capacity", problem.FieldPositiveInt)
+		} else {
+			row.Capacity = n
+		}
+		if s := field("active"); s != "" {
+			switch strings.ToLower(s) {
+			case "true", "1", "yes", "y":
+			case "false", "0", "no", "n":
+				row.IsActive = false
+			default:
+				bad("active", problem.FieldInvalid)
+			}
+		}
+
+		if len(out.errs) > before {
+			continue
+		}
+		key := fmt.Sprintf("%d|%s|%s|%s", row.BranchID, row.Date, row.Start, row.End)
+		if seen[key] {
+			bad("", problem.FieldDuplicate)
+			continue
+		}
+		seen[key] = true
+		out.rows = append(out.rows, row)
+	}
+	return out, nil
+}
+
+// csvProblem turns a CSV read error into a 400 problem.
+func csvProblem(err error) *problem.Problem {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return problem.Validation(problem.FieldError{Field: "body", Code: problem.FieldTooLong})
+	case errors.Is(err, io.EOF):
+		return problem.Validation(problem.FieldError{Field: "body", Code: problem.FieldRequired})
+	}
+	return problem.Validation(problem.FieldError{Field: "body", Code: problem.FieldInvalid})
+}
+
+// sortImportErrors orders errors by line, keeping the column order within a
+// line.
+func sortImportErrors(errs []repository.ImportRowError) {
+	slices.SortStableFunc(errs, func(a, b repository.ImportRowError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+}
+
+// importFieldErrors names each error "line N: column", or "line N" for
+// errors about the whole row.
+func importFieldErrors(errs []repository.ImportRowError) []problem.FieldError {
+	out := make([]problem.FieldError, 0, len(errs))
+	for _, e := range errs {
+		name := "line " + strconv.Itoa(e.Line)
+		if e.Field != "" {
+			name += ": " + e.Field
+		}
+		fe := problem.FieldError{Field: name, Code: e.Code}
+		if e.Conflict != nil { // a typed nil would not be omitted
+			fe.Conflict = e.Conflict
+		}
+		out = append(out, fe)
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+func TestParseImport(t *testing.T) {
+	const header = "branch,date,start,end,capacity,active\n"
+	byName := map[string]int64{"main": 1, "annex": 2}
+	canImport := func(branchID int64) bool { return branchID != 3 }
+
+	tests := []struct {
+		name        string
+		csv         string
+		wantRows    []string // line branch date start-end capacity active
+		wantErrs    []string // line field code
+		wantTotal   int      // non-blank rows
+		wantProblem string   // field code, when the whole file is rejected
+	}{
+		{
+			name:      "branch by id or name",
+			csv:       header + "1,2026-05-04,09:00,10:00,3,\nMain,2026-05-04,10:00,11:00,2,\n",
+			wantRows:  []string{"2 1 2026-05-04 09:00-10:00 3 true", "3 1 2026-05-04 10:00-11:00 2 true"},
+			wantTotal: 2,
+		},
+		{
+			name:      "BOM and header case",
+			csv:       "\uFEFFBranch, Date ,START,End,Capacity\nannex,2026-05-04,09:00,10:00,1\n",
+			wantRows:  []string{"2 2 2026-05-04 09:00-10:00 1 true"},
+			wantTotal: 1,
+		},
+		{
+			name:      "columns in any order",
+			csv:       "capacity,end,start,date,branch\n4,10:00,09:00,2026-05-04,1\n",
+			wantRows:  []string{"2 1 2026-05-04 09:00-10:00 4 true"},
+			wantTotal: 1,
+		},
+		{
+			name:        "missing required column",
+			csv:         "branch,date,start,end\n1,2026-05-04,09:00,10:00\n",
+			wantProblem: "columns.capacity " + problem.FieldRequired,
+		},
+		{
+			name:        "empty body",
+			csv:         "",
+			wantProblem: "body " + problem.FieldRequired,
+		},
+		{
+			name:      "blank rows keep line numbers",
+			csv:       header + ",,,,,\n\n1,2026-05-04,09:00,10:00,1,\n",
+			wantRows:  []string{"4 1 2026-05-04 09:00-10:00 1 true"},
+			wantTotal: 1,
+		},
+		{
+			name: "active spellings",
+			csv: header +
+				"1,2026-05-04,09:00,10:00,1,yes\n" +
+				"1,2026-05-04,10:00,11:00,1,N\n" +
+				"1,2026-05-04,11:00,12:00,1,0\n" +
+				"1,2026-05-04,12:00,13:00,1,TRUE\n" +
+				"1,2026-05-04,13:00,14:00,1,maybe\n",
+			wantRows: []string{
+				"2 1 2026-05-04 09:00-10:00 1 true",
+				"3 1 2026-05-04 10:00-11:00 1 false",
+				"4 1 2026-05-04 11:00-12:00 1 false",
+				"5 1 2026-05-04 12:00-13:00 1 true",
+			},
+			wantErrs:  []string{"6 active " + problem.FieldInvalid},
+			wantTotal: 5,
+		},
+		{
+			name:      "duplicate row",
+			csv:       header + "1,2026-05-04,09:00,10:00,1,\nmain,2026-05-04,09:00,10:00,5,\n",
+			wantRows:  []string{"2 1 2026-05-04 09:00-10:00 1 true"},
+			wantErrs:  []string{"3  " + problem.FieldDuplicate},
+			wantTotal: 2,
+		},
+		{
+			name: "end not after start",
+			csv:  header + "1,2026-05-04,10:00,10:00,1,\n1,2026-05-04,10:00,09:00,1,\n",
+			wantErrs: []string{
+				"2 end " + problem.FieldTimeOrder,
+				"3 end " + problem.FieldTimeOrder,
+			},
+			wantTotal: 2,
+		},
+		{
+			name: "every bad column of a row",
+			csv:  header + "nowhere,04/05/2026,9:00,25:00,0,\n,2026-05-04,09:00,10:00,x,\n3,2026-05-04,09:00,10:00,1,\n",
+			wantErrs: []string{
+				"2 branch " + problem.FieldNotFound,
+				"2 date " + problem.FieldDateFormat,
+				"2 start " + problem.FieldTimeFormat,
+				"2 end " + problem.FieldTimeFormat,
+				"2 capacity " + problem.FieldPositiveInt,
+				"3 branch " + problem.FieldRequired,
+				"3 capacity " + problem.FieldPositiveInt,
+				"4 branch " + problem.FieldForbidden,
+			},
+			wantTotal: 3,
+		},
+		{
+			name:        "too many rows",
+			csv:         header + strings.Repeat("1,2026-05-04,09:00,10:00,1,\n", maxImportRows+1),
+			wantProblem: "body " + problem.FieldTooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, p := parseImport(strings.NewReader(tt.csv), byName, canImport)
+			if tt.wantProblem != "" {
+				if p == nil || len(p.Errors) != 1 || p.Errors[0].Field+" "+p.Errors[0].Code != tt.wantProblem {
+					t.Fatalf("problem = %+v, want %s", p, tt.wantProblem)
+				}
+				return
+			}
+			if p != nil {
+				t.Fatalf("problem = %+v", p)
+			}
+
+			var rows, errs []string
+			for _, r := range file.rows {
+				rows = append(rows, fmt.Sprintf("%d %d %s %s-%s %d %v", r.Line, r.BranchID, r.Date, r.Start, r.End, r.Capacity, r.IsActive))
+			}
+			for _, e := range file.errs {
+				errs = append(errs, fmt.Sprintf("%d %s %s", e.Line, e.Field, e.Code))
+			}
+			if !slices.Equal(rows, tt.wantRows) || file.total != tt.wantTotal {
+				t.Errorf("rows = %q (%d in total), want %q (%d)", rows, file.total, tt.wantRows, tt.wantTotal)
+			}
+			if !slices.Equal(errs, tt.wantErrs) {
+				t.Errorf("errors = %q, want %q", errs, tt.wantErrs)
+			}
+		})
+	}
+}
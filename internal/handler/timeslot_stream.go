@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+const (
+	// streamRetry is the reconnect delay suggested to EventSource clients.
+	streamRetry = 3 * time.Second
+	// streamHeartbeat keeps idle streams from being cut by proxies.
+	streamHeartbeat = 15 * time.Second
+	// streamReplayWindow widens Last-Event-ID on reconnect: updated_at is the
+	// transaction's start time, so a slot can commit with an older stamp than
+	// one already sent.
+	streamReplayWindow = time.Minute
+)
+
+// Stream serves GET /timeslots/stream?branch_id=&date= as Server-Sent Events.
+// Every event is a full timeslot whose capacity, reserved or is_active
+// changed; the first batch is the current state. Event ids are updated_at
+// stamps, so a client reconnecting with Last-Event-ID only gets slots changed
+// since (give or take streamReplayWindow; events are idempotent snapshots).
+func (h *TimeslotHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+	branchID, date, p := parseBranchAndDate(r)
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !requireScope(w, r, authz.ScopeReadAvailability, branchID) {
+		return
+	}
+
+	ctx := r.Context()
+	// unlike List, the branch must exist before we hold the connection open
+	loc, err := h.branches.Location(ctx, branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timeslots_failed")
+		return
+	}
+	if date, err = model.ResolveDate(loc, time.Now(), date); err != nil {
+		writeError(w, r, err, "detail.query_timeslots_failed")
+		return
+	}
+
+	// subscribe before the first read so no change falls in between
+	sub := h.hub.Subscribe(availability.Change{BranchID: branchID, Date: date})
+	defer sub.Close()
+
+	items, err := h.repo.ListByBranchAndDate(ctx, branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timeslots_failed")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+
+	s := slotStream{sent: make(map[int64]model.Timeslot)}
+	if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && id > 0 {
+		s.lastID = id
+		s.known = id - streamReplayWindow.Microseconds()
+	}
+	if err := s.send(w, items); err != nil || rc.Flush() != nil {
+		return
+	}
+	s.known = 0
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-sub.C:
+			items, err := h.repo.ListByBranchAndDate(ctx, branchID, date)
+			if err != nil {
+				// the client reconnects with Last-Event-ID
+				return
+			}
+			if err := s.send(w, items); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// slotStream remembers what one connection has already been told.
+type slotStream struct {
+	sent   map[int64]model.Timeslot
+	lastID int64
+	// known: slots not updated after this stamp (unix µs) are assumed to be
+	// known to a reconnecting client and are not sent again.
+	known int64
+}
+
+func (s *slotStream) send(w http.ResponseWriter, items []model.Timeslot) error {
+	for _, t := range items {
+		stamp := t.UpdatedAt.UnixMicro()
+		prev, seen := s.sent[t.ID]
+		s.sent[t.ID] = t
+		if seen && prev.Capacity == t.Capacity && prev.Reserved == t.Reserved && prev.IsActive == t.IsActive {
+			continue
+		}
+		if !seen && stamp <= s.known {
+			continue
+		}
+
+		data, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		s.lastID = max(s.lastID, stamp)
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: timeslot\ndata: %s\n\n", s.lastID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+)
+
+type TimetableHandler struct {
+	repo     *repository.TimetableRepository
+	branches *repository.BranchRepository
+	hub      *availability.Hub
+	upgrader websocket.Upgrader
+}
+
+// NewTimetableHandler creates the handler; checkOrigin decides which other
+// browser origins may open timetable sockets (same-origin pages and clients
+// without an Origin header always may).
+func NewTimetableHandler(
+	repo *repository.TimetableRepository,
+	branches *repository.BranchRepository,
+	hub *availability.Hub,
+	checkOrigin func(origin string) bool,
+) *TimetableHandler {
+	return &TimetableHandler{
+		repo:     repo,
+		branches: branches,
+		hub:      hub,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: socketWriteTimeout,
+			Subprotocols:     []string{TimetableSubprotocol},
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" {
+					return true
+				}
+				if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+					return true
+				}
+				return checkOrigin(origin)
+			},
+		},
+	}
+}
+
+// Get serves GET /timetable?branch_id=&date= — every slot of the day with its
+// active orders, for the branch's front desk.
+func (h *TimetableHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	branchID, date, p := parseBranchAndDate(r)
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !authorize(w, r, authz.ViewBranchOrders, branchID) {
+		return
+	}
+
+	date, err := resolveBranchDate(r.Context(), h.branches, branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timetable_failed")
+		return
+	}
+
+	items, err := h.repo.GetOrdersTimetable(r.Context(), branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timetable_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"branch_id": branchID,
+		"date":      date,
+		"count":     len(items),
+		"items":     items,
+	})
+}
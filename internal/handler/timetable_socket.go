@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+// TimetableSubprotocol is the WebSocket subprotocol of GET /timetable/ws.
+const TimetableSubprotocol = "timetable.v1"
+
+const (
+	// socketWriteTimeout bounds every write; a client that cannot take a
+	// message in time is disconnected instead of being buffered for.
+	socketWriteTimeout = 10 * time.Second
+	socketPingInterval = 20 * time.Second
+	// socketPongTimeout drops clients that stopped answering pings.
+	socketPongTimeout = 3 * socketPingInterval
+)
+
+// Timetable change ops.
+const (
+	opSlotAdded    = "slot_added"
+	opSlotChanged  = "slot_changed" // capacity, reserved or is_active
+	opSlotRemoved  = "slot_removed"
+	opOrderAdded   = "order_added"
+	opOrderChanged = "order_changed" // status
+	opOrderRemoved = "order_removed" // cancelled or rescheduled away
+)
+
+// timetableMessage is sent to timetable sockets: one "snapshot" after
+// connecting, then a "diff" whenever the timetable changed.
+type timetableMessage struct {
+	Type     string                `json:"type"`
+	BranchID int64                 `json:"branch_id"`
+	Date     string                `json:"date"`
+	Items    []model.TimetableItem `json:"items,omitempty"`
+	Changes  []timetableChange     `json:"changes,omitempty"`
+}
+
+type timetableChange struct {
+	Op         string                   `json:"op"`
+	TimeslotID int64                    `json:"timeslot_id"`
+	Timeslot   *model.TimetableTimeslot `json:"timeslot,omitempty"`
+	Order      *model.TimetableOrder    `json:"order,omitempty"`
+	OrderID    int64                    `json:"order_id,omitempty"`
+}
+
+// Socket serves GET /timetable/ws?branch_id=&date= — the timetable of Get,
+// kept current over a WebSocket. Clients only receive; slow clients get
+// coalesced diffs and are dropped once a write stalls for socketWriteTimeout.
+func (h *TimetableHandler) Socket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.Write(w, r, problemMethodNotAllowed)
+		return
+	}
+
+	branchID, date, p := parseBranchAndDate(r)
+	if p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+	if !authorize(w, r, authz.ViewBranchOrders, branchID) {
+		return
+	}
+
+	// the branch must exist before we upgrade; errors are still problem responses here
+	loc, err := h.branches.Location(r.Context(), branchID)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timetable_failed")
+		return
+	}
+	if date, err = model.ResolveDate(loc, time.Now(), date); err != nil {
+		writeError(w, r, err, "detail.query_timetable_failed")
+		return
+	}
+
+	sub := h.hub.Subscribe(availability.Change{BranchID: branchID, Date: date})
+	defer sub.Close()
+
+	items, err := h.repo.GetOrdersTimetable(r.Context(), branchID, date)
+	if err != nil {
+		writeError(w, r, err, "detail.query_timetable_failed")
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has answered
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go readSocket(conn, cancel)
+
+	write := func(m timetableMessage) error {
+		m.BranchID, m.Date = branchID, date
+		_ = conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		return conn.WriteJSON(m)
+	}
+	if err := write(timetableMessage{Type: "snapshot", Items: items}); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)); err != nil {
+				return
+			}
+		case <-sub.C:
+			next, err := h.repo.GetOrdersTimetable(ctx, branchID, date)
+			if err != nil {
+				// clients reconnect and start over from a snapshot
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "timetable unavailable"),
+					time.Now().Add(socketWriteTimeout))
+				return
+			}
+			changes := diffTimetable(items, next)
+			items = next
+			if len(changes) == 0 {
+				continue
+			}
+			if err := write(timetableMessage{Type: "diff", Changes: changes}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readSocket handles pongs and the close handshake, and cancels once the
+// client is gone. Clients have nothing to send; messages are discarded.
+func readSocket(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(socketPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongTimeout))
+	})
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// diffTimetable lists what changed from prev to next: slots first, then
+// their orders, in timetable order; removals come last.
+func diffTimetable(prev, next []model.TimetableItem) []timetableChange {
+	before := make(map[int64]model.TimetableItem, len(prev))
+	for _, it := range prev {
+		before[it.Timeslot.ID] = it
+	}
+
+	var changes []timetableChange
+	seen := make(map[int64]bool, len(next))
+	for _, it := range next {
+		slot := it.Timeslot
+		seen[slot.ID] = true
+
+		old, existed := before[slot.ID]
+		switch {
+		case !existed:
+			changes = append(changes, timetableChange{Op: opSlotAdded, TimeslotID: slot.ID, Timeslot: &slot})
+		case old.Timeslot != slot:
+			changes = append(changes, timetableChange{Op: opSlotChanged, TimeslotID: slot.ID, Timeslot: &slot})
+		}
+
+		oldOrders := make(map[int64]model.TimetableOrder, len(old.Orders))
+		for _, o := range old.Orders {
+			oldOrders[o.ID] = o
+		}
+		for _, o := range it.Orders {
+			prevOrder, had := oldOrders[o.ID]
+			delete(oldOrders, o.ID)
+			switch {
+			case !had:
+				changes = append(changes, timetableChange{Op: opOrderAdded, TimeslotID: slot.ID, Order: &o})
+			case prevOrder != o:
+				changes = append(changes, timetableChange{Op: opOrderChanged, TimeslotID: slot.ID, Order: &o})
+			}
+		}
+		for _, o := range old.Orders {
+			if _, gone := oldOrders[o.ID]; gone {
+				changes = append(changes, timetableChange{Op: opOrderRemoved, TimeslotID: slot.ID, OrderID: o.ID})
+			}
+		}
+	}
+	for _, it := range prev {
+		if !seen[it.Timeslot.ID] {
+			changes = append(changes, timetableChange{Op: opSlotRemoved, TimeslotID: it.Timeslot.ID})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/idlistic/go-backend-api-sample/internal/authz"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+	"github.com/idlistic/go-backend-api-sample/internal/repository"
+	"github.com/idlistic/go-backend-api-sample/internal/webhook"
+)
+
+const (
+	maxWebhookURLLen     = 2000
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type WebhookHandler struct {
+	repo *repository.WebhookRepository
+	// development allows http endpoints on loopback and private addresses
+	development bool
+}
+
+func NewWebhookHandler(repo *repository.WebhookRepository, development bool) *WebhookHandler {
+	return &WebhookHandler{repo: repo, development: development}
+}
+
+// WebhookRequest is the body of POST /admin/webhooks and PATCH
+// /admin/webhooks/{id}. Omitted fields are left unchanged on PATCH.
+type WebhookRequest struct {
+	URL        *string   `json:"url"`
+	EventTypes *[]string `json:"event_types"` // empty = every event
+	IsActive   *bool     `json:"is_active"`   // PATCH only
+}
+
+// Handle serves /admin/webhooks. Admins only.
+func (h *WebhookHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, authz.ManageWebhooks, 0) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.List(w, r)
+	case http.MethodPost:
+		h.Create(w, r)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+// HandleItem serves /admin/webhooks/{id}, /deliveries and /replay, and
+// /admin/webhooks/deliveries/{id}/replay. Admins only.
+func (h *WebhookHandler) HandleItem(w http.ResponseWriter, r *http.Request) {
+	if !authorize(w, r, authz.ManageWebhooks, 0) {
+		return
+	}
+
+	seg := pathSegments(r, "/admin/webhooks/")
+	if len(seg) == 3 && seg[0] == "deliveries" && seg[2] == "replay" {
+		id, ok := parseID(seg[1])
+		if !ok {
+			problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+			return
+		}
+		if r.Method != http.MethodPost {
+			problem.Write(w, r, problemMethodNotAllowed)
+			return
+		}
+		h.Replay(w, r, id)
+		return
+	}
+	if len(seg) == 0 || len(seg) > 2 {
+		problem.Write(w, r, problemNotFound)
+		return
+	}
+
+	id, ok := parseID(seg[0])
+	if !ok {
+		problem.Write(w, r, problem.Validation(problem.FieldError{Field: "id", Code: problem.FieldPositiveInt}))
+		return
+	}
+
+	switch {
+	case len(seg) == 1 && r.Method == http.MethodGet:
+		h.Get(w, r, id)
+	case len(seg) == 1 && r.Method == http.MethodPatch:
+		h.Update(w, r, id)
+	case len(seg) == 2 && seg[1] == "deliveries" && r.Method == http.MethodGet:
+		h.Deliveries(w, r, id)
+	case len(seg) == 2 && seg[1] == "replay" && r.Method == http.MethodPost:
+		h.ReplayDead(w, r, id)
+	case len(seg) == 2 && seg[1] != "deliveries" && seg[1] != "replay":
+		problem.Write(w, r, problemNotFound)
+	default:
+		problem.Write(w, r, problemMethodNotAllowed)
+	}
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	items, err := h.repo.List(r.Context())
+	if err != nil {
+		writeError(w, r, err, "detail.query_webhooks_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items":       items,
+		"count":       len(items),
+		"event_types": webhook.EventTypes,
+	})
+}
+
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request, id int64) {
+	ep, err := h.repo.Get(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err, "detail.query_webhooks_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"webhook": ep})
+}
+
+// Create registers an endpoint. The signing "secret" is only ever returned here.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	var fe fieldErrors
+	if req.URL == nil {
+		fe.add("url", problem.FieldRequired)
+	}
+	h.validate(r, &req, &fe)
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	n := repository.NewWebhook{URL: *req.URL}
+	if req.EventTypes != nil {
+		n.EventTypes = *req.EventTypes
+	}
+	ep, secret, err := h.repo.Create(r.Context(), actorFrom(r, 0), n)
+	if err != nil {
+		writeError(w, r, err, "detail.save_webhook_failed")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"webhook": ep,
+		"secret":  secret,
+	})
+}
+
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request, id int64) {
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problemInvalidJSON)
+		return
+	}
+
+	var fe fieldErrors
+	h.validate(r, &req, &fe)
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	ep, err := h.repo.Update(r.Context(), actorFrom(r, 0), id, repository.WebhookUpdate{
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		IsActive:   req.IsActive,
+	})
+	if err != nil {
+		writeError(w, r, err, "detail.save_webhook_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"webhook": ep})
+}
+
+// Deliveries serves GET /admin/webhooks/{id}/deliveries?status=&limit=
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request, id int64) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	limit := defaultDeliveryLimit
+
+	var fe fieldErrors
+	switch model.WebhookDeliveryStatus(status) {
+	case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+	default:
+		fe.add("status", problem.FieldInvalid)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			fe.add("limit", problem.FieldOutOfRange)
+		}
+		limit = n
+	}
+	if p := fe.problem(); p != nil {
+		problem.Write(w, r, p)
+		return
+	}
+
+	items, err := h.repo.Deliveries(r.Context(), id, status, limit)
+	if err != nil {
+		writeError(w, r, err, "detail.query_webhooks_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// ReplayDead queues every dead-lettered delivery of an endpoint again.
+func (h *WebhookHandler) ReplayDead(w http.ResponseWriter, r *http.Request, id int64) {
+	n, err := h.repo.ReplayDead(r.Context(), actorFrom(r, 0), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_webhook_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"replayed": n})
+}
+
+// Replay queues one delivery again, whatever its status.
+func (h *WebhookHandler) Replay(w http.ResponseWriter, r *http.Request, id int64) {
+	d, err := h.repo.Replay(r.Context(), actorFrom(r, 0), id)
+	if err != nil {
+		writeError(w, r, err, "detail.save_webhook_failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"delivery": d})
+}
+
+// validate checks the fields of req that are set. Outside development the
+// URL must be https and resolve to public addresses only.
+func (h *WebhookHandler) validate(r *http.Request, req *WebhookRequest, fe *fieldErrors) {
+	if req.URL != nil {
+		u, err := url.Parse(*req.URL)
+		switch {
+		case len(*req.URL) > maxWebhookURLLen:
+			fe.add("url", problem.FieldTooLong)
+		case err != nil || (u.Scheme != "https" && (u.Scheme != "http" || !h.development)) || u.Hostname() == "" || u.User != nil:
+			fe.add("url", problem.FieldInvalid)
+		case !h.development:
+			if err := webhook.CheckHost(r.Context(), u.Hostname()); errors.Is(err, webhook.ErrForbiddenTarget) {
+				fe.add("url", problem.FieldForbidden)
+			} else if err != nil {
+				fe.add("url", problem.FieldInvalid)
+			}
+		}
+	}
+
+	if req.EventTypes != nil {
+		seen := make(map[string]bool, len(*req.EventTypes))
+		for _, t := range *req.EventTypes {
+			switch {
+			case !webhook.ValidEventType(t):
+				fe.add("event_types", problem.FieldInvalid)
+			case seen[t]:
+				fe.add("event_types", problem.FieldDuplicate)
+			}
+			seen[t] = true
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package i18n
+
+// catalogs holds every user-facing message, keyed by message ID:
+//   - problem.<code>  problem titles (code = problem.Code*)
+//   - field.<code>    validation messages; {field} is the offending field
+//   - detail.<name>   problem details written by handlers
+//
+// Keep the English and Thai tables in the same order so gaps are easy to spot.
+var catalogs = map[Lang]map[string]string{
+	English: {
+		"problem.validation_failed":            "request validation failed",
+		"problem.invalid_json":                 "invalid json body",
+		"problem.not_found":                    "resource not found",
+		"problem.method_not_allowed":           "method not allowed",
+		"problem.internal_error":               "internal server error",
+		"problem.timeslot_not_found":           "timeslot not found",
+		"problem.timeslot_inactive":            "timeslot is inactive",
+		"problem.timeslot_fully_booked":        "timeslot is fully booked",
+		"problem.order_not_found":              "order not found",
+		"problem.order_not_cancellable":        "order is not cancellable",
+		"problem.branch_not_found":             "branch not found",
+		"problem.branch_name_taken":            "branch name already exists",
+		"problem.branch_inactive":              "branch is inactive",
+		"problem.booking_window_closed":        "booking window closed",
+		"problem.booking_too_far_in_advance":   "booking too far in advance",
+		"problem.cancellation_deadline_passed": "cancellation deadline passed",
+		"problem.order_not_reschedulable":      "order is not reschedulable",
+		"problem.reschedule_same_timeslot":     "order is already in this timeslot",
+		"problem.capacity_below_reserved":      "capacity is below reserved seats",
+		"problem.unauthenticated":              "authentication required",
+		"problem.invalid_token":                "invalid bearer token",
+		"problem.token_expired":                "bearer token expired",
+		"problem.order_not_owned":              "order belongs to another customer",
+		"problem.forbidden":                    "you are not allowed to perform this action",
+		"problem.order_not_checkable":          "order cannot be checked in",
+		"problem.invalid_api_key":              "invalid api key",
+		"problem.api_key_quota_exceeded":       "api key daily quota exceeded",
+		"problem.api_key_not_found":            "api key not found",
+		"problem.api_key_revoked":              "api key is revoked or expired",
+		"problem.insufficient_scope":           "api key lacks the required scope for this branch",
+		"problem.rate_limited":                 "too many requests",
+		"problem.tenant_not_found":             "tenant not found",
+		"problem.tenant_mismatch":              "credentials belong to another tenant",
+		"problem.webhook_not_found":            "webhook endpoint not found",
+		"problem.webhook_delivery_not_found":   "webhook delivery not found",
+		"problem.invalid_calendar_token":       "invalid calendar feed token",
+		"problem.import_rejected":              "import rejected, no rows were applied",
+		"problem.booking_blocked":              "too many no-shows or late cancellations to book at this branch",
+		"problem.confirmation_window_closed":   "slot starts too soon to confirm the booking",
+		"problem.order_not_confirmable":        "order cannot be confirmed",
+		"problem.order_not_markable":           "order cannot be marked as no-show",
+		"problem.slot_not_started":             "timeslot has not started yet",
+		"problem.resource_not_found":           "resource not found",
+		"problem.resource_name_taken":          "resource name already exists in this branch",
+		"problem.resource_not_assigned":        "resource does not serve this timeslot",
+		"problem.resource_unavailable":         "resource is not available for this timeslot",
+		"problem.resource_in_use":              "resource holds bookings in this timeslot",
+		"problem.capacity_set_by_resources":    "capacity is set by the timeslot's resources",
+		"problem.service_not_found":            "service not found",
+		"problem.service_name_taken":           "service name already exists in this branch",
+		"problem.service_inactive":             "service is inactive",
+		"problem.service_does_not_fit":         "service does not fit the consecutive timeslots",
+		"problem.timeslot_overlap":             "timeslot overlaps another timeslot of the branch",
+
+		"field.required":         "{field} is required",
+		"field.invalid":          "{field} is invalid",
+		"field.positive_integer": "{field} must be a positive integer",
+		"field.date_format":      "{field} must be YYYY-MM-DD, today, tomorrow or yesterday",
+		"field.time_format":      "{field} must be HH:MM",
+		"field.time_order":       "{field} must be after the start time",
+		"field.timezone":         "{field} must be an IANA time zone such as Asia/Bangkok",
+		"field.out_of_range":     "{field} is out of range",
+		"field.duplicate":        "{field} contains duplicates",
+		"field.too_long":         "{field} is too long",
+		"field.timestamp_format": "{field} must be an RFC 3339 timestamp",
+		"field.not_found":        "{field} does not exist",
+		"field.forbidden":        "{field} may not be changed by you",
+		"field.inactive":         "{field} is inactive",
+		"field.below_reserved":   "{field} is below the seats already reserved",
+		"field.nonexistent_time": "{field} does not exist in the branch time zone (daylight saving gap)",
+		"field.set_by_resources": "{field} is set by the resources serving the timeslot",
+		"field.overlaps":         "{field} overlaps another timeslot of the branch",
+
+		"detail.query_branches_failed":      "failed to query branches",
+		"detail.query_timeslots_failed":     "failed to query timeslots",
+		"detail.query_orders_failed":        "failed to query orders",
+		"detail.create_order_failed":        "failed to create order",
+		"detail.cancel_order_failed":        "failed to cancel order",
+		"detail.save_branch_failed":         "failed to save branch",
+		"detail.generate_timeslots_failed":  "failed to generate timeslots",
+		"detail.reschedule_order_failed":    "failed to reschedule order",
+		"detail.query_order_history_failed": "failed to query order history",
+		"detail.update_timeslot_failed":     "failed to update timeslot",
+		"detail.query_audit_failed":         "failed to query audit log",
+		"detail.check_in_order_failed":      "failed to check in order",
+		"detail.query_timetable_failed":     "failed to query timetable",
+		"detail.query_api_keys_failed":      "failed to query api keys",
+		"detail.save_api_key_failed":        "failed to save api key",
+		"detail.query_webhooks_failed":      "failed to query webhooks",
+		"detail.save_webhook_failed":        "failed to save webhook",
+		"detail.query_calendar_failed":      "failed to build the calendar",
+		"detail.save_calendar_token_failed": "failed to save the calendar feed token",
+		"detail.export_failed":              "failed to export",
+		"detail.import_timeslots_failed":    "failed to import timeslots",
+		"detail.query_reports_failed":       "failed to build the report",
+		"detail.confirm_order_failed":       "failed to confirm order",
+		"detail.mark_no_show_failed":        "failed to mark order as no-show",
+		"detail.query_reliability_failed":   "failed to query customer reliability",
+		"detail.query_resources_failed":     "failed to query resources",
+		"detail.save_resource_failed":       "failed to save resource",
+		"detail.query_services_failed":      "failed to query services",
+		"detail.save_service_failed":        "failed to save service",
+		"detail.query_starts_failed":        "failed to search service start times",
+	},
+	Thai: {
+		"problem.validation_failed":            "ข้อมูลที่ส่งมาไม่ถูกต้อง",
+		"problem.invalid_json":                 "รูปแบบ JSON ไม่ถูกต้อง",
+		"problem.not_found":                    "ไม่พบข้อมูลที่ร้องขอ",
+		"problem.method_not_allowed":           "ไม่รองรับเมธอดนี้",
+		"problem.internal_error":               "เกิดข้อผิดพลาดภายในระบบ",
+		"problem.timeslot_not_found":           "ไม่พบช่วงเวลาที่เลือก",
+		"problem.timeslot_inactive":            "ช่วงเวลานี้ปิดให้บริการ",
+		"problem.timeslot_fully_booked":        "ช่วงเวลานี้ถูกจองเต็มแล้ว",
+		"problem.order_not_found":              "ไม่พบรายการจอง",
+		"problem.order_not_cancellable":        "ไม่สามารถยกเลิกรายการจองนี้ได้",
+		"problem.branch_not_found":             "ไม่พบสาขา",
+		"problem.branch_name_taken":            "ชื่อสาขานี้มีอยู่แล้ว",
+		"problem.branch_inactive":              "สาขานี้ปิดให้บริการ",
+		"problem.booking_window_closed":        "ปิดรับจองช่วงเวลานี้แล้ว",
+		"problem.booking_too_far_in_advance":   "ยังไม่เปิดให้จองล่วงหน้าถึงวันดังกล่าว",
+		"problem.cancellation_deadline_passed": "เลยกำหนดเวลาที่ยกเลิกได้แล้ว",
+		"problem.order_not_reschedulable":      "ไม่สามารถเลื่อนรายการจองนี้ได้",
+		"problem.reschedule_same_timeslot":     "รายการจองอยู่ในช่วงเวลานี้อยู่แล้ว",
+		"problem.capacity_below_reserved":      "จำนวนที่นั่งน้อยกว่าจำนวนที่จองไว้แล้ว",
+		"problem.unauthenticated":              "กรุณาเข้าสู่ระบบ",
+		"problem.invalid_token":                "โทเค็นไม่ถูกต้อง",
+		"problem.token_expired":                "โทเค็นหมดอายุแล้ว",
+		"problem.order_not_owned":              "รายการจองนี้เป็นของลูกค้าท่านอื่น",
+		"problem.forbidden":                    "คุณไม่มีสิทธิ์ดำเนินการนี้",
+		"problem.order_not_checkable":          "ไม่สามารถเช็กอินรายการจองนี้ได้",
+		"problem.invalid_api_key":              "API key ไม่ถูกต้อง",
+		"problem.api_key_quota_exceeded":       "API key ใช้งานเกินโควตารายวันแล้ว",
+		"problem.api_key_not_found":            "ไม่พบ API key",
+		"problem.api_key_revoked":              "API key ถูกเพิกถอนหรือหมดอายุแล้ว",
+		"problem.insufficient_scope":           "API key ไม่มีสิทธิ์สำหรับการดำเนินการนี้ในสาขานี้",
+		"problem.rate_limited":                 "มีคำขอมากเกินไป กรุณาลองใหม่ภายหลัง",
+		"problem.tenant_not_found":             "ไม่พบผู้ให้บริการ",
+		"problem.tenant_mismatch":              "ข้อมูลยืนยันตัวตนเป็นของผู้ให้บริการรายอื่น",
+		"problem.webhook_not_found":            "ไม่พบ webhook endpoint",
+		"problem.webhook_delivery_not_found":   "ไม่พบรายการส่ง webhook",
+		"problem.invalid_calendar_token":       "โทเค็นปฏิทินไม่ถูกต้อง",
+		"problem.import_rejected":              "นำเข้าไม่สำเร็จ ไม่มีแถวใดถูกบันทึก",
+		"problem.booking_blocked":              "ไม่สามารถจองที่สาขานี้ได้ เนื่องจากไม่มาตามนัดหรือยกเลิกกระชั้นชิดหลายครั้ง",
+		"problem.confirmation_window_closed":   "ช่วงเวลานี้ใกล้เกินกว่าจะยืนยันการจองได้ทัน",
+		"problem.order_not_confirmable":        "ไม่สามารถยืนยันรายการจองนี้ได้",
+		"problem.order_not_markable":           "ไม่สามารถบันทึกว่าไม่มาตามนัดได้",
+		"problem.slot_not_started":             "ช่วงเวลานี้ยังไม่เริ่ม",
+		"problem.resource_not_found":           "ไม่พบทรัพยากร",
+		"problem.resource_name_taken":          "ชื่อทรัพยากรนี้มีอยู่แล้วในสาขานี้",
+		"problem.resource_not_assigned":        "ทรัพยากรนี้ไม่ได้ให้บริการในช่วงเวลานี้",
+		"problem.resource_unavailable":         "ทรัพยากรนี้ไม่ว่างในช่วงเวลานี้",
+		"problem.resource_in_use":              "ทรัพยากรนี้มีรายการจองในช่วงเวลานี้",
+		"problem.capacity_set_by_resources":    "จำนวนที่นั่งของช่วงเวลานี้กำหนดจากทรัพยากรที่ให้บริการ",
+		"problem.service_not_found":            "ไม่พบบริการ",
+		"problem.service_name_taken":           "ชื่อบริการนี้มีอยู่แล้วในสาขานี้",
+		"problem.service_inactive":             "บริการนี้ปิดใช้งานอยู่",
+		"problem.service_does_not_fit":         "ช่วงเวลาต่อเนื่องไม่พอสำหรับระยะเวลาของบริการนี้",
+		"problem.timeslot_overlap":             "ช่วงเวลานี้ทับซ้อนกับช่วงเวลาอื่นของสาขา",
+
+		"field.required":         "กรุณาระบุ {field}",
+		"field.invalid":          "{field} ไม่ถูกต้อง",
+		"field.positive_integer": "{field} ต้องเป็นจำนวนเต็มบวก",
+		"field.date_format":      "{field} ต้องอยู่ในรูปแบบ YYYY-MM-DD หรือ today, tomorrow, yesterday",
+		"field.time_format":      "{field} ต้องอยู่ในรูปแบบ HH:MM",
+		"field.time_order":       "{field} ต้องอยู่หลังเวลาเริ่มต้น",
+		"field.timezone":         "{field} ต้องเป็นเขตเวลา IANA เช่น Asia/Bangkok",
+		"field.out_of_range":     "{field} อยู่นอกช่วงที่อนุญาต",
+		"field.duplicate":        "{field} มีค่าซ้ำกัน",
+		"field.too_long":         "{field} ยาวเกินไป",
+		"field.timestamp_format": "{field} ต้องอยู่ในรูปแบบเวลา RFC 3339",
+		"field.not_found":        "ไม่พบ {field}",
+		"field.forbidden":        "คุณไม่มีสิทธิ์แก้ไข {field}",
+		"field.inactive":         "{field} ถูกปิดใช้งาน",
+		"field.below_reserved":   "{field} น้อยกว่าจำนวนที่นั่งที่จองไปแล้ว",
+		"field.nonexistent_time": "{field} ไม่มีอยู่จริงในเขตเวลาของสาขา (ช่วงเปลี่ยนเวลาออมแสง)",
+		"field.set_by_resources": "{field} กำหนดจากทรัพยากรที่ให้บริการในช่วงเวลานี้",
+		"field.overlaps":         "{field} ทับซ้อนกับช่วงเวลาอื่นของสาขา",
+
+		"detail.query_branches_failed":      "ไม่สามารถดึงข้อมูลสาขาได้",
+		"detail.query_timeslots_failed":     "ไม่สามารถดึงข้อมูลช่วงเวลาได้",
+		"detail.query_orders_failed":        "ไม่สามารถดึงข้อมูลรายการจองได้",
+		"detail.create_order_failed":        "ไม่สามารถสร้างรายการจองได้",
+		"detail.cancel_order_failed":        "ไม่สามารถยกเลิกรายการจองได้",
+		"detail.save_branch_failed":         "ไม่สามารถบันทึกข้อมูลสาขาได้",
+		"detail.generate_timeslots_failed":  "ไม่สามารถสร้างช่วงเวลาได้",
+		"detail.reschedule_order_failed":    "ไม่สามารถเลื่อนรายการจองได้",
+		"detail.query_order_history_failed": "ไม่สามารถดึงประวัติรายการจองได้",
+		"detail.update_timeslot_failed":     "ไม่สามารถแก้ไขช่วงเวลาได้",
+		"detail.query_audit_failed":         "ไม่สามารถดึงบันทึกการเปลี่ยนแปลงได้",
+		"detail.check_in_order_failed":      "ไม่สามารถเช็กอินรายการจองได้",
+		"detail.query_timetable_failed":     "ไม่สามารถดึงตารางเวลาได้",
+		"detail.query_api_keys_failed":      "ไม่สามารถดึงข้อมูล API key ได้",
+		"detail.save_api_key_failed":        "ไม่สามารถบันทึก API key ได้",
+		"detail.query_webhooks_failed":      "ไม่สามารถดึงข้อมูล webhook ได้",
+		"detail.save_webhook_failed":        "ไม่สามารถบันทึก webhook ได้",
+		"detail.query_calendar_failed":      "สร้างปฏิทินไม่สำเร็จ",
+		"detail.save_calendar_token_failed": "บันทึกโทเค็นปฏิทินไม่สำเร็จ",
+		"detail.export_failed":              "ส่งออกข้อมูลไม่สำเร็จ",
+		"detail.import_timeslots_failed":    "นำเข้าช่วงเวลาไม่สำเร็จ",
+		"detail.query_reports_failed":       "สร้างรายงานไม่สำเร็จ",
+		"detail.confirm_order_failed":       "ไม่สามารถยืนยันรายการจองได้",
+		"detail.mark_no_show_failed":        "ไม่สามารถบันทึกการไม่มาตามนัดได้",
+		"detail.query_reliability_failed":   "ไม่สามารถดึงประวัติการจองของลูกค้าได้",
+		"detail.query_resources_failed":     "ไม่สามารถดึงข้อมูลทรัพยากรได้",
+		"detail.save_resource_failed":       "ไม่สามารถบันทึกทรัพยากรได้",
+		"detail.query_services_failed":      "ไม่สามารถดึงข้อมูลบริการได้",
+		"detail.save_service_failed":        "ไม่สามารถบันทึกบริการได้",
+		"detail.query_starts_failed":        "ไม่สามารถค้นหาเวลาเริ่มของบริการได้",
+	},
+}
@@ -0,0 +1,107 @@
+package i18n
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lang is a supported response language (BCP 47 primary tag).
+type Lang string
+
+const (
+	English Lang = "en"
+	Thai    Lang = "th"
+)
+
+// Default is used when the client expresses no supported preference.
+const Default = English
+
+var supported = map[string]Lang{
+	"en": English,
+	"th": Thai,
+}
+
+// Negotiate picks the best supported language from an Accept-Language header.
+// Region subtags are ignored (th-TH -> th); q=0 entries are never chosen.
+func Negotiate(acceptLanguage string) Lang {
+	type candidate struct {
+		lang Lang
+		q    float64
+		pos  int
+	}
+
+	var cands []candidate
+	for i, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if q <= 0 {
+			continue
+		}
+
+		if tag == "*" {
+			cands = append(cands, candidate{Default, q, i})
+			continue
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		if l, ok := supported[primary]; ok {
+			cands = append(cands, candidate{l, q, i})
+		}
+	}
+	if len(cands) == 0 {
+		return Default
+	}
+
+	sort.SliceStable(cands, func(a, b int) bool {
+		if cands[a].q != cands[b].q {
+			return cands[a].q > cands[b].q
+		}
+		return cands[a].pos < cands[b].pos
+	})
+	return cands[0].lang
+}
+
+// FromRequest negotiates the language of r.
+func FromRequest(r *http.Request) Lang {
+	return Negotiate(r.Header.Get("Accept-Language"))
+}
+
+// T translates a message ID, substituting {name} placeholders from vars
+// (given as name, value pairs). Unknown IDs fall back to English, then to the
+// ID itself so a missing translation never hides the message.
+func T(lang Lang, id string, vars ...string) string {
+	msg, ok := catalogs[lang][id]
+	if !ok {
+		msg, ok = catalogs[English][id]
+	}
+	if !ok {
+		msg = id
+	}
+	if len(vars) >= 2 {
+		pairs := make([]string, 0, len(vars))
+		for i := 0; i+1 < len(vars); i += 2 {
+			pairs = append(pairs, "{"+vars[i]+"}", vars[i+1])
+		}
+		msg = strings.NewReplacer(pairs...).Replace(msg)
+	}
+	return msg
+}
+
+// Has reports whether id exists in the English catalog.
+func Has(id string) bool {
+	_, ok := catalogs[English][id]
+	return ok
+}
@@ -0,0 +1,156 @@
+// Package ical writes iCalendar (RFC 5545) calendars of booking events.
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of an encoded calendar.
+const ContentType = "text/calendar; charset=utf-8"
+
+const prodID = "-//idlistic//go-backend-api-sample//EN"
+
+// Event statuses.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+// Event is one VEVENT. Start and End are written as wall clock times of the
+// calendar's time zone.
+type Event struct {
+	UID string
+	// Sequence counts significant revisions; clients replace their copy of
+	// the event only when it increases.
+	Sequence     int
+	Created      time.Time
+	LastModified time.Time
+	Start, End   time.Time
+	Summary      string
+	Location     string
+	Description  string
+	Status       string
+}
+
+// Calendar is a VCALENDAR whose events share one time zone.
+type Calendar struct {
+	Name     string // X-WR-CALNAME, shown by subscribing clients
+	Location *time.Location
+	Events   []Event
+}
+
+// Encode writes c to w; stamp is the DTSTAMP of every event.
+func Encode(w io.Writer, c Calendar, stamp time.Time) error {
+	e := &encoder{w: w}
+	e.line("BEGIN:VCALENDAR")
+	e.line("VERSION:2.0")
+	e.line("PRODID:" + prodID)
+	e.line("CALSCALE:GREGORIAN")
+	e.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		e.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if loc != time.UTC && len(c.Events) > 0 {
+		e.line("X-WR-TIMEZONE:" + loc.String())
+		from, to := c.Events[0].Start, c.Events[0].End
+		for _, ev := range c.Events {
+			if ev.Start.Before(from) {
+				from = ev.Start
+			}
+			if ev.End.After(to) {
+				to = ev.End
+			}
+		}
+		writeTimezone(e, loc, from, to)
+	}
+
+	for _, ev := range c.Events {
+		e.line("BEGIN:VEVENT")
+		e.line("UID:" + escape(ev.UID))
+		e.line("DTSTAMP:" + utcStamp(stamp))
+		if !ev.Created.IsZero() {
+			e.line("CREATED:" + utcStamp(ev.Created))
+		}
+		if !ev.LastModified.IsZero() {
+			e.line("LAST-MODIFIED:" + utcStamp(ev.LastModified))
+		}
+		e.line("SEQUENCE:" + fmt.Sprint(ev.Sequence))
+		e.line(dateTime("DTSTART", ev.Start, loc))
+		e.line(dateTime("DTEND", ev.End, loc))
+		e.line("SUMMARY:" + escape(ev.Summary))
+		if ev.Location != "" {
+			e.line("LOCATION:" + escape(ev.Location))
+		}
+		if ev.Description != "" {
+			e.line("DESCRIPTION:" + escape(ev.Description))
+		}
+		if ev.Status != "" {
+			e.line("STATUS:" + ev.Status)
+		}
+		e.line("END:VEVENT")
+	}
+	e.line("END:VCALENDAR")
+	return e.err
+}
+
+func utcStamp(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// dateTime formats a DATE-TIME property in loc, or in UTC form for UTC.
+func dateTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + utcStamp(t)
+	}
+	return name + ";TZID=" + loc.String() + ":" + t.In(loc).Format("20060102T150405")
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// encoder writes CRLF-terminated content lines folded at 75 octets.
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *encoder) line(s string) {
+	if e.err != nil {
+		return
+	}
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		// never split a UTF-8 sequence
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, e.err = io.WriteString(e.w, b.String())
+}
@@ -0,0 +1,74 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Haircut", "Haircut"},
+		{`C:\path`, `C:\\path`},
+		{"a;b,c", `a\;b\,c`},
+		{"line 1\nline 2", `line 1\nline 2`},
+		{"line 1\r\nline 2", `line 1\nline 2`},
+		{"stray\rreturn", "strayreturn"},
+		{`\n is not a newline`, `\\n is not a newline`},
+	}
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		lines int
+	}{
+		{"short", "SUMMARY:Haircut", 1},
+		{"exactly 75 octets", strings.Repeat("a", 75), 1},
+		{"76 octets", strings.Repeat("a", 76), 2},
+		{"continuations hold 74 octets", strings.Repeat("a", 75+74+1), 3},
+		{"multi-byte rune at the fold", strings.Repeat("a", 74) + "é" + strings.Repeat("b", 10), 2},
+		{"four-byte runes", strings.Repeat("😀", 40), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			e := &encoder{w: &b}
+			e.line(tt.in)
+			if e.err != nil {
+				t.Fatal(e.err)
+			}
+
+			out, ok := strings.CutSuffix(b.String(), "\r\n")
+			if !ok {
+				t.Fatalf("%q does not end in CRLF", b.String())
+			}
+			lines := strings.Split(out, "\r\n")
+			if len(lines) != tt.lines {
+				t.Errorf("%d lines, want %d: %q", len(lines), tt.lines, lines)
+			}
+			for i, l := range lines {
+				if len(l) > 75 {
+					t.Errorf("line %d has %d octets", i, len(l))
+				}
+				if i > 0 && !strings.HasPrefix(l, " ") {
+					t.Errorf("continuation line %d does not start with a space", i)
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a UTF-8 sequence: %q", i, l)
+				}
+			}
+			if got := strings.ReplaceAll(out, "\r\n ", ""); got != tt.in {
+				t.Errorf("unfolded = %q, want %q", got, tt.in)
+			}
+		})
+	}
+}
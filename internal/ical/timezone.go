@@ -0,0 +1,73 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+// writeTimezone writes a VTIMEZONE for loc from Go's zone data, listing every
+// offset change from a year before from to a year after to. Explicit
+// observances (no RRULE) stay correct when a zone's rules change.
+func writeTimezone(e *encoder, loc *time.Location, from, to time.Time) {
+	start := from.AddDate(-1, 0, 0).In(loc)
+	end := to.AddDate(1, 0, 0)
+
+	e.line("BEGIN:VTIMEZONE")
+	e.line("TZID:" + loc.String())
+
+	_, offset := start.Zone()
+	observance(e, start, offset, offset)
+	for t := start; t.Before(end); {
+		next := nextTransition(t, end)
+		if next.IsZero() {
+			break
+		}
+		_, before := next.Add(-time.Second).Zone()
+		_, after := next.Zone()
+		observance(e, next, before, after)
+		t = next
+	}
+	e.line("END:VTIMEZONE")
+}
+
+// observance writes a STANDARD or DAYLIGHT block starting at onset. DTSTART
+// is the wall clock time of the onset under the offset in force before it.
+func observance(e *encoder, onset time.Time, from, to int) {
+	kind := "STANDARD"
+	if onset.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	name, _ := onset.Zone()
+
+	e.line("BEGIN:" + kind)
+	e.line("DTSTART:" + onset.UTC().Add(time.Duration(from)*time.Second).Format("20060102T150405"))
+	e.line("TZOFFSETFROM:" + utcOffset(from))
+	e.line("TZOFFSETTO:" + utcOffset(to))
+	if name != "" && name[0] != '+' && name[0] != '-' {
+		e.line("TZNAME:" + name)
+	}
+	e.line("END:" + kind)
+}
+
+// nextTransition returns the first instant after t, before end, at which the
+// zone offset or abbreviation changes; zero if there is none.
+func nextTransition(t, end time.Time) time.Time {
+	_, tEnd := t.ZoneBounds()
+	if tEnd.IsZero() || !tEnd.Before(end) {
+		return time.Time{}
+	}
+	return tEnd
+}
+
+// utcOffset formats seconds east of UTC as +HHMM[SS].
+func utcOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign, seconds = '-', -seconds
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
@@ -0,0 +1,16 @@
+package model
+
+// ActorType tells who performed an action; policies differ per type.
+type ActorType string
+
+const (
+	ActorCustomer ActorType = "customer"
+	ActorStaff    ActorType = "staff"
+	ActorSystem   ActorType = "system"
+)
+
+// Actor identifies who performed an action.
+type Actor struct {
+	Type ActorType `json:"type"`
+	ID   string    `json:"id,omitempty"`
+}
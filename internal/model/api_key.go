@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// APIKey is a partner credential. The secret itself is never stored or returned
+// after issue; Prefix identifies the key in logs and listings.
+type APIKey struct {
+	ID          int64      `json:"id"`
+	TenantID    int64      `json:"tenant_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Subject     string     `json:"subject"` // stable across rotations
+	Scopes      []string   `json:"scopes"`
+	BranchIDs   []int64    `json:"branch_ids"` // empty = every branch
+	DailyQuota  *int       `json:"daily_quota"`
+	RotatedFrom *int64     `json:"rotated_from"`
+	CreatedBy   *string    `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+// Active reports whether the key can authenticate at now.
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// APIKeyUsage is the request count of one key on one UTC day.
+type APIKeyUsage struct {
+	Day      string `json:"day"` // YYYY-MM-DD
+	Requests int64  `json:"requests"`
+}
@@ -3,7 +3,119 @@ package model
 import "time"
 
 type Branch struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                int64             `json:"id"`
+	Name              string            `json:"name"`
+	Timezone          string            `json:"timezone"` // IANA, e.g. Asia/Bangkok
+	Address           string            `json:"address"`
+	Phone             string            `json:"phone"`
+	IsActive          bool              `json:"is_active"`
+	OperatingHours    []OperatingHours  `json:"operating_hours"`
+	BookingPolicy     BookingPolicy     `json:"booking_policy"`
+	CancelPolicy      CancelPolicy      `json:"cancellation_policy"`
+	ReliabilityPolicy ReliabilityPolicy `json:"reliability_policy"`
+	NoOverlap         bool              `json:"no_overlap"` // slots of the branch may not overlap
+	ArchivedAt        *time.Time        `json:"archived_at,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+}
+
+// OperatingHours is the opening interval of a branch on one weekday, in branch-local time.
+type OperatingHours struct {
+	Weekday   time.Weekday `json:"weekday"`    // 0 = Sunday
+	OpenTime  string       `json:"open_time"`  // HH:MM
+	CloseTime string       `json:"close_time"` // HH:MM
+}
+
+// BookingPolicy limits how close to (and how far ahead of) a slot's start it can be booked.
+type BookingPolicy struct {
+	MinLeadMinutes int `json:"min_lead_minutes"` // 0 = bookable until the slot starts
+	MaxAdvanceDays int `json:"max_advance_days"` // in branch-local calendar days
+}
+
+// CancelPolicy sets, per actor type, how many minutes before the slot starts
+// an order can still be cancelled. 0 means until the slot starts.
+type CancelPolicy struct {
+	CustomerDeadlineMinutes int `json:"customer_deadline_minutes"`
+	StaffDeadlineMinutes    int `json:"staff_deadline_minutes"`
+}
+
+// ReliabilityPolicy decides how customers with a record of no-shows and late
+// cancellations may book. Incidents are counted over the customer's orders in
+// every branch of the tenant, for slots of the last WindowDays days.
+type ReliabilityPolicy struct {
+	WindowDays int `json:"window_days"`
+	// LateCancelMinutes: customer cancellations closer than this to the slot
+	// start count as incidents.
+	LateCancelMinutes int `json:"late_cancel_minutes"`
+	// ConfirmThreshold: from this many incidents on, bookings are created
+	// unconfirmed and must be confirmed ConfirmDeadlineMinutes before the
+	// start, or they are released. nil = never.
+	ConfirmThreshold       *int `json:"confirm_threshold"`
+	ConfirmDeadlineMinutes int  `json:"confirm_deadline_minutes"`
+	// BlockThreshold: from this many incidents on, bookings are refused.
+	// nil = never.
+	BlockThreshold *int `json:"block_threshold"`
+}
+
+// Standing is what a reliability policy makes of a customer's record.
+type Standing string
+
+const (
+	StandingGood         Standing = "good"
+	StandingNeedsConfirm Standing = "confirmation_required"
+	StandingBlocked      Standing = "blocked"
+)
+
+// StandingFor applies the thresholds to a number of incidents.
+func (p ReliabilityPolicy) StandingFor(incidents int) Standing {
+	switch {
+	case p.BlockThreshold != nil && incidents >= *p.BlockThreshold:
+		return StandingBlocked
+	case p.ConfirmThreshold != nil && incidents >= *p.ConfirmThreshold:
+		return StandingNeedsConfirm
+	}
+	return StandingGood
+}
+
+// Enforced reports whether the policy can affect bookings at all.
+func (p ReliabilityPolicy) Enforced() bool {
+	return p.BlockThreshold != nil || p.ConfirmThreshold != nil
+}
+
+// Reliability is a customer's record under a branch's policy.
+type Reliability struct {
+	CustomerID  string   `json:"customer_id"`
+	WindowDays  int      `json:"window_days"`
+	Orders      int      `json:"orders"` // orders for slots in the window, any status
+	NoShows     int      `json:"no_shows"`
+	LateCancels int      `json:"late_cancels"`
+	Incidents   int      `json:"incidents"`
+	Standing    Standing `json:"standing"`
+}
+
+// DeadlineFor returns the deadline that applies to an actor type; system
+// actions (e.g. branch closure jobs) are not restricted.
+func (p CancelPolicy) DeadlineFor(t ActorType) (minutes int, restricted bool) {
+	switch t {
+	case ActorCustomer:
+		return p.CustomerDeadlineMinutes, true
+	case ActorStaff:
+		return p.StaffDeadlineMinutes, true
+	}
+	return 0, false
+}
+
+// Location loads the branch time zone; an empty zone means UTC.
+func (b Branch) Location() (*time.Location, error) {
+	return time.LoadLocation(b.Timezone)
+}
+
+// HoursOn returns the opening interval for a weekday, if the branch opens that day.
+func (b Branch) HoursOn(d time.Weekday) (OperatingHours, bool) {
+	for _, h := range b.OperatingHours {
+		if h.Weekday == d {
+			return h, true
+		}
+	}
+	return OperatingHours{}, false
 }
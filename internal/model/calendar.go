@@ -0,0 +1,12 @@
+package model
+
+// OrderCalendarEntry is an order with what its calendar event shows.
+type OrderCalendarEntry struct {
+	Order         Order
+	BranchName    string
+	BranchAddress string
+	Timezone      string
+	// Sequence counts the reschedules, confirmations and cancellations of the order, so
+	// calendar clients pick up each of them.
+	Sequence int
+}
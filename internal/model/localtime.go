@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// LocalInstant resolves a branch-local wall clock (date YYYY-MM-DD, clock
+// HH:MM[:SS]) to an instant in loc.
+//
+// DST is handled like RFC 5545: an ambiguous clock (fall back) resolves to
+// its first occurrence, and a clock inside a spring-forward gap is shifted by
+// the gap length (02:30 in a 02:00->03:00 gap becomes 03:30). exists is false
+// in the latter case.
+func LocalInstant(loc *time.Location, date, clock string) (t time.Time, exists bool, err error) {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	c, err := parseClock(clock)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	// the wall clock read as if it were UTC; real instants are this minus an offset
+	naive := time.Date(d.Year(), d.Month(), d.Day(), c.Hour(), c.Minute(), c.Second(), 0, time.UTC)
+
+	_, before := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := naive.Add(24 * time.Hour).In(loc).Zone()
+
+	for _, off := range []int{before, after} {
+		cand := naive.Add(-time.Duration(off) * time.Second).In(loc)
+		if sameWallClock(cand, naive) {
+			return cand, true, nil
+		}
+	}
+
+	// gap: interpret with the offset in effect before the transition
+	return naive.Add(-time.Duration(before) * time.Second).In(loc), false, nil
+}
+
+// SlotInstants returns the start and end instants of a slot on a branch-local date.
+func SlotInstants(loc *time.Location, date, start, end string) (time.Time, time.Time, error) {
+	startsAt, _, err := LocalInstant(loc, date, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endsAt, _, err := LocalInstant(loc, date, end)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return startsAt, endsAt, nil
+}
+
+// ResolveDate turns a branch-relative date keyword (today, tomorrow,
+// yesterday) into YYYY-MM-DD in loc at instant now. Absolute dates are
+// validated and returned unchanged.
+func ResolveDate(loc *time.Location, now time.Time, date string) (string, error) {
+	local := now.In(loc)
+	switch date {
+	case "today":
+		return local.Format("2006-01-02"), nil
+	case "tomorrow":
+		return local.AddDate(0, 0, 1).Format("2006-01-02"), nil
+	case "yesterday":
+		return local.AddDate(0, 0, -1).Format("2006-01-02"), nil
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", fmt.Errorf("invalid date %q", date)
+	}
+	return date, nil
+}
+
+func parseClock(s string) (time.Time, error) {
+	if t, err := time.Parse("15:04:05", s); err == nil {
+		return t, nil
+	}
+	return time.Parse("15:04", s)
+}
+
+func sameWallClock(t, naive time.Time) bool {
+	y, m, d := t.Date()
+	ny, nm, nd := naive.Date()
+	return y == ny && m == nm && d == nd &&
+		t.Hour() == naive.Hour() && t.Minute() == naive.Minute() && t.Second() == naive.Second()
+}
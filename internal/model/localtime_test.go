@@ -0,0 +1,84 @@
+package model
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestLocalInstant(t *testing.T) {
+	tests := []struct {
+		name       string
+		zone       string
+		date       string
+		clock      string
+		want       string // RFC 3339 in the zone
+		wantExists bool
+	}{
+		// America/New_York: 2026-03-08 02:00 EST -> 03:00 EDT, 2026-11-01 02:00 EDT -> 01:00 EST
+		{"before spring forward", "America/New_York", "2026-03-08", "01:59", "2026-03-08T01:59:00-05:00", true},
+		{"spring-forward gap moves forward", "America/New_York", "2026-03-08", "02:30", "2026-03-08T03:30:00-04:00", false},
+		{"gap start", "America/New_York", "2026-03-08", "02:00", "2026-03-08T03:00:00-04:00", false},
+		{"after spring forward", "America/New_York", "2026-03-08", "03:00", "2026-03-08T03:00:00-04:00", true},
+		{"fall-back ambiguous takes first occurrence", "America/New_York", "2026-11-01", "01:30", "2026-11-01T01:30:00-04:00", true},
+		{"after fall back", "America/New_York", "2026-11-01", "02:00", "2026-11-01T02:00:00-05:00", true},
+		{"seconds", "America/New_York", "2026-07-01", "09:15:30", "2026-07-01T09:15:30-04:00", true},
+		// Asia/Bangkok has no DST
+		{"no DST", "Asia/Bangkok", "2026-03-08", "02:30", "2026-03-08T02:30:00+07:00", true},
+		{"no DST midnight", "Asia/Bangkok", "2026-11-01", "00:00", "2026-11-01T00:00:00+07:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, exists, err := LocalInstant(loc, tt.date, tt.clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := got.Format(time.RFC3339); s != tt.want || exists != tt.wantExists {
+				t.Errorf("LocalInstant(%s %s) = %s, %v; want %s, %v", tt.date, tt.clock, s, exists, tt.want, tt.wantExists)
+			}
+		})
+	}
+}
+
+func TestSlotInstants(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bkk, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		loc        *time.Location
+		date       string
+		start, end string
+		want       time.Duration
+	}{
+		{"spring forward loses an hour", ny, "2026-03-08", "01:00", "04:00", 2 * time.Hour},
+		{"fall back gains an hour", ny, "2026-11-01", "00:30", "02:30", 3 * time.Hour},
+		{"ordinary day", ny, "2026-07-01", "09:00", "10:30", 90 * time.Minute},
+		{"no DST", bkk, "2026-03-08", "01:00", "04:00", 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startsAt, endsAt, err := SlotInstants(tt.loc, tt.date, tt.start, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := endsAt.Sub(startsAt); got != tt.want {
+				t.Errorf("slot lasts %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := SlotInstants(ny, "2026-02-30", "09:00", "10:00"); err == nil {
+		t.Error("invalid date accepted")
+	}
+}
@@ -6,8 +6,54 @@ type Order struct {
 	ID           int64     `json:"id"`
 	BranchID     int64     `json:"branch_id"`
 	TimeslotID   int64     `json:"timeslot_id"`
+	ResourceID   *int64    `json:"resource_id"` // resource held by the booking, nil for slots without resources
+	ServiceID    *int64    `json:"service_id"`
+	CustomerID   *string   `json:"customer_id"` // owner's subject, nil when booked by staff
 	CustomerName string    `json:"customer_name"`
 	Status       string    `json:"status"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	StartsAt     time.Time `json:"starts_at"` // timeslot start, RFC3339 in branch time zone
+	EndsAt       time.Time `json:"ends_at"`   // starts_at + duration_minutes for service bookings
+
+	// DurationMinutes is the service's duration when it was booked; nil =
+	// the whole timeslot.
+	DurationMinutes *int `json:"duration_minutes"`
+
+	CancelReason *CancelReason `json:"cancel_reason"`
+	CancelNote   *string       `json:"cancel_note"`
+	CancelledAt  *time.Time    `json:"cancelled_at"`
+	CancelledBy  *Actor        `json:"cancelled_by"`
+
+	CheckedInAt *time.Time `json:"checked_in_at"`
+	NoShowAt    *time.Time `json:"no_show_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at"` // set when an unconfirmed order was confirmed
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CancelReason is a stable reason code; free text goes into CancelNote.
+type CancelReason string
+
+const (
+	CancelCustomerRequest  CancelReason = "customer_request"
+	CancelScheduleConflict CancelReason = "schedule_conflict"
+	CancelIllness          CancelReason = "illness"
+	CancelBranchClosed     CancelReason = "branch_closed"
+	CancelStaffUnavailable CancelReason = "staff_unavailable"
+	CancelDuplicateBooking CancelReason = "duplicate_booking"
+	CancelOther            CancelReason = "other" // requires a note
+
+	// CancelNotConfirmed is set by the system when it releases an unconfirmed
+	// order; clients cannot choose it.
+	CancelNotConfirmed CancelReason = "not_confirmed"
+)
+
+// Valid reports whether r is a reason code clients may give.
+func (r CancelReason) Valid() bool {
+	switch r {
+	case CancelCustomerRequest, CancelScheduleConflict, CancelIllness,
+		CancelBranchClosed, CancelStaffUnavailable, CancelDuplicateBooking, CancelOther:
+		return true
+	}
+	return false
 }
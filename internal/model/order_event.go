@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type OrderEventType string
+
+const (
+	OrderCreated     OrderEventType = "created"
+	OrderCancelled   OrderEventType = "cancelled"
+	OrderRescheduled OrderEventType = "rescheduled"
+	OrderCheckedIn   OrderEventType = "checked_in"
+	OrderNoShow      OrderEventType = "no_show"
+	OrderConfirmed   OrderEventType = "confirmed"
+)
+
+// OrderEvent is one entry of an order's append-only history.
+type OrderEvent struct {
+	ID            int64          `json:"id"`
+	OrderID       int64          `json:"order_id"`
+	Type          OrderEventType `json:"type"`
+	Actor         Actor          `json:"actor"`
+	OldStatus     *string        `json:"old_status"`
+	NewStatus     string         `json:"new_status"`
+	OldTimeslotID *int64         `json:"old_timeslot_id"`
+	NewTimeslotID *int64         `json:"new_timeslot_id"`
+	Reason        *string        `json:"reason"`
+	Note          *string        `json:"note"`
+	RequestID     *string        `json:"request_id"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
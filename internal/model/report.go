@@ -0,0 +1,30 @@
+package model
+
+// Utilization is seat usage of active slots over one period, or one cell of
+// a heatmap. Utilization is Reserved/Capacity, nil when there were no slots.
+type Utilization struct {
+	Period      string   `json:"period,omitempty"`  // first day of the day/week, YYYY-MM-DD
+	Weekday     *int     `json:"weekday,omitempty"` // heatmap: ISO weekday, 1 = Monday
+	Hour        *int     `json:"hour,omitempty"`    // heatmap: hour the slots start, branch-local
+	Slots       int      `json:"slots"`
+	FullSlots   int      `json:"full_slots"`
+	Capacity    int      `json:"capacity"`
+	Reserved    int      `json:"reserved"`
+	Utilization *float64 `json:"utilization"`
+}
+
+// BookingActivity counts orders booked and cancelled during one period.
+type BookingActivity struct {
+	Period        string `json:"period"`
+	Bookings      int    `json:"bookings"`
+	Cancellations int    `json:"cancellations"`
+}
+
+// LeadTimeBucket counts orders by how long before the slot they were booked.
+// MaxMinutes is nil for the open-ended last bucket.
+type LeadTimeBucket struct {
+	Label      string `json:"label"`
+	MinMinutes int    `json:"min_minutes"`
+	MaxMinutes *int   `json:"max_minutes"`
+	Orders     int    `json:"orders"`
+}
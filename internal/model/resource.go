@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// ResourceKind is what a resource is; every kind is scheduled the same way.
+type ResourceKind string
+
+const (
+	ResourceStaff     ResourceKind = "staff"
+	ResourceRoom      ResourceKind = "room"
+	ResourceEquipment ResourceKind = "equipment"
+)
+
+// Valid reports whether k is a known kind.
+func (k ResourceKind) Valid() bool {
+	switch k {
+	case ResourceStaff, ResourceRoom, ResourceEquipment:
+		return true
+	}
+	return false
+}
+
+// Resource is a staff member, room or piece of equipment of a branch.
+// Timeslots with assigned resources take one resource per booking.
+type Resource struct {
+	ID           int64                  `json:"id"`
+	BranchID     int64                  `json:"branch_id"`
+	Kind         ResourceKind           `json:"kind"`
+	Name         string                 `json:"name"`
+	IsActive     bool                   `json:"is_active"`
+	Availability []ResourceAvailability `json:"availability"` // empty = whenever assigned
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+// ResourceAvailability is one weekly interval in which a resource can serve
+// slots, in branch-local time. A weekday may have several intervals.
+type ResourceAvailability struct {
+	Weekday   time.Weekday `json:"weekday"`    // 0 = Sunday
+	StartTime string       `json:"start_time"` // HH:MM
+	EndTime   string       `json:"end_time"`   // HH:MM
+}
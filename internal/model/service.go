@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Service is an entry of a branch's service catalog. Booking it takes a seat
+// in as many consecutive timeslots as its duration needs.
+type Service struct {
+	ID              int64     `json:"id"`
+	BranchID        int64     `json:"branch_id"`
+	Name            string    `json:"name"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Price           string    `json:"price"`        // decimal, e.g. "450.00"
+	ResourceIDs     []int64   `json:"resource_ids"` // a booking holds one of these; empty = any or none
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ServiceStart is a start time at which a service fits into a branch's
+// schedule: the slots it would occupy and the resources that could serve it.
+type ServiceStart struct {
+	TimeslotID  int64     `json:"timeslot_id"` // book with this slot and the service
+	StartTime   string    `json:"start_time"`  // HH:MM:SS
+	StartsAt    time.Time `json:"starts_at"`   // RFC3339 in branch time zone
+	EndsAt      time.Time `json:"ends_at"`
+	TimeslotIDs []int64   `json:"timeslot_ids"`
+	ResourceIDs []int64   `json:"resource_ids"` // free for the whole service; empty for slots without resources
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Tenant is a business (e.g. a clinic or salon chain) owning a set of branches.
+type Tenant struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Hosts     []string  `json:"hosts"` // request hosts that resolve to this tenant
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -8,9 +8,27 @@ type Timeslot struct {
 	ServiceDate string    `json:"service_date"` // YYYY-MM-DD
 	StartTime   string    `json:"start_time"`   // HH:MM:SS
 	EndTime     string    `json:"end_time"`     // HH:MM:SS
+	StartsAt    time.Time `json:"starts_at"`    // RFC3339 in branch time zone
+	EndsAt      time.Time `json:"ends_at"`      // RFC3339 in branch time zone
 	Capacity    int       `json:"capacity"`
 	Reserved    int       `json:"reserved"`
 	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+
+	// ResourceIDs are the resources serving the slot; when set, capacity is
+	// their number and FreeResources how many of them can still be booked
+	// (overlapping slots share resources).
+	ResourceIDs   []int64 `json:"resource_ids"`
+	FreeResources *int    `json:"free_resources,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TimeslotConflict is the existing slot a new one would overlap in a branch
+// that does not allow overlapping slots.
+type TimeslotConflict struct {
+	ID          int64  `json:"id"`
+	ServiceDate string `json:"service_date"` // YYYY-MM-DD
+	StartTime   string `json:"start_time"`   // HH:MM:SS
+	EndTime     string `json:"end_time"`     // HH:MM:SS
 }
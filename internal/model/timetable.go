@@ -4,13 +4,17 @@ type TimetableOrder struct {
 	ID           int64  `json:"id"`
 	CustomerName string `json:"customer_name"`
 	Status       string `json:"status"`
-	CreatedAt    string `json:"created_at"`
+	ResourceID   int64  `json:"resource_id,omitempty"` // kept comparable for the socket diff
+	ResourceName string `json:"resource_name,omitempty"`
+	CreatedAt    string `json:"created_at"` // RFC3339 in branch time zone
 }
 
 type TimetableTimeslot struct {
 	ID        int64  `json:"id"`
 	StartTime string `json:"start_time"`
 	EndTime   string `json:"end_time"`
+	StartsAt  string `json:"starts_at"` // RFC3339 in branch time zone
+	EndsAt    string `json:"ends_at"`
 	Capacity  int    `json:"capacity"`
 	Reserved  int    `json:"reserved"`
 	IsActive  bool   `json:"is_active"`
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// WebhookEndpoint is a URL a tenant receives events on. The signing secret is
+// only returned when the endpoint is created.
+type WebhookEndpoint struct {
+	ID         int64     `json:"id"`
+	TenantID   int64     `json:"tenant_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"` // empty = every event
+	IsActive   bool      `json:"is_active"`
+	CreatedBy  *string   `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliveryDelivered WebhookDeliveryStatus = "delivered"
+	DeliveryDead      WebhookDeliveryStatus = "dead" // gave up; can be replayed
+)
+
+// WebhookDelivery is the state of one event sent to one endpoint.
+type WebhookDelivery struct {
+	ID             int64                 `json:"id"`
+	EventID        int64                 `json:"event_id"`
+	EndpointID     int64                 `json:"endpoint_id"`
+	EventType      string                `json:"event_type"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	LastStatusCode *int64                `json:"last_status_code"`
+	LastError      *string               `json:"last_error"`
+	DeliveredAt    *time.Time            `json:"delivered_at"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
@@ -0,0 +1,215 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/idlistic/go-backend-api-sample/internal/i18n"
+	"github.com/idlistic/go-backend-api-sample/internal/requestid"
+)
+
+// ContentType is the media type defined by RFC 9457.
+const ContentType = "application/problem+json"
+
+// Stable machine-readable codes. Clients should match on these, never on titles.
+const (
+	CodeValidationFailed      = "validation_failed"
+	CodeInvalidJSON           = "invalid_json"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeInternal              = "internal_error"
+	CodeTimeslotNotFound      = "timeslot_not_found"
+	CodeTimeslotInactive      = "timeslot_inactive"
+	CodeTimeslotFullyBooked   = "timeslot_fully_booked"
+	CodeOrderNotFound         = "order_not_found"
+	CodeOrderNotCancellable   = "order_not_cancellable"
+	CodeBranchNotFound        = "branch_not_found"
+	CodeBranchNameTaken       = "branch_name_taken"
+	CodeBranchInactive        = "branch_inactive"
+	CodeBookingWindowClosed   = "booking_window_closed"
+	CodeBookingTooFarAhead    = "booking_too_far_in_advance"
+	CodeCancelDeadline        = "cancellation_deadline_passed"
+	CodeOrderNotReschedulable = "order_not_reschedulable"
+	CodeSameTimeslot          = "reschedule_same_timeslot"
+	CodeCapacityBelowReserved = "capacity_below_reserved"
+	CodeUnauthenticated       = "unauthenticated"
+	CodeInvalidToken          = "invalid_token"
+	CodeTokenExpired          = "token_expired"
+	CodeOrderNotOwned         = "order_not_owned"
+	CodeForbidden             = "forbidden"
+	CodeOrderNotCheckable     = "order_not_checkable"
+	CodeInvalidAPIKey         = "invalid_api_key"
+	CodeAPIKeyQuotaExceeded   = "api_key_quota_exceeded"
+	CodeAPIKeyNotFound        = "api_key_not_found"
+	CodeAPIKeyRevoked         = "api_key_revoked"
+	CodeInsufficientScope     = "insufficient_scope"
+	CodeRateLimited           = "rate_limited"
+	CodeTenantNotFound        = "tenant_not_found"
+	CodeTenantMismatch        = "tenant_mismatch"
+	CodeWebhookNotFound       = "webhook_not_found"
+	CodeDeliveryNotFound      = "webhook_delivery_not_found"
+	CodeInvalidCalendarToken  = "invalid_calendar_token"
+	CodeImportRejected        = "import_rejected"
+	CodeBookingBlocked        = "booking_blocked"
+	CodeConfirmWindowClosed   = "confirmation_window_closed"
+	CodeOrderNotConfirmable   = "order_not_confirmable"
+	CodeOrderNotMarkable      = "order_not_markable"
+	CodeSlotNotStarted        = "slot_not_started"
+	CodeResourceNotFound      = "resource_not_found"
+	CodeResourceNameTaken     = "resource_name_taken"
+	CodeResourceNotAssigned   = "resource_not_assigned"
+	CodeResourceUnavailable   = "resource_unavailable"
+	CodeResourceInUse         = "resource_in_use"
+	CodeCapacityFromResources = "capacity_set_by_resources"
+	CodeServiceNotFound       = "service_not_found"
+	CodeServiceNameTaken      = "service_name_taken"
+	CodeServiceInactive       = "service_inactive"
+	CodeServiceDoesNotFit     = "service_does_not_fit"
+	CodeTimeslotOverlap       = "timeslot_overlap"
+)
+
+// Field-level validation codes.
+const (
+	FieldRequired        = "required"
+	FieldInvalid         = "invalid"
+	FieldPositiveInt     = "positive_integer"
+	FieldDateFormat      = "date_format"
+	FieldTimeFormat      = "time_format"
+	FieldTimeOrder       = "time_order"
+	FieldTimezone        = "timezone"
+	FieldOutOfRange      = "out_of_range"
+	FieldDuplicate       = "duplicate"
+	FieldTooLong         = "too_long"
+	FieldTimestampFormat = "timestamp_format"
+	FieldNotFound        = "not_found"
+	FieldForbidden       = "forbidden"
+	FieldInactive        = "inactive"
+	FieldBelowReserved   = "below_reserved"
+	FieldNonexistentTime = "nonexistent_time"
+	FieldSetByResources  = "set_by_resources"
+	FieldOverlaps        = "overlaps"
+)
+
+// FieldError describes one invalid input field. Message may be left empty;
+// Write fills it from the "field.<code>" catalog entry.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Conflict is the existing entity the field's value collides with.
+	Conflict any `json:"conflict,omitempty"`
+}
+
+// Problem is an RFC 9457 problem details body with a few extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	// Conflict is the existing entity the request collides with, when a
+	// 409 can name it.
+	Conflict any `json:"conflict,omitempty"`
+}
+
+// New builds a problem whose type URI is derived from its code.
+func New(status int, code, title string) *Problem {
+	return &Problem{
+		Type:   TypeURI(code),
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+// TypeURI returns the (relative) problem type URI for a code.
+func TypeURI(code string) string {
+	return "/problems/" + code
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+// WithDetail returns a copy with the detail set. detail may be an i18n
+// message ID ("detail.*"), which Write translates.
+func (p *Problem) WithDetail(detail string) *Problem {
+	cp := *p
+	cp.Detail = detail
+	return &cp
+}
+
+// WithConflict returns a copy naming the entity in the way.
+func (p *Problem) WithConflict(conflict any) *Problem {
+	cp := *p
+	cp.Conflict = conflict
+	return &cp
+}
+
+// Validation builds a 400 problem listing every invalid field.
+func Validation(errs ...FieldError) *Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+	p.Errors = errs
+	return p
+}
+
+// Write sends p as application/problem+json in the language negotiated from
+// Accept-Language, filling in instance and request ID. Codes stay untranslated.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	lang := i18n.FromRequest(r)
+	out := localize(*p, lang)
+	if out.Instance == "" {
+		out.Instance = r.URL.Path
+	}
+	if out.RequestID == "" {
+		out.RequestID = requestid.FromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Language", string(lang))
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(out.Status)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func localize(p Problem, lang i18n.Lang) Problem {
+	if id := "problem." + p.Code; i18n.Has(id) {
+		p.Title = i18n.T(lang, id)
+	}
+	if i18n.Has(p.Detail) {
+		p.Detail = i18n.T(lang, p.Detail)
+	}
+	if len(p.Errors) > 0 {
+		p.Errors = localizeFields(p.Errors, lang)
+	}
+	return p
+}
+
+// LocalizeFields fills in field error messages for responses that are not
+// problems, e.g. reports of partially applied requests.
+func LocalizeFields(r *http.Request, errs []FieldError) []FieldError {
+	return localizeFields(errs, i18n.FromRequest(r))
+}
+
+func localizeFields(in []FieldError, lang i18n.Lang) []FieldError {
+	errs := make([]FieldError, len(in))
+	for i, fe := range in {
+		if fe.Message == "" || i18n.Has(fe.Message) {
+			id := fe.Message
+			if id == "" {
+				id = "field." + fe.Code
+			}
+			fe.Message = i18n.T(lang, id, "field", fe.Field)
+		}
+		errs[i] = fe
+	}
+	return errs
+}
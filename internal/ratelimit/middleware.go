@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+var problemRateLimited = problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "too many requests")
+
+// Config selects the budgets. Reads are GET/HEAD; everything else is a write,
+// so booking bursts cannot starve availability searches and vice versa.
+type Config struct {
+	Read  Limit
+	Write Limit
+
+	// TrustProxy takes the client IP from the first X-Forwarded-For entry.
+	// Enable only behind a proxy that sets it.
+	TrustProxy bool
+
+	// Exempt paths are never limited (e.g. health checks).
+	Exempt []string
+}
+
+// Middleware limits requests per client: the API key, else the user, else
+// the IP. It must run after auth.Middleware. If the store fails the request
+// is let through: an outage of the limiter should not take the API down.
+func Middleware(store Store, cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range cfg.Exempt {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			class, l := "write", cfg.Write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				class, l = "read", cfg.Read
+			}
+			if !l.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if take(w, r, store, class+":"+clientKey(r, cfg.TrustProxy), l) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// Guard limits requests carrying credentials per IP before they are checked,
+// so that guessing API keys or tokens is throttled too. It must run before
+// auth.Middleware; Middleware still applies the per-key and per-user budgets.
+// Anonymous requests pass through to Middleware's per-IP budgets.
+func Guard(store Store, l Limit, trustProxy bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.Enabled() || !auth.HasCredentials(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if take(w, r, store, "auth:ip:"+clientIP(r, trustProxy), l) {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// take takes a token from key's bucket and sets the RateLimit headers. It
+// writes 429 and returns false when the bucket is empty.
+func take(w http.ResponseWriter, r *http.Request, store Store, key string, l Limit) bool {
+	res, err := store.Take(r.Context(), key, l, time.Now())
+	if err != nil {
+		log.Printf("rate limit: %v", err)
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(l.Burst)+";w="+strconv.Itoa(ceilSeconds(time.Duration(float64(l.Burst)/l.Rate*float64(time.Second)))))
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+		problem.Write(w, r, problemRateLimited)
+		return false
+	}
+	return true
+}
+
+// clientKey identifies who is calling. Keys and users are limited across all
+// their IPs; anonymous callers per IP.
+func clientKey(r *http.Request, trustProxy bool) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		if p.IsAPIKey() {
+			return "key:" + strconv.FormatInt(p.APIKeyID, 10)
+		}
+		return "user:" + p.Subject
+	}
+	return "ip:" + clientIP(r, trustProxy)
+}
+
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first, _, _ := strings.Cut(xff, ",")
+			if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
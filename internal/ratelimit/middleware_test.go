@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+)
+
+type rejectKeys struct{ calls int }
+
+func (k *rejectKeys) AuthenticateKey(context.Context, string) (auth.Principal, error) {
+	k.calls++
+	return auth.Principal{}, auth.ErrInvalidAPIKey
+}
+
+func TestGuardLimitsInvalidAPIKeys(t *testing.T) {
+	keys := &rejectKeys{}
+	store := NewMemoryStore()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limiter := Middleware(store, Config{Read: PerMinute(60, 100), Write: PerMinute(60, 100)})
+	h := Guard(store, PerMinute(1, 3), false)(auth.Middleware(nil, keys)(limiter(ok)))
+
+	codes := make([]int, 5)
+	for i := range codes {
+		r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		r.Header.Set(auth.APIKeyHeader, "gbk_guess")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		codes[i] = rec.Code
+	}
+
+	want := []int{401, 401, 401, 429, 429}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("codes = %v, want %v", codes, want)
+		}
+	}
+	if keys.calls != 3 {
+		t.Errorf("keys checked %d times, want 3", keys.calls)
+	}
+
+	// anonymous requests from the same IP only count against Middleware's budget
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.RemoteAddr = "203.0.113.7:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("anonymous request: got %d, want 200", rec.Code)
+	}
+}
+
+func TestGuardCountsWebSocketBearers(t *testing.T) {
+	store := NewMemoryStore()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := Guard(store, PerMinute(1, 2), false)(ok)
+
+	codes := make([]int, 3)
+	for i := range codes {
+		r := httptest.NewRequest(http.MethodGet, "/timeslots/stream", nil)
+		r.RemoteAddr = "203.0.113.8:1234"
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Protocol", "availability, "+auth.WebSocketBearerPrefix+"guess")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		codes[i] = rec.Code
+	}
+	if want := []int{200, 200, 429}; !slices.Equal(codes, want) {
+		t.Errorf("codes = %v, want %v", codes, want)
+	}
+}
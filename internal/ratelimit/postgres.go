@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore shares buckets between replicas through the
+// rate_limit_buckets table. Each Take is one row-locking UPDATE, so
+// concurrent requests for the same key are serialized by Postgres.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error) {
+	// a new key starts with a full bucket
+	const ensureQ = `
+INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (key) DO NOTHING;
+`
+	if _, err := s.db.ExecContext(ctx, ensureQ, key, float64(l.Burst), now); err != nil {
+		return Result{}, err
+	}
+
+	// refilled = min(burst, tokens + elapsed * rate); take one if available.
+	// SET sees the old row, so "allowed" records the decision for RETURNING.
+	const takeQ = `
+UPDATE rate_limit_buckets AS b
+SET tokens = CASE WHEN r.refilled >= 1 THEN r.refilled - 1 ELSE r.refilled END,
+    allowed = r.refilled >= 1,
+    updated_at = GREATEST(b.updated_at, $4)
+FROM (
+  SELECT LEAST($2::float8, tokens + GREATEST(0, EXTRACT(EPOCH FROM ($4 - updated_at))) * $3::float8) AS refilled
+  FROM rate_limit_buckets
+  WHERE key = $1
+  FOR UPDATE
+) AS r
+WHERE b.key = $1
+RETURNING b.tokens, b.allowed;
+`
+	var (
+		tokens  float64
+		allowed bool
+	)
+	if err := s.db.QueryRowContext(ctx, takeQ, key, float64(l.Burst), l.Rate, now).Scan(&tokens, &allowed); err != nil {
+		return Result{}, err
+	}
+	return result(allowed, tokens, l), nil
+}
+
+func (s *PostgresStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,90 @@
+// Package ratelimit throttles clients with token buckets. Each bucket holds up
+// to Burst tokens and refills at Rate tokens per second; a request takes one.
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+// Limit is a bucket's size and refill rate. A zero Rate disables limiting.
+type Limit struct {
+	Rate  float64 // tokens per second
+	Burst int
+}
+
+// PerMinute builds a limit of n requests per minute with the given burst.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Enabled reports whether l limits anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the outcome of one Take.
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket size
+	Remaining  int           // whole tokens left after this request
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// Store keeps buckets by key. Take refills key's bucket up to now and takes a
+// token if one is available; Purge drops buckets untouched since before.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit, now time.Time) (Result, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// refill returns the tokens of a bucket last seen at last with tokens left.
+func refill(tokens float64, last, now time.Time, l Limit) float64 {
+	if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens += elapsed * l.Rate
+	}
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// result describes a bucket holding tokens after the decision.
+func result(allowed bool, tokens float64, l Limit) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(l.Burst) - tokens) / l.Rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// RunPurge drops buckets idle for longer than idle, every interval, until ctx
+// is cancelled. An idle bucket is full again, so dropping it changes nothing.
+func RunPurge(ctx context.Context, s Store, idle, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if _, err := s.Purge(ctx, time.Now().Add(-idle)); err != nil && ctx.Err() == nil {
+			log.Printf("rate limit purge: %v", err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package reliability releases the seats of bookings that customers were
+// asked to confirm (see model.ReliabilityPolicy) but did not.
+package reliability
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// batchSize bounds the orders released per call.
+const batchSize = 100
+
+// Releaser cancels unconfirmed orders past their confirmation deadline.
+type Releaser interface {
+	ReleaseUnconfirmed(ctx context.Context, limit int) (int, error)
+}
+
+// RunRelease releases overdue unconfirmed orders every interval until ctx is
+// cancelled. Replicas may run it concurrently: each order is locked while it
+// is cancelled and one already released is skipped.
+func RunRelease(ctx context.Context, r Releaser, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		for {
+			n, err := r.ReleaseUnconfirmed(ctx, batchSize)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("release unconfirmed orders: %v", err)
+			}
+			if n > 0 {
+				log.Printf("release unconfirmed orders: released %d", n)
+			}
+			if err != nil || n < batchSize {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+// AnalyticsRepository reads the reporting views of 016_create_analytics.sql.
+// They lag behind the live tables until the next Refresh.
+type AnalyticsRepository struct {
+	db *sql.DB
+}
+
+func NewAnalyticsRepository(db *sql.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// Report periods: calendar days, or ISO weeks starting on Monday.
+const (
+	PeriodDay  = "day"
+	PeriodWeek = "week"
+)
+
+// leadTimeBuckets match the bucket numbers of analytics_lead_times.
+var leadTimeBuckets = []struct {
+	label    string
+	min, max int // minutes; max 0 = open-ended
+}{
+	{"under 1h", 0, 60},
+	{"1-3h", 60, 180},
+	{"3-24h", 180, 24 * 60},
+	{"1-3d", 24 * 60, 3 * 24 * 60},
+	{"3-7d", 3 * 24 * 60, 7 * 24 * 60},
+	{"7-14d", 7 * 24 * 60, 14 * 24 * 60},
+	{"14-30d", 14 * 24 * 60, 30 * 24 * 60},
+	{"30d+", 30 * 24 * 60, 0},
+}
+
+// periodsCTE lists every period ($4) touching the dates $2..$3, so reports
+// have a row for periods without activity too.
+const periodsCTE = `
+WITH periods AS (
+  SELECT DISTINCT date_trunc($4, d::timestamp)::date AS period
+  FROM generate_series($2::date, $3::date, interval '1 day') d
+)`
+
+// Refresh rebuilds the reporting views. It reports false when another
+// replica is already refreshing them.
+func (r *AnalyticsRepository) Refresh(ctx context.Context) (bool, error) {
+	var ran bool
+	err := r.db.QueryRowContext(ctx, `SELECT refresh_analytics();`).Scan(&ran)
+	return ran, err
+}
+
+// RefreshedAt is when the views were last rebuilt.
+func (r *AnalyticsRepository) RefreshedAt(ctx context.Context) (time.Time, error) {
+	var t time.Time
+	err := r.db.QueryRowContext(ctx, `SELECT refreshed_at FROM analytics_refresh;`).Scan(&t)
+	return t, err
+}
+
+// Utilization sums the seats of a branch's active slots per period for
+// service dates between from and to (inclusive).
+func (r *AnalyticsRepository) Utilization(ctx context.Context, branchID int64, from, to, period string) ([]model.Utilization, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = periodsCTE + `
+SELECT
+  p.period::text,
+  COALESCE(sum(a.slots), 0)::int,
+  COALESCE(sum(a.full_slots), 0)::int,
+  COALESCE(sum(a.capacity), 0)::int,
+  COALESCE(sum(a.reserved), 0)::int
+FROM periods p
+LEFT JOIN (
+  analytics_slot_hours a
+  JOIN branches b ON b.id = a.branch_id AND b.tenant_id = $5
+)
+  ON a.branch_id = $1
+ AND a.service_date BETWEEN $2::date AND $3::date
+ AND date_trunc($4, a.service_date::timestamp)::date = p.period
+GROUP BY p.period
+ORDER BY p.period ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, period, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.Utilization, 0, 32)
+	for rows.Next() {
+		var u model.Utilization
+		if err := rows.Scan(&u.Period, &u.Slots, &u.FullSlots, &u.Capacity, &u.Reserved); err != nil {
+			return nil, err
+		}
+		u.Utilization = ratio(u.Reserved, u.Capacity)
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// Heatmap sums seats by ISO weekday and starting hour, for the hours a
+// branch had active slots between from and to.
+func (r *AnalyticsRepository) Heatmap(ctx context.Context, branchID int64, from, to string) ([]model.Utilization, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT
+  EXTRACT(ISODOW FROM a.service_date)::int AS weekday,
+  a.hour,
+  sum(a.slots)::int,
+  sum(a.full_slots)::int,
+  sum(a.capacity)::int,
+  sum(a.reserved)::int
+FROM analytics_slot_hours a
+JOIN branches b ON b.id = a.branch_id
+WHERE a.branch_id = $1
+  AND a.service_date BETWEEN $2::date AND $3::date
+  AND b.tenant_id = $4
+GROUP BY 1, 2
+ORDER BY 1 ASC, 2 ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.Utilization, 0, 7*12)
+	for rows.Next() {
+		var (
+			u             model.Utilization
+			weekday, hour int
+		)
+		if err := rows.Scan(&weekday, &hour, &u.Slots, &u.FullSlots, &u.Capacity, &u.Reserved); err != nil {
+			return nil, err
+		}
+		u.Weekday, u.Hour = &weekday, &hour
+		u.Utilization = ratio(u.Reserved, u.Capacity)
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// BookingActivity counts orders booked and cancelled per period, by the
+// branch-local day they were booked or cancelled on.
+func (r *AnalyticsRepository) BookingActivity(ctx context.Context, branchID int64, from, to, period string) ([]model.BookingActivity, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = periodsCTE + `
+SELECT
+  p.period::text,
+  COALESCE(sum(a.bookings), 0)::int,
+  COALESCE(sum(a.cancellations), 0)::int
+FROM periods p
+LEFT JOIN (
+  analytics_order_days a
+  JOIN branches b ON b.id = a.branch_id AND b.tenant_id = $5
+)
+  ON a.branch_id = $1
+ AND a.day BETWEEN $2::date AND $3::date
+ AND date_trunc($4, a.day::timestamp)::date = p.period
+GROUP BY p.period
+ORDER BY p.period ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, period, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.BookingActivity, 0, 32)
+	for rows.Next() {
+		var a model.BookingActivity
+		if err := rows.Scan(&a.Period, &a.Bookings, &a.Cancellations); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// LeadTimes counts a branch's orders for service dates between from and to
+// by how long before the slot start they were booked. Every bucket is
+// returned, empty ones with zero orders.
+func (r *AnalyticsRepository) LeadTimes(ctx context.Context, branchID int64, from, to string) ([]model.LeadTimeBucket, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT a.bucket, sum(a.orders)::int
+FROM analytics_lead_times a
+JOIN branches b ON b.id = a.branch_id
+WHERE a.branch_id = $1
+  AND a.service_date BETWEEN $2::date AND $3::date
+  AND b.tenant_id = $4
+GROUP BY a.bucket;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.LeadTimeBucket, len(leadTimeBuckets))
+	for i, b := range leadTimeBuckets {
+		out[i] = model.LeadTimeBucket{Label: b.label, MinMinutes: b.min}
+		if b.max > 0 {
+			max := b.max
+			out[i].MaxMinutes = &max
+		}
+	}
+	for rows.Next() {
+		var bucket, orders int
+		if err := rows.Scan(&bucket, &orders); err != nil {
+			return nil, err
+		}
+		if bucket >= 0 && bucket < len(out) {
+			out[bucket].Orders = orders
+		}
+	}
+	return out, rows.Err()
+}
+
+// ratio is n/d, or nil when d is zero.
+func ratio(n, d int) *float64 {
+	if d == 0 {
+		return nil
+	}
+	v := float64(n) / float64(d)
+	return &v
+}
@@ -0,0 +1,477 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+var (
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrAPIKeyRevoked       = errors.New("api key is revoked or expired")
+	ErrAPIKeyInvalid       = errors.New("invalid api key")
+	ErrAPIKeyQuotaExceeded = errors.New("api key daily quota exceeded")
+)
+
+// apiKeyScheme starts every key so leaked keys are easy to grep for.
+const apiKeyScheme = "gbk"
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// NewAPIKey describes a key to issue.
+type NewAPIKey struct {
+	Name       string
+	Scopes     []string
+	BranchIDs  []int64 // empty = every branch
+	DailyQuota *int    // nil = unlimited
+	ExpiresAt  *time.Time
+}
+
+// apiKeyColumns lists the columns read by scanAPIKey. Arrays are read as
+// comma-separated text to stay within database/sql scan types.
+const apiKeyColumns = `id, tenant_id, name, prefix, subject,
+  array_to_string(scopes, ','), array_to_string(branch_ids, ','),
+  daily_quota, rotated_from, created_by, created_at, expires_at, revoked_at, last_used_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }, k *model.APIKey, extra ...any) error {
+	var (
+		scopes, branches     string
+		quota                sql.NullInt64
+		rotatedFrom          sql.NullInt64
+		createdBy            sql.NullString
+		expires, revoked, lu sql.NullTime
+	)
+	dest := append([]any{
+		&k.ID,
+		&k.TenantID,
+		&k.Name,
+		&k.Prefix,
+		&k.Subject,
+		&scopes,
+		&branches,
+		&quota,
+		&rotatedFrom,
+		&createdBy,
+		&k.CreatedAt,
+		&expires,
+		&revoked,
+		&lu,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	k.Scopes = splitList(scopes)
+	k.BranchIDs = make([]int64, 0, 4)
+	for _, s := range splitList(branches) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		k.BranchIDs = append(k.BranchIDs, id)
+	}
+	k.DailyQuota = nil
+	if quota.Valid {
+		q := int(quota.Int64)
+		k.DailyQuota = &q
+	}
+	k.RotatedFrom = nullInt64(rotatedFrom)
+	k.CreatedBy = nullString(createdBy)
+	k.ExpiresAt = timePtr(expires)
+	k.RevokedAt = timePtr(revoked)
+	k.LastUsedAt = timePtr(lu)
+	return nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// generateAPIKey returns a new key "gbk_<prefix>_<secret>" and its prefix.
+// The prefix is stored in clear for lookup; the whole key only as a hash.
+func generateAPIKey() (key, prefix string, err error) {
+	p := make([]byte, 6)
+	s := make([]byte, 32)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(s); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(p)
+	return apiKeyScheme + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(s), prefix, nil
+}
+
+// parseAPIKey returns the lookup prefix of a well-formed key.
+func parseAPIKey(key string) (string, bool) {
+	scheme, rest, ok := strings.Cut(key, "_")
+	if !ok || scheme != apiKeyScheme {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
+
+// Keys are 256-bit random values, so a fast hash is enough; there is nothing
+// to brute-force that a slow KDF would protect.
+func hashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// List returns the tenant's keys, newest first; revoked and expired keys only
+// when asked.
+func (r *APIKeyRepository) List(ctx context.Context, includeInactive bool) ([]model.APIKey, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+SELECT ` + apiKeyColumns + `
+FROM api_keys
+WHERE tenant_id = $1
+  AND ($2 OR (revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())))
+ORDER BY id DESC;
+`
+	rows, err := r.db.QueryContext(ctx, q, tid, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.APIKey, 0, 16)
+	for rows.Next() {
+		var k model.APIKey
+		if err := scanAPIKey(rows, &k); err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *APIKeyRepository) Get(ctx context.Context, id int64) (model.APIKey, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	return getAPIKey(ctx, r.db, tid, id, false)
+}
+
+func getAPIKey(ctx context.Context, q queryer, tenantID, id int64, forUpdate bool) (model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 AND tenant_id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	var k model.APIKey
+	if err := scanAPIKey(q.QueryRowContext(ctx, query, id, tenantID), &k); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.APIKey{}, ErrAPIKeyNotFound
+		}
+		return model.APIKey{}, err
+	}
+	return k, nil
+}
+
+// Issue creates a key of the current tenant and returns it with its
+// plaintext, which is not recoverable afterwards.
+func (r *APIKeyRepository) Issue(ctx context.Context, actor model.Actor, n NewAPIKey) (model.APIKey, string, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('api_keys', 'id'));`).Scan(&id); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	k, secret, err := insertAPIKey(ctx, tx, actor, tid, id, "apikey:"+strconv.FormatInt(id, 10), 0, n)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "api_key.issue",
+		EntityType: audit.EntityAPIKey,
+		EntityID:   strconv.FormatInt(k.ID, 10),
+		After:      k,
+	}); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.APIKey{}, "", err
+	}
+	return k, secret, nil
+}
+
+// insertAPIKey stores a freshly generated key; id 0 takes the next serial.
+func insertAPIKey(ctx context.Context, tx *sql.Tx, actor model.Actor, tenantID, id int64, subject string, rotatedFrom int64, n NewAPIKey) (model.APIKey, string, error) {
+	secret, prefix, err := generateAPIKey()
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	var quota sql.NullInt64
+	if n.DailyQuota != nil {
+		quota = sql.NullInt64{Int64: int64(*n.DailyQuota), Valid: true}
+	}
+	var expires sql.NullTime
+	if n.ExpiresAt != nil {
+		expires = sql.NullTime{Time: *n.ExpiresAt, Valid: true}
+	}
+
+	const q = `
+INSERT INTO api_keys (
+  id, name, prefix, key_hash, subject, scopes, branch_ids,
+  daily_quota, rotated_from, created_by, expires_at, tenant_id
+)
+VALUES (
+  COALESCE(NULLIF($1, 0), nextval(pg_get_serial_sequence('api_keys', 'id'))),
+  $2, $3, $4, $5, string_to_array($6, ','), string_to_array($7, ',')::bigint[],
+  $8, NULLIF($9, 0), NULLIF($10, ''), $11, $12
+)
+RETURNING ` + apiKeyColumns + `;
+`
+	var k model.APIKey
+	if err := scanAPIKey(tx.QueryRowContext(ctx, q,
+		id, n.Name, prefix, hashAPIKey(secret), subject,
+		strings.Join(n.Scopes, ","), joinIDs(n.BranchIDs),
+		quota, rotatedFrom, actor.ID, expires, tenantID,
+	), &k); err != nil {
+		return model.APIKey{}, "", err
+	}
+	return k, secret, nil
+}
+
+// Rotate issues a replacement with the same name, subject, scopes and limits.
+// The old key stops working immediately, or after grace if it is positive so
+// partners can roll out the new key first.
+func (r *APIKeyRepository) Rotate(ctx context.Context, actor model.Actor, id int64, grace time.Duration) (model.APIKey, string, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	old, err := getAPIKey(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	now := time.Now()
+	if !old.Active(now) {
+		return model.APIKey{}, "", ErrAPIKeyRevoked
+	}
+
+	k, secret, err := insertAPIKey(ctx, tx, actor, tid, 0, old.Subject, old.ID, NewAPIKey{
+		Name:       old.Name,
+		Scopes:     old.Scopes,
+		BranchIDs:  old.BranchIDs,
+		DailyQuota: old.DailyQuota,
+		ExpiresAt:  old.ExpiresAt,
+	})
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	const retireQ = `
+UPDATE api_keys
+SET revoked_at = CASE WHEN $2::bigint <= 0 THEN now() ELSE revoked_at END,
+    expires_at = CASE WHEN $2 > 0
+                      THEN LEAST(COALESCE(expires_at, 'infinity'), now() + $2 * interval '1 second')
+                      ELSE expires_at END
+WHERE id = $1;
+`
+	if _, err := tx.ExecContext(ctx, retireQ, id, int64(grace/time.Second)); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "api_key.rotate",
+		EntityType: audit.EntityAPIKey,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     old,
+		After:      k,
+	}); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.APIKey{}, "", err
+	}
+	return k, secret, nil
+}
+
+// Revoke disables a key. Revoking an already revoked key is a no-op.
+func (r *APIKeyRepository) Revoke(ctx context.Context, actor model.Actor, id int64) (model.APIKey, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	before, err := getAPIKey(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	if before.RevokedAt != nil {
+		return before, nil
+	}
+
+	var after model.APIKey
+	if err := scanAPIKey(tx.QueryRowContext(ctx, `
+UPDATE api_keys SET revoked_at = now() WHERE id = $1
+RETURNING `+apiKeyColumns+`;`, id), &after); err != nil {
+		return model.APIKey{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "api_key.revoke",
+		EntityType: audit.EntityAPIKey,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      after,
+	}); err != nil {
+		return model.APIKey{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.APIKey{}, err
+	}
+	return after, nil
+}
+
+// Authenticate resolves a presented key and counts the request against the
+// key's UTC-day usage. Unknown, revoked and expired keys are all reported as
+// ErrAPIKeyInvalid so callers cannot probe which keys exist. Keys are looked
+// up across tenants; the key's TenantID decides the tenant of the request.
+func (r *APIKeyRepository) Authenticate(ctx context.Context, key string, now time.Time) (model.APIKey, error) {
+	prefix, ok := parseAPIKey(key)
+	if !ok {
+		return model.APIKey{}, ErrAPIKeyInvalid
+	}
+
+	var k model.APIKey
+	var hash []byte
+	err := scanAPIKey(r.db.QueryRowContext(ctx, `
+SELECT `+apiKeyColumns+`, key_hash
+FROM api_keys
+WHERE prefix = $1;`, prefix), &k, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.APIKey{}, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return model.APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare(hash, hashAPIKey(key)) != 1 || !k.Active(now) {
+		return model.APIKey{}, ErrAPIKeyInvalid
+	}
+
+	const useQ = `
+WITH used AS (
+  UPDATE api_keys SET last_used_at = $2 WHERE id = $1
+)
+INSERT INTO api_key_usage (api_key_id, day, requests)
+VALUES ($1, $3::date, 1)
+ON CONFLICT (api_key_id, day) DO UPDATE
+SET requests = api_key_usage.requests + 1
+RETURNING requests;
+`
+	var requests int64
+	if err := r.db.QueryRowContext(ctx, useQ, k.ID, now, now.UTC().Format("2006-01-02")).Scan(&requests); err != nil {
+		return model.APIKey{}, err
+	}
+	if k.DailyQuota != nil && requests > int64(*k.DailyQuota) {
+		return k, ErrAPIKeyQuotaExceeded
+	}
+	return k, nil
+}
+
+// Usage returns per-day request counts for the last days UTC days, newest first.
+func (r *APIKeyRepository) Usage(ctx context.Context, id int64, days int) ([]model.APIKeyUsage, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+SELECT u.day::text, u.requests
+FROM api_key_usage u
+JOIN api_keys k ON k.id = u.api_key_id
+WHERE u.api_key_id = $1
+  AND k.tenant_id = $3
+  AND u.day > (now() AT TIME ZONE 'UTC')::date - $2::int
+ORDER BY u.day DESC;
+`
+	rows, err := r.db.QueryContext(ctx, q, id, days, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.APIKeyUsage, 0, days)
+	for rows.Next() {
+		var u model.APIKeyUsage
+		if err := rows.Scan(&u.Day, &u.Requests); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// AuditFilter narrows GET /admin/audit; zero values are ignored.
+// Results are newest first; BeforeID continues from the last page.
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	ActorID    string
+	From       time.Time
+	To         time.Time
+	BeforeID   int64
+	Limit      int
+}
+
+// List returns entries of the current tenant; system-wide entries (no
+// tenant) are not listed.
+func (r *AuditRepository) List(ctx context.Context, f AuditFilter) ([]model.AuditEntry, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT
+  id, occurred_at, actor_type, COALESCE(actor_id, ''), action, entity_type, entity_id,
+  COALESCE(before, 'null'::jsonb), COALESCE(after, 'null'::jsonb), diff, request_id
+FROM audit_log
+WHERE tenant_id = $8
+  AND ($1 = '' OR entity_type = $1)
+  AND ($2 = '' OR entity_id = $2)
+  AND ($3 = '' OR actor_id = $3)
+  AND ($4::timestamptz IS NULL OR occurred_at >= $4)
+  AND ($5::timestamptz IS NULL OR occurred_at < $5)
+  AND ($6 = 0 OR id < $6)
+ORDER BY id DESC
+LIMIT $7;
+`
+	rows, err := db.QueryContext(ctx, q,
+		f.EntityType, f.EntityID, f.ActorID, nullTime(f.From), nullTime(f.To), f.BeforeID, f.Limit, tid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.AuditEntry, 0, f.Limit)
+	for rows.Next() {
+		var (
+			e                   model.AuditEntry
+			before, after, diff []byte
+			reqID               sql.NullString
+		)
+		if err := rows.Scan(
+			&e.ID,
+			&e.OccurredAt,
+			&e.Actor.Type,
+			&e.Actor.ID,
+			&e.Action,
+			&e.EntityType,
+			&e.EntityID,
+			&before,
+			&after,
+			&diff,
+			&reqID,
+		); err != nil {
+			return nil, err
+		}
+		e.Before, e.After, e.Diff = before, after, diff
+		e.RequestID = nullString(reqID)
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Purge deletes entries of every tenant older than cutoff and returns how
+// many were removed.
+func (r *AuditRepository) Purge(ctx context.Context, cutoff time.Time) (int64, error) {
+	tx, err := beginTxAs(ctx, r.db, allTenants, &sql.TxOptions{})
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM audit_log WHERE occurred_at < $1;`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+)
+
+// notifyAvailability tells availability streams and timetable sockets on
+// every replica that the slots or orders of branchID on date changed. Postgres delivers it on commit only, and
+// once per transaction however often it is sent.
+func notifyAvailability(ctx context.Context, tx *sql.Tx, branchID int64, date string) error {
+	payload, err := json.Marshal(availability.Change{BranchID: branchID, Date: date})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2);`, availability.Channel, string(payload))
+	return err
+}
@@ -3,10 +3,20 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
 	"github.com/idlistic/go-backend-api-sample/internal/model"
 )
 
+var (
+	ErrBranchNotFound  = errors.New("branch not found")
+	ErrBranchNameTaken = errors.New("branch name already exists")
+	ErrBranchInactive  = errors.New("branch is inactive")
+)
+
 type BranchRepository struct {
 	db *sql.DB
 }
@@ -15,14 +25,83 @@ func NewBranchRepository(db *sql.DB) *BranchRepository {
 	return &BranchRepository{db: db}
 }
 
-func (r *BranchRepository) List(ctx context.Context) ([]model.Branch, error) {
+// BranchUpdate holds the fields to change; nil means "leave as is".
+// OperatingHours, when set, replaces the whole weekly schedule.
+type BranchUpdate struct {
+	Name              *string
+	Timezone          *string
+	Address           *string
+	Phone             *string
+	OperatingHours    *[]model.OperatingHours
+	BookingPolicy     *model.BookingPolicy
+	CancelPolicy      *model.CancelPolicy
+	ReliabilityPolicy *model.ReliabilityPolicy
+	NoOverlap         *bool
+}
+
+const branchColumns = `id, name, timezone, address, phone, is_active,
+  min_lead_minutes, max_advance_days, customer_cancel_deadline_minutes, staff_cancel_deadline_minutes,
+  reliability_window_days, late_cancel_minutes, confirm_threshold, confirm_deadline_minutes, block_threshold,
+  no_overlap, archived_at, created_at, updated_at`
+
+func scanBranch(row interface{ Scan(...any) error }, b *model.Branch) error {
+	var (
+		archivedAt         sql.NullTime
+		confirmAt, blockAt sql.NullInt64
+	)
+	if err := row.Scan(
+		&b.ID,
+		&b.Name,
+		&b.Timezone,
+		&b.Address,
+		&b.Phone,
+		&b.IsActive,
+		&b.BookingPolicy.MinLeadMinutes,
+		&b.BookingPolicy.MaxAdvanceDays,
+		&b.CancelPolicy.CustomerDeadlineMinutes,
+		&b.CancelPolicy.StaffDeadlineMinutes,
+		&b.ReliabilityPolicy.WindowDays,
+		&b.ReliabilityPolicy.LateCancelMinutes,
+		&confirmAt,
+		&b.ReliabilityPolicy.ConfirmDeadlineMinutes,
+		&blockAt,
+		&b.NoOverlap,
+		&archivedAt,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	b.ReliabilityPolicy.ConfirmThreshold = nullInt(confirmAt)
+	b.ReliabilityPolicy.BlockThreshold = nullInt(blockAt)
+	b.ArchivedAt = nil
+	if archivedAt.Valid {
+		t := archivedAt.Time
+		b.ArchivedAt = &t
+	}
+	return nil
+}
+
+func (r *BranchRepository) List(ctx context.Context, includeArchived bool) ([]model.Branch, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	const q = `
-SELECT id, name, created_at
+SELECT ` + branchColumns + `
 FROM branches
+WHERE tenant_id = $1
+  AND ($2 OR archived_at IS NULL)
 ORDER BY id ASC;
 `
 
-	rows, err := r.db.QueryContext(ctx, q)
+	rows, err := db.QueryContext(ctx, q, tid, includeArchived)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +110,7 @@ ORDER BY id ASC;
 	out := make([]model.Branch, 0, 16)
 	for rows.Next() {
 		var b model.Branch
-		if err := rows.Scan(&b.ID, &b.Name, &b.CreatedAt); err != nil {
+		if err := scanBranch(rows, &b); err != nil {
 			return nil, err
 		}
 		out = append(out, b)
@@ -40,5 +119,341 @@ ORDER BY id ASC;
 		return nil, err
 	}
 
+	if err := attachOperatingHours(ctx, db, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *BranchRepository) Get(ctx context.Context, id int64) (model.Branch, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	defer done()
+
+	return getBranch(ctx, db, tid, id, false)
+}
+
+// Location returns the time zone of a branch.
+func (r *BranchRepository) Location(ctx context.Context, id int64) (*time.Location, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var tz string
+	err = db.QueryRowContext(ctx, `SELECT timezone FROM branches WHERE id = $1 AND tenant_id = $2;`, id, tid).Scan(&tz)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrBranchNotFound
+		}
+		return nil, err
+	}
+	return loadLocation(tz)
+}
+
+func (r *BranchRepository) Create(ctx context.Context, actor model.Actor, b model.Branch) (model.Branch, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const insertQ = `
+INSERT INTO branches (
+  tenant_id, name, timezone, address, phone, min_lead_minutes, max_advance_days,
+  customer_cancel_deadline_minutes, staff_cancel_deadline_minutes,
+  reliability_window_days, late_cancel_minutes, confirm_threshold, confirm_deadline_minutes, block_threshold,
+  no_overlap
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+RETURNING ` + branchColumns + `;
+`
+	var out model.Branch
+	if err := scanBranch(tx.QueryRowContext(ctx, insertQ,
+		tid, b.Name, b.Timezone, b.Address, b.Phone, b.BookingPolicy.MinLeadMinutes, b.BookingPolicy.MaxAdvanceDays,
+		b.CancelPolicy.CustomerDeadlineMinutes, b.CancelPolicy.StaffDeadlineMinutes,
+		b.ReliabilityPolicy.WindowDays, b.ReliabilityPolicy.LateCancelMinutes, b.ReliabilityPolicy.ConfirmThreshold,
+		b.ReliabilityPolicy.ConfirmDeadlineMinutes, b.ReliabilityPolicy.BlockThreshold,
+		b.NoOverlap,
+	), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_branches_name") {
+			return model.Branch{}, ErrBranchNameTaken
+		}
+		return model.Branch{}, err
+	}
+
+	if err := replaceOperatingHours(ctx, tx, out.ID, b.OperatingHours); err != nil {
+		return model.Branch{}, err
+	}
+	out.OperatingHours = b.OperatingHours
+	if out.OperatingHours == nil {
+		out.OperatingHours = []model.OperatingHours{} // [] rather than null, as when read back
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "branch.create",
+		EntityType: audit.EntityBranch,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		After:      out,
+	}); err != nil {
+		return model.Branch{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Branch{}, err
+	}
+	return out, nil
+}
+
+func (r *BranchRepository) Update(ctx context.Context, actor model.Actor, id int64, u BranchUpdate) (model.Branch, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	cur, err := getBranch(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	before := cur
+
+	if u.Name != nil {
+		cur.Name = *u.Name
+	}
+	if u.Timezone != nil {
+		cur.Timezone = *u.Timezone
+	}
+	if u.Address != nil {
+		cur.Address = *u.Address
+	}
+	if u.Phone != nil {
+		cur.Phone = *u.Phone
+	}
+	if u.BookingPolicy != nil {
+		cur.BookingPolicy = *u.BookingPolicy
+	}
+	if u.CancelPolicy != nil {
+		cur.CancelPolicy = *u.CancelPolicy
+	}
+	if u.ReliabilityPolicy != nil {
+		cur.ReliabilityPolicy = *u.ReliabilityPolicy
+	}
+	if u.NoOverlap != nil && *u.NoOverlap != cur.NoOverlap {
+		if err := setNoOverlap(ctx, tx, cur, *u.NoOverlap); err != nil {
+			return model.Branch{}, err
+		}
+		cur.NoOverlap = *u.NoOverlap
+	}
+
+	const updateQ = `
+UPDATE branches
+SET name = $2,
+    timezone = $3,
+    address = $4,
+    phone = $5,
+    min_lead_minutes = $6,
+    max_advance_days = $7,
+    customer_cancel_deadline_minutes = $8,
+    staff_cancel_deadline_minutes = $9,
+    reliability_window_days = $10,
+    late_cancel_minutes = $11,
+    confirm_threshold = $12,
+    confirm_deadline_minutes = $13,
+    block_threshold = $14,
+    no_overlap = $15,
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + branchColumns + `;
+`
+	var out model.Branch
+	if err := scanBranch(tx.QueryRowContext(ctx, updateQ,
+		id, cur.Name, cur.Timezone, cur.Address, cur.Phone, cur.BookingPolicy.MinLeadMinutes, cur.BookingPolicy.MaxAdvanceDays,
+		cur.CancelPolicy.CustomerDeadlineMinutes, cur.CancelPolicy.StaffDeadlineMinutes,
+		cur.ReliabilityPolicy.WindowDays, cur.ReliabilityPolicy.LateCancelMinutes, cur.ReliabilityPolicy.ConfirmThreshold,
+		cur.ReliabilityPolicy.ConfirmDeadlineMinutes, cur.ReliabilityPolicy.BlockThreshold,
+		cur.NoOverlap,
+	), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_branches_name") {
+			return model.Branch{}, ErrBranchNameTaken
+		}
+		return model.Branch{}, err
+	}
+
+	out.OperatingHours = cur.OperatingHours
+	if u.OperatingHours != nil {
+		if err := replaceOperatingHours(ctx, tx, id, *u.OperatingHours); err != nil {
+			return model.Branch{}, err
+		}
+		out.OperatingHours = *u.OperatingHours
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "branch.update",
+		EntityType: audit.EntityBranch,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Branch{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Branch{}, err
+	}
+	return out, nil
+}
+
+// Archive deactivates a branch. Existing timeslots and orders are kept, but
+// the branch no longer accepts bookings and is hidden from the default listing.
+func (r *BranchRepository) Archive(ctx context.Context, actor model.Actor, id int64) (model.Branch, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Branch{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	before, err := getBranch(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.Branch{}, err
+	}
+
+	const q = `
+UPDATE branches
+SET is_active = FALSE,
+    archived_at = COALESCE(archived_at, now()),
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + branchColumns + `;
+`
+	var out model.Branch
+	if err := scanBranch(tx.QueryRowContext(ctx, q, id), &out); err != nil {
+		return model.Branch{}, err
+	}
+	out.OperatingHours = before.OperatingHours
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "branch.archive",
+		EntityType: audit.EntityBranch,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Branch{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Branch{}, err
+	}
 	return out, nil
 }
+
+// getBranch reads a branch of tenant tenantID; other tenants' branches are
+// not found.
+func getBranch(ctx context.Context, q queryer, tenantID, id int64, forUpdate bool) (model.Branch, error) {
+	query := `
+SELECT ` + branchColumns + `
+FROM branches
+WHERE id = $1 AND tenant_id = $2`
+	if forUpdate {
+		query += `
+FOR UPDATE`
+	}
+
+	var b model.Branch
+	if err := scanBranch(q.QueryRowContext(ctx, query, id, tenantID), &b); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Branch{}, ErrBranchNotFound
+		}
+		return model.Branch{}, err
+	}
+
+	items := []model.Branch{b}
+	if err := attachOperatingHours(ctx, q, items); err != nil {
+		return model.Branch{}, err
+	}
+	return items[0], nil
+}
+
+// attachOperatingHours loads the weekly schedule for every branch in one query.
+func attachOperatingHours(ctx context.Context, q queryer, branches []model.Branch) error {
+	if len(branches) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(branches))
+	indexByID := make(map[int64]int, len(branches))
+	for i := range branches {
+		ids[i] = branches[i].ID
+		indexByID[branches[i].ID] = i
+		branches[i].OperatingHours = make([]model.OperatingHours, 0, 7)
+	}
+
+	const hoursQ = `
+SELECT branch_id, weekday, to_char(open_time, 'HH24:MI'), to_char(close_time, 'HH24:MI')
+FROM branch_operating_hours
+WHERE branch_id = ANY($1)
+ORDER BY branch_id ASC, weekday ASC;
+`
+	rows, err := q.QueryContext(ctx, hoursQ, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			branchID int64
+			h        model.OperatingHours
+		)
+		if err := rows.Scan(&branchID, &h.Weekday, &h.OpenTime, &h.CloseTime); err != nil {
+			return err
+		}
+		pos := indexByID[branchID]
+		branches[pos].OperatingHours = append(branches[pos].OperatingHours, h)
+	}
+	return rows.Err()
+}
+
+func replaceOperatingHours(ctx context.Context, tx *sql.Tx, branchID int64, hours []model.OperatingHours) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM branch_operating_hours WHERE branch_id = $1;`, branchID); err != nil {
+		return err
+	}
+
+	const insertQ = `
+INSERT INTO branch_operating_hours (branch_id, weekday, open_time, close_time)
+VALUES ($1, $2, $3::time, $4::time);
+`
+	for _, h := range hours {
+		if _, err := tx.ExecContext(ctx, insertQ, branchID, int(h.Weekday), h.OpenTime, h.CloseTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+var ErrCalendarTokenInvalid = errors.New("calendar feed token invalid")
+
+// calendarEntryQ reads orders for calendar events; callers add the WHERE
+// clause (o/t/b aliases) and ordering.
+const calendarEntryQ = `
+SELECT ` + orderColumnsO + `,
+  t.service_date::text, t.start_time::text, t.end_time::text, b.timezone,
+  b.name, b.address,
+  (SELECT count(*) FROM order_events e
+   WHERE e.order_id = o.id AND e.event_type IN ('rescheduled', 'cancelled', 'confirmed'))
+FROM orders o
+JOIN timeslots t
+  ON t.id = o.timeslot_id
+ AND t.branch_id = o.branch_id
+JOIN branches b ON b.id = o.branch_id
+`
+
+func scanCalendarEntry(row interface{ Scan(...any) error }, e *model.OrderCalendarEntry) error {
+	var slot slotClock
+	if err := scanOrder(row, &e.Order,
+		&slot.date, &slot.start, &slot.end, &slot.tz,
+		&e.BranchName, &e.BranchAddress, &e.Sequence,
+	); err != nil {
+		return err
+	}
+	e.Timezone = slot.tz
+	return slot.apply(&e.Order)
+}
+
+// CalendarEntry returns one order for its .ics download. Customers may only
+// read their own orders.
+func (r *OrderRepository) CalendarEntry(ctx context.Context, actor model.Actor, orderID int64) (model.OrderCalendarEntry, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.OrderCalendarEntry{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.OrderCalendarEntry{}, err
+	}
+	defer done()
+
+	var e model.OrderCalendarEntry
+	err = scanCalendarEntry(db.QueryRowContext(ctx, calendarEntryQ+`
+WHERE o.id = $1 AND b.tenant_id = $2;`, orderID, tid), &e)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.OrderCalendarEntry{}, ErrOrderNotFound
+		}
+		return model.OrderCalendarEntry{}, err
+	}
+	if err := checkOwnership(actor, e.Order); err != nil {
+		return model.OrderCalendarEntry{}, err
+	}
+	return e, nil
+}
+
+// CalendarEntries returns the orders of a branch between two branch-local
+// dates (inclusive), cancelled ones included so feeds can withdraw them.
+func (r *OrderRepository) CalendarEntries(ctx context.Context, branchID int64, from, to string) ([]model.OrderCalendarEntry, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	rows, err := db.QueryContext(ctx, calendarEntryQ+`
+WHERE o.branch_id = $1
+  AND t.service_date BETWEEN $2::date AND $3::date
+  AND b.tenant_id = $4
+ORDER BY t.service_date ASC, t.start_time ASC, o.id ASC;`, branchID, from, to, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.OrderCalendarEntry, 0, 64)
+	for rows.Next() {
+		var e model.OrderCalendarEntry
+		if err := scanCalendarEntry(rows, &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// generateCalendarToken returns a new feed token. Like API keys it is a
+// 256-bit random value, stored only as a sha256 hash.
+func generateCalendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "cal_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashCalendarToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// IssueCalendarToken creates the branch's feed token, replacing (and so
+// revoking) any previous one. The token is returned only here.
+func (r *BranchRepository) IssueCalendarToken(ctx context.Context, actor model.Actor, branchID int64) (string, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return "", err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := getBranch(ctx, tx, tid, branchID, true); err != nil {
+		return "", err
+	}
+
+	token, err := generateCalendarToken()
+	if err != nil {
+		return "", err
+	}
+	const q = `
+INSERT INTO branch_calendar_feeds (branch_id, token_hash, created_by)
+VALUES ($1, $2, NULLIF($3, ''))
+ON CONFLICT (branch_id) DO UPDATE
+SET token_hash = EXCLUDED.token_hash,
+    created_by = EXCLUDED.created_by,
+    created_at = now(),
+    last_used_at = NULL;
+`
+	if _, err := tx.ExecContext(ctx, q, branchID, hashCalendarToken(token), actor.ID); err != nil {
+		return "", err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "branch.calendar_token_issue",
+		EntityType: audit.EntityBranch,
+		EntityID:   strconv.FormatInt(branchID, 10),
+	}); err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeCalendarToken disables the branch's feed; revoking a branch without
+// one is a no-op.
+func (r *BranchRepository) RevokeCalendarToken(ctx context.Context, actor model.Actor, branchID int64) error {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := getBranch(ctx, tx, tid, branchID, true); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM branch_calendar_feeds WHERE branch_id = $1;`, branchID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		if err := audit.Record(ctx, tx, audit.Entry{
+			Actor:      actor,
+			Action:     "branch.calendar_token_revoke",
+			EntityType: audit.EntityBranch,
+			EntityID:   strconv.FormatInt(branchID, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CheckCalendarToken verifies a feed token of the branch and records its use.
+func (r *BranchRepository) CheckCalendarToken(ctx context.Context, branchID int64, token string) error {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const q = `
+UPDATE branch_calendar_feeds f
+SET last_used_at = now()
+FROM branches b
+WHERE f.branch_id = $1
+  AND f.token_hash = $2
+  AND b.id = f.branch_id
+  AND b.tenant_id = $3;
+`
+	res, err := tx.ExecContext(ctx, q, branchID, hashCalendarToken(token), tid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCalendarTokenInvalid
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+// EachInRange calls fn for every order of a branch whose slot lies between
+// two branch-local dates (inclusive), in slot order. Rows are handed over as
+// they are read, so exports of any size run in constant memory; an error from
+// fn stops the iteration and is returned.
+func (r *OrderRepository) EachInRange(
+	ctx context.Context,
+	branchID int64,
+	from, to string, // YYYY-MM-DD
+	fn func(model.Order) error,
+) error {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	const q = `
+SELECT
+  ` + orderColumnsO + `,
+  t.service_date::text, t.start_time::text, t.end_time::text, b.timezone
+FROM orders o
+JOIN timeslots t
+  ON t.id = o.timeslot_id
+ AND t.branch_id = o.branch_id
+JOIN branches b ON b.id = o.branch_id
+WHERE o.branch_id = $1
+  AND t.service_date BETWEEN $2::date AND $3::date
+  AND b.tenant_id = $4
+ORDER BY t.service_date ASC, t.start_time ASC, o.created_at ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, tid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			o    model.Order
+			slot slotClock
+		)
+		if err := scanOrder(rows, &o, &slot.date, &slot.start, &slot.end, &slot.tz); err != nil {
+			return err
+		}
+		if err := slot.apply(&o); err != nil {
+			return err
+		}
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EachInRange calls fn for every slot of a branch between two branch-local
+// dates (inclusive) and each of its active orders, in timetable order. A slot
+// without orders is passed once with a nil order; orders only carry id,
+// customer name, status and timestamps. Like OrderRepository.EachInRange it
+// streams.
+func (r *TimetableRepository) EachInRange(
+	ctx context.Context,
+	branchID int64,
+	from, to string, // YYYY-MM-DD
+	fn func(model.Timeslot, *model.Order) error,
+) error {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	const q = `
+SELECT
+  t.id, t.service_date::text, t.start_time::text, t.end_time::text,
+  t.capacity, t.reserved, t.is_active, b.timezone,
+  o.id, o.customer_name, o.status, o.created_at, o.checked_in_at
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+LEFT JOIN orders o
+  ON (o.timeslot_id = t.id
+      OR o.id IN (SELECT ot.order_id FROM order_timeslots ot WHERE ot.timeslot_id = t.id))
+ AND o.branch_id = t.branch_id
+ AND o.status IN ('created', 'unconfirmed', 'checked_in', 'no_show')
+WHERE t.branch_id = $1
+  AND t.service_date BETWEEN $2::date AND $3::date
+  AND b.tenant_id = $4
+ORDER BY t.service_date ASC, t.start_time ASC, o.created_at ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, from, to, tid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			t            model.Timeslot
+			tz           string
+			orderID      sql.NullInt64
+			customerName sql.NullString
+			status       sql.NullString
+			createdAt    sql.NullTime
+			checkedInAt  sql.NullTime
+		)
+		if err := rows.Scan(
+			&t.ID, &t.ServiceDate, &t.StartTime, &t.EndTime,
+			&t.Capacity, &t.Reserved, &t.IsActive, &tz,
+			&orderID, &customerName, &status, &createdAt, &checkedInAt,
+		); err != nil {
+			return err
+		}
+		t.BranchID = branchID
+		if t.StartsAt, t.EndsAt, err = slotInstants(tz, t.ServiceDate, t.StartTime, t.EndTime); err != nil {
+			return err
+		}
+
+		var o *model.Order
+		if orderID.Valid {
+			o = &model.Order{
+				ID:           orderID.Int64,
+				BranchID:     branchID,
+				TimeslotID:   t.ID,
+				CustomerName: customerName.String,
+				Status:       status.String,
+				StartsAt:     t.StartsAt,
+				EndsAt:       t.EndsAt,
+				CreatedAt:    createdAt.Time,
+			}
+			if checkedInAt.Valid {
+				o.CheckedInAt = &checkedInAt.Time
+			}
+		}
+		if err := fn(t, o); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/requestid"
+)
+
+// orderEvent is what the write paths record; nil pointers are stored as NULL.
+type orderEvent struct {
+	orderID       int64
+	typ           model.OrderEventType
+	actor         model.Actor
+	oldStatus     string // "" for creation
+	newStatus     string
+	oldTimeslotID int64 // 0 = none
+	newTimeslotID int64
+	reason        string
+	note          string
+}
+
+// insertOrderEvent appends to order_events inside the caller's transaction,
+// so the history can never disagree with the order row.
+func insertOrderEvent(ctx context.Context, tx *sql.Tx, e orderEvent) error {
+	const q = `
+INSERT INTO order_events (
+  order_id, event_type, actor_type, actor_id,
+  old_status, new_status, old_timeslot_id, new_timeslot_id,
+  reason, note, request_id
+)
+VALUES (
+  $1, $2, $3, NULLIF($4, ''),
+  NULLIF($5, '')::order_status, $6::order_status, NULLIF($7, 0), NULLIF($8, 0),
+  NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, '')
+);
+`
+	_, err := tx.ExecContext(ctx, q,
+		e.orderID, string(e.typ), string(e.actor.Type), e.actor.ID,
+		e.oldStatus, e.newStatus, e.oldTimeslotID, e.newTimeslotID,
+		e.reason, e.note, requestid.FromContext(ctx),
+	)
+	return err
+}
+
+// History returns the events of an order, oldest first. Customers may only
+// read the history of their own orders.
+func (r *OrderRepository) History(ctx context.Context, actor model.Actor, orderID int64) ([]model.OrderEvent, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const ownerQ = `
+SELECT o.customer_id
+FROM orders o
+JOIN branches b ON b.id = o.branch_id
+WHERE o.id = $1 AND b.tenant_id = $2;
+`
+	var customerID sql.NullString
+	err = db.QueryRowContext(ctx, ownerQ, orderID, tid).Scan(&customerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	if err := checkOwnership(actor, model.Order{CustomerID: nullString(customerID)}); err != nil {
+		return nil, err
+	}
+
+	const q = `
+SELECT
+  id, order_id, event_type, actor_type, COALESCE(actor_id, ''),
+  old_status::text, new_status::text, old_timeslot_id, new_timeslot_id,
+  reason, note, request_id, created_at
+FROM order_events
+WHERE order_id = $1
+ORDER BY id ASC;
+`
+	rows, err := db.QueryContext(ctx, q, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.OrderEvent, 0, 4)
+	for rows.Next() {
+		var (
+			e                   model.OrderEvent
+			oldStatus           sql.NullString
+			oldSlot, newSlot    sql.NullInt64
+			reason, note, reqID sql.NullString
+		)
+		if err := rows.Scan(
+			&e.ID,
+			&e.OrderID,
+			&e.Type,
+			&e.Actor.Type,
+			&e.Actor.ID,
+			&oldStatus,
+			&e.NewStatus,
+			&oldSlot,
+			&newSlot,
+			&reason,
+			&note,
+			&reqID,
+			&e.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		e.OldStatus = nullString(oldStatus)
+		e.OldTimeslotID = nullInt64(oldSlot)
+		e.NewTimeslotID = nullInt64(newSlot)
+		e.Reason = nullString(reason)
+		e.Note = nullString(note)
+		e.RequestID = nullString(reqID)
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func nullString(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
+
+func nullInt64(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
+
+func timePtr(v sql.NullTime) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Time
+}
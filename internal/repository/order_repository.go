@@ -4,8 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
 	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/webhook"
 )
 
 var (
@@ -14,6 +19,15 @@ var (
 	ErrTimeslotFullyBooked = errors.New("timeslot is fully booked")
 	ErrOrderNotFound       = errors.New("order not found")
 	ErrOrderNotCancellable = errors.New("order is not cancellable")
+
+	ErrBookingWindowClosed    = errors.New("booking window closed")
+	ErrBookingTooFarInAdvance = errors.New("booking too far in advance")
+
+	ErrCancellationDeadlinePassed = errors.New("cancellation deadline passed")
+	ErrOrderNotReschedulable      = errors.New("order is not reschedulable")
+	ErrRescheduleSameTimeslot     = errors.New("order is already in this timeslot")
+	ErrOrderNotOwned              = errors.New("order belongs to another customer")
+	ErrOrderNotCheckable          = errors.New("order cannot be checked in")
 )
 
 type OrderRepository struct {
@@ -24,32 +38,156 @@ func NewOrderRepository(db *sql.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
+// RescheduleRequest carries who moves an order and why.
+type RescheduleRequest struct {
+	Actor model.Actor
+	Note  string
+}
+
+// CancelRequest carries who cancels an order and why.
+type CancelRequest struct {
+	Actor  model.Actor
+	Reason model.CancelReason
+	Note   string
+}
+
+// orderColumns lists the columns read by scanOrder; orderColumnsO is the same
+// list qualified with the "o" alias for joins.
+const (
+	orderColumns = `id, branch_id, timeslot_id, resource_id, service_id, duration_minutes,
+  customer_id, customer_name, status,
+  cancel_reason, cancel_note, cancelled_at, cancelled_by_type, cancelled_by_id,
+  checked_in_at, no_show_at, confirmed_at, created_at, updated_at`
+	orderColumnsO = `o.id, o.branch_id, o.timeslot_id, o.resource_id, o.service_id, o.duration_minutes,
+  o.customer_id, o.customer_name, o.status,
+  o.cancel_reason, o.cancel_note, o.cancelled_at, o.cancelled_by_type, o.cancelled_by_id,
+  o.checked_in_at, o.no_show_at, o.confirmed_at, o.created_at, o.updated_at`
+)
+
+// lockOrderQ locks an order of tenant $2 for a status change.
+const lockOrderQ = `
+SELECT ` + orderColumnsO + `
+FROM orders o
+JOIN branches b ON b.id = o.branch_id
+WHERE o.id = $1 AND b.tenant_id = $2
+FOR UPDATE OF o;
+`
+
+// scanOrder scans orderColumns followed by any extra destinations.
+func scanOrder(row interface{ Scan(...any) error }, o *model.Order, extra ...any) error {
+	var (
+		resourceID  sql.NullInt64
+		serviceID   sql.NullInt64
+		duration    sql.NullInt64
+		customerID  sql.NullString
+		reason      sql.NullString
+		note        sql.NullString
+		cancelledAt sql.NullTime
+		byType      sql.NullString
+		byID        sql.NullString
+		checkedInAt sql.NullTime
+		noShowAt    sql.NullTime
+		confirmedAt sql.NullTime
+	)
+	dest := append([]any{
+		&o.ID,
+		&o.BranchID,
+		&o.TimeslotID,
+		&resourceID,
+		&serviceID,
+		&duration,
+		&customerID,
+		&o.CustomerName,
+		&o.Status,
+		&reason,
+		&note,
+		&cancelledAt,
+		&byType,
+		&byID,
+		&checkedInAt,
+		&noShowAt,
+		&confirmedAt,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	o.ResourceID = nullInt64(resourceID)
+	o.ServiceID = nullInt64(serviceID)
+	o.DurationMinutes = nullInt(duration)
+	o.CustomerID = nullString(customerID)
+	o.CancelReason, o.CancelNote, o.CancelledAt, o.CancelledBy = nil, nil, nil, nil
+	o.CheckedInAt, o.NoShowAt, o.ConfirmedAt = nil, nil, nil
+	if reason.Valid {
+		cr := model.CancelReason(reason.String)
+		o.CancelReason = &cr
+	}
+	if note.Valid {
+		o.CancelNote = &note.String
+	}
+	if cancelledAt.Valid {
+		o.CancelledAt = &cancelledAt.Time
+	}
+	if byType.Valid {
+		o.CancelledBy = &model.Actor{Type: model.ActorType(byType.String), ID: byID.String}
+	}
+	if checkedInAt.Valid {
+		o.CheckedInAt = &checkedInAt.Time
+	}
+	o.NoShowAt = timePtr(noShowAt)
+	o.ConfirmedAt = timePtr(confirmedAt)
+	return nil
+}
+
 func (r *OrderRepository) CreateWithTimeslotReservation(
 	ctx context.Context,
+	actor model.Actor,
 	branchID int64,
 	timeslotID int64,
+	resourceID int64, // 0 = any resource of the slot
+	serviceID int64, // 0 = book the slot itself
 	customerName string,
 ) (model.Order, error) {
 
-	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{
-		// PostgreSQL default is Read Committed; fine for this flow when we lock the row
-	})
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Order{}, err
+	}
+	// PostgreSQL default is Read Committed; fine for this flow when we lock the row
+	tx, err := beginTx(ctx, r.db, tid)
 	if err != nil {
 		return model.Order{}, err
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	// 1) Lock the timeslot row
+	// 1) Lock the timeslot row (branch row is only read, archived branches take no bookings)
 	var capacity, reserved int
-	var isActive bool
+	var isActive, branchActive bool
+	var slot slotClock
+	var policy model.BookingPolicy
+	var reliability model.ReliabilityPolicy
+	var confirmAt, blockAt sql.NullInt64
 
 	const lockQ = `
-SELECT capacity, reserved, is_active
-FROM timeslots
-WHERE id = $1 AND branch_id = $2
-FOR UPDATE;
+SELECT t.capacity, t.reserved, t.is_active, b.is_active,
+       t.service_date::text, t.start_time::text, t.end_time::text, b.timezone,
+       b.min_lead_minutes, b.max_advance_days,
+       b.reliability_window_days, b.late_cancel_minutes, b.confirm_threshold,
+       b.confirm_deadline_minutes, b.block_threshold
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+WHERE t.id = $1 AND t.branch_id = $2 AND b.tenant_id = $3
+FOR UPDATE OF t;
 `
-	err = tx.QueryRowContext(ctx, lockQ, timeslotID, branchID).Scan(&capacity, &reserved, &isActive)
+	err = tx.QueryRowContext(ctx, lockQ, timeslotID, branchID, tid).Scan(
+		&capacity, &reserved, &isActive, &branchActive,
+		&slot.date, &slot.start, &slot.end, &slot.tz,
+		&policy.MinLeadMinutes, &policy.MaxAdvanceDays,
+		&reliability.WindowDays, &reliability.LateCancelMinutes, &confirmAt,
+		&reliability.ConfirmDeadlineMinutes, &blockAt,
+	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.Order{}, ErrTimeslotNotFound
@@ -57,40 +195,141 @@ FOR UPDATE;
 		return model.Order{}, err
 	}
 
+	if !branchActive {
+		return model.Order{}, ErrBranchInactive
+	}
 	if !isActive {
 		return model.Order{}, ErrTimeslotInactive
 	}
+	now := time.Now()
+	if err := checkBookingWindow(policy, slot, now); err != nil {
+		return model.Order{}, err
+	}
 	if reserved >= capacity {
 		return model.Order{}, ErrTimeslotFullyBooked
 	}
 
-	// 2) Reserve: reserved + 1
+	// a service longer than the slot also takes a seat in the slots after it
+	chain := []int64{timeslotID}
+	var eligible []int64
+	var duration *int
+	if serviceID != 0 {
+		svc, err := getService(ctx, tx, tid, serviceID, false)
+		if err != nil {
+			return model.Order{}, err
+		}
+		if svc.BranchID != branchID {
+			return model.Order{}, ErrServiceNotFound
+		}
+		if !svc.IsActive {
+			return model.Order{}, ErrServiceInactive
+		}
+
+		slots, err := lockServiceChain(ctx, tx, branchID, slot.date, timeslotID, svc.DurationMinutes)
+		if err != nil {
+			return model.Order{}, err
+		}
+		for _, s := range slots[1:] {
+			if !s.active {
+				return model.Order{}, ErrTimeslotInactive
+			}
+			if s.reserved >= s.capacity {
+				return model.Order{}, ErrTimeslotFullyBooked
+			}
+		}
+		chain, eligible, duration = chainIDs(slots), svc.ResourceIDs, &svc.DurationMinutes
+	}
+
+	// customers with a record of no-shows may have to confirm, or may not book at all
+	status := "created"
+	reliability.ConfirmThreshold, reliability.BlockThreshold = nullInt(confirmAt), nullInt(blockAt)
+	if actor.Type == model.ActorCustomer && actor.ID != "" && reliability.Enforced() {
+		rec, err := customerReliability(ctx, tx, tid, actor.ID, reliability, now)
+		if err != nil {
+			return model.Order{}, err
+		}
+		switch rec.Standing {
+		case model.StandingBlocked:
+			return model.Order{}, ErrCustomerBlocked
+		case model.StandingNeedsConfirm:
+			if err := checkConfirmWindow(reliability, slot, now); err != nil {
+				return model.Order{}, err
+			}
+			status = "unconfirmed"
+		}
+	}
+
+	// slots with resources give every booking one that is free for the whole
+	// slot, or for the whole service
+	resourceID, err = assignResource(ctx, tx, chain, eligible, resourceID, 0)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	// 2) Reserve: reserved + 1 in every slot of the booking
 	const reserveQ = `
 UPDATE timeslots
 SET reserved = reserved + 1,
     updated_at = now()
-WHERE id = $1 AND branch_id = $2;
+WHERE id = ANY($1) AND branch_id = $2;
 `
-	if _, err := tx.ExecContext(ctx, reserveQ, timeslotID, branchID); err != nil {
+	if _, err := tx.ExecContext(ctx, reserveQ, chain, branchID); err != nil {
 		return model.Order{}, err
 	}
 
 	// 3) Create order
 	const insertQ = `
-INSERT INTO orders (branch_id, timeslot_id, customer_name, status)
-VALUES ($1, $2, $3, 'created')
-RETURNING id, branch_id, timeslot_id, customer_name, status, created_at, updated_at;
+INSERT INTO orders (branch_id, timeslot_id, customer_id, customer_name, status, resource_id,
+  service_id, duration_minutes)
+VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6::bigint, 0), NULLIF($7::bigint, 0), $8)
+RETURNING ` + orderColumns + `;
 `
+	// a customer books for themselves; staff bookings have no owner
+	var customerID string
+	if actor.Type == model.ActorCustomer {
+		customerID = actor.ID
+	}
 	var out model.Order
-	if err := tx.QueryRowContext(ctx, insertQ, branchID, timeslotID, customerName).Scan(
-		&out.ID,
-		&out.BranchID,
-		&out.TimeslotID,
-		&out.CustomerName,
-		&out.Status,
-		&out.CreatedAt,
-		&out.UpdatedAt,
-	); err != nil {
+	if err := scanOrder(tx.QueryRowContext(ctx, insertQ,
+		branchID, timeslotID, customerID, customerName, status, resourceID, serviceID, duration,
+	), &out); err != nil {
+		return model.Order{}, err
+	}
+	if err := insertOrderTimeslots(ctx, tx, out.ID, chain[1:]); err != nil {
+		return model.Order{}, err
+	}
+	if err := slot.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, orderEvent{
+		orderID:       out.ID,
+		typ:           model.OrderCreated,
+		actor:         actor,
+		newStatus:     out.Status,
+		newTimeslotID: out.TimeslotID,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "order.create",
+		EntityType: audit.EntityOrder,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		After:      out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := insertOutboxEvent(ctx, tx, outboxEvent{
+		tenantID:      tid,
+		typ:           webhook.EventOrderCreated,
+		aggregateType: audit.EntityOrder,
+		aggregateID:   strconv.FormatInt(out.ID, 10),
+		payload:       out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := notifyAvailability(ctx, tx, branchID, slot.date); err != nil {
 		return model.Order{}, err
 	}
 
@@ -102,12 +341,56 @@ RETURNING id, branch_id, timeslot_id, customer_name, status, created_at, updated
 	return out, nil
 }
 
+// checkBookingWindow applies the branch booking policy to a slot at instant now.
+// Past slots always fail, even with a zero lead time.
+func checkBookingWindow(p model.BookingPolicy, slot slotClock, now time.Time) error {
+	loc, err := loadLocation(slot.tz)
+	if err != nil {
+		return err
+	}
+	startsAt, _, err := model.LocalInstant(loc, slot.date, slot.start)
+	if err != nil {
+		return err
+	}
+
+	if !startsAt.After(now.Add(time.Duration(p.MinLeadMinutes) * time.Minute)) {
+		return ErrBookingWindowClosed
+	}
+
+	// max advance counts branch-local calendar days, so "60 days" doesn't depend on the hour of booking
+	lastDay := now.In(loc).AddDate(0, 0, p.MaxAdvanceDays).Format("2006-01-02")
+	if slot.date > lastDay {
+		return ErrBookingTooFarInAdvance
+	}
+	return nil
+}
+
+// cancellableStatuses are the statuses of orders that still hold an open booking.
+var cancellableStatuses = []string{"created", "unconfirmed"}
+
+// CancelAndReleaseTimeslot cancels an order on behalf of req.Actor, subject to
+// the branch cancellation deadline for that actor type, and frees its seat.
 func (r *OrderRepository) CancelAndReleaseTimeslot(
 	ctx context.Context,
 	orderID int64,
+	req CancelRequest,
+) (model.Order, error) {
+	return r.cancel(ctx, orderID, req, cancellableStatuses)
+}
+
+// cancel cancels an order that is in one of statuses.
+func (r *OrderRepository) cancel(
+	ctx context.Context,
+	orderID int64,
+	req CancelRequest,
+	statuses []string,
 ) (model.Order, error) {
 
-	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{})
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Order{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
 	if err != nil {
 		return model.Order{}, err
 	}
@@ -115,41 +398,45 @@ func (r *OrderRepository) CancelAndReleaseTimeslot(
 
 	// 1) Lock order row
 	var out model.Order
-	const lockOrderQ = `
-SELECT id, branch_id, timeslot_id, customer_name, status, created_at, updated_at
-FROM orders
-WHERE id = $1
-FOR UPDATE;
-`
-	if err := tx.QueryRowContext(ctx, lockOrderQ, orderID).Scan(
-		&out.ID,
-		&out.BranchID,
-		&out.TimeslotID,
-		&out.CustomerName,
-		&out.Status,
-		&out.CreatedAt,
-		&out.UpdatedAt,
-	); err != nil {
+	if err := scanOrder(tx.QueryRowContext(ctx, lockOrderQ, orderID, tid), &out); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.Order{}, ErrOrderNotFound
 		}
 		return model.Order{}, err
 	}
 
-	// only "created" can be cancelled
-	if out.Status != "created" {
+	if err := checkOwnership(req.Actor, out); err != nil {
+		return model.Order{}, err
+	}
+
+	// only orders that still hold an open booking can be cancelled
+	if !slices.Contains(statuses, out.Status) {
 		return model.Order{}, ErrOrderNotCancellable
 	}
 
-	// 2) Lock timeslot row and ensure reserved > 0
-	var reserved int
-	const lockTimeslotQ = `
-SELECT reserved
-FROM timeslots
-WHERE id = $1 AND branch_id = $2
-FOR UPDATE;
+	// 2) Lock the timeslot rows the order holds a seat in, the slots a
+	// service booking continues into included, in time order like bookings do
+	chain, err := orderSlots(ctx, tx, out)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if _, err := lockSlots(ctx, tx, out.BranchID, chain); err != nil {
+		return model.Order{}, err
+	}
+
+	var slot slotClock
+	var policy model.CancelPolicy
+	const slotQ = `
+SELECT t.service_date::text, t.start_time::text, t.end_time::text, b.timezone,
+       b.customer_cancel_deadline_minutes, b.staff_cancel_deadline_minutes
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+WHERE t.id = $1 AND t.branch_id = $2;
 `
-	if err := tx.QueryRowContext(ctx, lockTimeslotQ, out.TimeslotID, out.BranchID).Scan(&reserved); err != nil {
+	if err := tx.QueryRowContext(ctx, slotQ, out.TimeslotID, out.BranchID).Scan(
+		&slot.date, &slot.start, &slot.end, &slot.tz,
+		&policy.CustomerDeadlineMinutes, &policy.StaffDeadlineMinutes,
+	); err != nil {
 		// timeslot missing shouldn't happen in demo, but treat as not found timeslot
 		if errors.Is(err, sql.ErrNoRows) {
 			return model.Order{}, ErrTimeslotNotFound
@@ -157,30 +444,87 @@ FOR UPDATE;
 		return model.Order{}, err
 	}
 
+	if err := slot.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+	if err := checkCancelDeadline(policy, req.Actor, out.StartsAt, time.Now()); err != nil {
+		return model.Order{}, err
+	}
+	before := out
+
 	// 3) Update order -> cancelled
+	var note sql.NullString
+	if req.Note != "" {
+		note = sql.NullString{String: req.Note, Valid: true}
+	}
 	const cancelOrderQ = `
 UPDATE orders
 SET status = 'cancelled',
+    cancel_reason = $2,
+    cancel_note = $3,
+    cancelled_at = now(),
+    cancelled_by_type = $4,
+    cancelled_by_id = NULLIF($5, ''),
     updated_at = now()
-WHERE id = $1;
+WHERE id = $1
+RETURNING ` + orderColumns + `;
 `
-	if _, err := tx.ExecContext(ctx, cancelOrderQ, orderID); err != nil {
+	if err := scanOrder(tx.QueryRowContext(ctx, cancelOrderQ,
+		orderID, string(req.Reason), note, string(req.Actor.Type), req.Actor.ID,
+	), &out); err != nil {
 		return model.Order{}, err
 	}
 
-	// 4) Release reserved (guard: never below 0)
+	// 4) Release reserved (guard: never below 0) in the whole chain
 	const releaseQ = `
 UPDATE timeslots
 SET reserved = CASE WHEN reserved > 0 THEN reserved - 1 ELSE 0 END,
     updated_at = now()
-WHERE id = $1 AND branch_id = $2;
+WHERE id = ANY($1) AND branch_id = $2;
 `
-	if _, err := tx.ExecContext(ctx, releaseQ, out.TimeslotID, out.BranchID); err != nil {
+	if _, err := tx.ExecContext(ctx, releaseQ, chain, out.BranchID); err != nil {
 		return model.Order{}, err
 	}
 
-	// refresh order status in response
-	out.Status = "cancelled"
+	// RETURNING reset the computed fields
+	if err := slot.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, orderEvent{
+		orderID:       out.ID,
+		typ:           model.OrderCancelled,
+		actor:         req.Actor,
+		oldStatus:     before.Status,
+		newStatus:     out.Status,
+		oldTimeslotID: out.TimeslotID,
+		reason:        string(req.Reason),
+		note:          req.Note,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      req.Actor,
+		Action:     "order.cancel",
+		EntityType: audit.EntityOrder,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := insertOutboxEvent(ctx, tx, outboxEvent{
+		tenantID:      tid,
+		typ:           webhook.EventOrderCancelled,
+		aggregateType: audit.EntityOrder,
+		aggregateID:   strconv.FormatInt(out.ID, 10),
+		payload:       out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := notifyAvailability(ctx, tx, out.BranchID, slot.date); err != nil {
+		return model.Order{}, err
+	}
 
 	if err := tx.Commit(); err != nil {
 		return model.Order{}, err
@@ -189,26 +533,417 @@ WHERE id = $1 AND branch_id = $2;
 	return out, nil
 }
 
+// checkOwnership lets customers act only on their own orders. Staff and
+// system actors are not restricted here.
+func checkOwnership(actor model.Actor, o model.Order) error {
+	if actor.Type != model.ActorCustomer {
+		return nil
+	}
+	if o.CustomerID == nil || actor.ID == "" || *o.CustomerID != actor.ID {
+		return ErrOrderNotOwned
+	}
+	return nil
+}
+
+// checkCancelDeadline applies the branch cancellation policy for the actor's type.
+func checkCancelDeadline(p model.CancelPolicy, actor model.Actor, startsAt, now time.Time) error {
+	minutes, restricted := p.DeadlineFor(actor.Type)
+	if !restricted {
+		return nil
+	}
+	if !now.Before(startsAt.Add(-time.Duration(minutes) * time.Minute)) {
+		return ErrCancellationDeadlinePassed
+	}
+	return nil
+}
+
+// Reschedule moves an active order to another timeslot of the same branch.
+// Leaving the old slot is subject to the cancellation deadline and taking the
+// new one to the booking window, exactly as a cancel + re-book would be.
+func (r *OrderRepository) Reschedule(
+	ctx context.Context,
+	orderID int64,
+	newTimeslotID int64,
+	req RescheduleRequest,
+) (model.Order, error) {
+
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Order{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Order{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// 1) Lock order row
+	var out model.Order
+	if err := scanOrder(tx.QueryRowContext(ctx, lockOrderQ, orderID, tid), &out); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Order{}, ErrOrderNotFound
+		}
+		return model.Order{}, err
+	}
+	if err := checkOwnership(req.Actor, out); err != nil {
+		return model.Order{}, err
+	}
+	if out.Status != "created" {
+		return model.Order{}, ErrOrderNotReschedulable
+	}
+	if out.TimeslotID == newTimeslotID {
+		return model.Order{}, ErrRescheduleSameTimeslot
+	}
+	oldTimeslotID := out.TimeslotID
+
+	// a service booking occupies the slots its duration needs, at the old and
+	// at the new start
+	oldChain, err := orderSlots(ctx, tx, out)
+	if err != nil {
+		return model.Order{}, err
+	}
+	newChain := []int64{newTimeslotID}
+	var eligible []int64
+	if out.DurationMinutes != nil {
+		var date string
+		err := tx.QueryRowContext(ctx, `SELECT service_date::text FROM timeslots WHERE id = $1 AND branch_id = $2;`,
+			newTimeslotID, out.BranchID).Scan(&date)
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Order{}, ErrTimeslotNotFound
+		}
+		if err != nil {
+			return model.Order{}, err
+		}
+		chain, err := findServiceChain(ctx, tx, out.BranchID, date, newTimeslotID, *out.DurationMinutes)
+		if err != nil {
+			return model.Order{}, err
+		}
+		newChain = chainIDs(chain)
+	}
+	if out.ServiceID != nil {
+		if eligible, err = serviceResources(ctx, tx, *out.ServiceID); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	// 2) Lock the old and new timeslot rows, in time order like bookings do so
+	// concurrent bookings and reschedules can't deadlock
+	type lockedSlot struct {
+		capacity, reserved     int
+		isActive, branchActive bool
+		clock                  slotClock
+		booking                model.BookingPolicy
+		cancel                 model.CancelPolicy
+	}
+	const lockSlotsQ = `
+SELECT t.id, t.capacity, t.reserved, t.is_active, b.is_active,
+       t.service_date::text, t.start_time::text, t.end_time::text, b.timezone,
+       b.min_lead_minutes, b.max_advance_days,
+       b.customer_cancel_deadline_minutes, b.staff_cancel_deadline_minutes
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+WHERE t.id = ANY($1) AND t.branch_id = $2
+ORDER BY t.service_date ASC, t.start_time ASC, t.end_time ASC, t.id ASC
+FOR UPDATE OF t;
+`
+	rows, err := tx.QueryContext(ctx, lockSlotsQ, append(slices.Clone(oldChain), newChain...), out.BranchID)
+	if err != nil {
+		return model.Order{}, err
+	}
+	slots := make(map[int64]lockedSlot, len(oldChain)+len(newChain))
+	for rows.Next() {
+		var (
+			id int64
+			ls lockedSlot
+		)
+		if err := rows.Scan(
+			&id, &ls.capacity, &ls.reserved, &ls.isActive, &ls.branchActive,
+			&ls.clock.date, &ls.clock.start, &ls.clock.end, &ls.clock.tz,
+			&ls.booking.MinLeadMinutes, &ls.booking.MaxAdvanceDays,
+			&ls.cancel.CustomerDeadlineMinutes, &ls.cancel.StaffDeadlineMinutes,
+		); err != nil {
+			rows.Close()
+			return model.Order{}, err
+		}
+		slots[id] = ls
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return model.Order{}, err
+	}
+
+	from, ok := slots[oldTimeslotID]
+	if !ok {
+		return model.Order{}, ErrTimeslotNotFound
+	}
+	to, ok := slots[newTimeslotID]
+	if !ok {
+		return model.Order{}, ErrTimeslotNotFound
+	}
+
+	now := time.Now()
+	if err := from.clock.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+	if err := checkCancelDeadline(from.cancel, req.Actor, out.StartsAt, now); err != nil {
+		return model.Order{}, err
+	}
+	before := out
+	if !to.branchActive {
+		return model.Order{}, ErrBranchInactive
+	}
+	if !to.isActive {
+		return model.Order{}, ErrTimeslotInactive
+	}
+	if err := checkBookingWindow(to.booking, to.clock, now); err != nil {
+		return model.Order{}, err
+	}
+	// slots the order already holds a seat in need no free one
+	for _, id := range newChain {
+		ls, ok := slots[id]
+		if !ok {
+			return model.Order{}, ErrTimeslotNotFound
+		}
+		if !ls.isActive {
+			return model.Order{}, ErrTimeslotInactive
+		}
+		if !slices.Contains(oldChain, id) && ls.reserved >= ls.capacity {
+			return model.Order{}, ErrTimeslotFullyBooked
+		}
+	}
+
+	// 3) Move the seat; the order lets go of its resource first so it can keep
+	// it when the new slot overlaps the old one
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET resource_id = NULL WHERE id = $1;`, orderID); err != nil {
+		return model.Order{}, err
+	}
+	var keep int64
+	if before.ResourceID != nil {
+		keep = *before.ResourceID
+	}
+	resourceID, err := assignResource(ctx, tx, newChain, eligible, 0, keep)
+	if err != nil {
+		return model.Order{}, err
+	}
+	// only slots in one of the two chains change
+	const moveSeatQ = `
+UPDATE timeslots
+SET reserved = CASE
+      WHEN id = ANY($2) THEN reserved + 1
+      WHEN reserved > 0 THEN reserved - 1
+      ELSE 0
+    END,
+    updated_at = now()
+WHERE (id = ANY($1)) <> (id = ANY($2));
+`
+	if _, err := tx.ExecContext(ctx, moveSeatQ, oldChain, newChain); err != nil {
+		return model.Order{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM order_timeslots WHERE order_id = $1;`, orderID); err != nil {
+		return model.Order{}, err
+	}
+	if err := insertOrderTimeslots(ctx, tx, orderID, newChain[1:]); err != nil {
+		return model.Order{}, err
+	}
+
+	// 4) Point the order at the new slot
+	const updateOrderQ = `
+UPDATE orders
+SET timeslot_id = $2,
+    resource_id = NULLIF($3::bigint, 0),
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + orderColumns + `;
+`
+	if err := scanOrder(tx.QueryRowContext(ctx, updateOrderQ, orderID, newTimeslotID, resourceID), &out); err != nil {
+		return model.Order{}, err
+	}
+	if err := to.clock.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, orderEvent{
+		orderID:       out.ID,
+		typ:           model.OrderRescheduled,
+		actor:         req.Actor,
+		oldStatus:     out.Status,
+		newStatus:     out.Status,
+		oldTimeslotID: oldTimeslotID,
+		newTimeslotID: newTimeslotID,
+		note:          req.Note,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      req.Actor,
+		Action:     "order.reschedule",
+		EntityType: audit.EntityOrder,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	for _, date := range []string{from.clock.date, to.clock.date} {
+		if err := notifyAvailability(ctx, tx, out.BranchID, date); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, err
+	}
+
+	return out, nil
+}
+
+// BranchOf returns the branch an order belongs to, so callers can authorize
+// before acting on it.
+func (r *OrderRepository) BranchOf(ctx context.Context, orderID int64) (int64, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	const q = `
+SELECT o.branch_id
+FROM orders o
+JOIN branches b ON b.id = o.branch_id
+WHERE o.id = $1 AND b.tenant_id = $2;
+`
+	var branchID int64
+	err = db.QueryRowContext(ctx, q, orderID, tid).Scan(&branchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrOrderNotFound
+	}
+	return branchID, err
+}
+
+// CheckIn marks an active order as arrived; unconfirmed orders count as
+// confirmed by showing up. The seat stays reserved; a checked-in order can no
+// longer be cancelled or rescheduled.
+func (r *OrderRepository) CheckIn(ctx context.Context, actor model.Actor, orderID int64) (model.Order, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Order{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Order{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var before model.Order
+	var slot slotClock
+	const lockQ = `
+SELECT ` + orderColumnsO + `,
+  t.service_date::text, t.start_time::text, t.end_time::text, b.timezone
+FROM orders o
+JOIN timeslots t ON t.id = o.timeslot_id
+JOIN branches b ON b.id = o.branch_id
+WHERE o.id = $1 AND b.tenant_id = $2
+FOR UPDATE OF o;
+`
+	if err := scanOrder(tx.QueryRowContext(ctx, lockQ, orderID, tid), &before,
+		&slot.date, &slot.start, &slot.end, &slot.tz,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Order{}, ErrOrderNotFound
+		}
+		return model.Order{}, err
+	}
+	if err := slot.apply(&before); err != nil {
+		return model.Order{}, err
+	}
+
+	if before.Status != "created" && before.Status != "unconfirmed" {
+		return model.Order{}, ErrOrderNotCheckable
+	}
+
+	const checkInQ = `
+UPDATE orders
+SET status = 'checked_in',
+    checked_in_at = now(),
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + orderColumns + `;
+`
+	var out model.Order
+	if err := scanOrder(tx.QueryRowContext(ctx, checkInQ, orderID), &out); err != nil {
+		return model.Order{}, err
+	}
+	if err := slot.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, orderEvent{
+		orderID:   out.ID,
+		typ:       model.OrderCheckedIn,
+		actor:     actor,
+		oldStatus: before.Status,
+		newStatus: out.Status,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "order.check_in",
+		EntityType: audit.EntityOrder,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	// no seat changes, but the front-desk timetable shows the status
+	if err := notifyAvailability(ctx, tx, out.BranchID, slot.date); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, err
+	}
+	return out, nil
+}
+
 func (r *OrderRepository) ListByBranchAndDate(
 	ctx context.Context,
 	branchID int64,
 	date string, // YYYY-MM-DD
 ) ([]model.Order, error) {
 
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	// orders ไม่มี service_date -> join timeslots เพื่อ filter ตามวันที่
 	const q = `
 SELECT
-  o.id, o.branch_id, o.timeslot_id, o.customer_name, o.status, o.created_at, o.updated_at
+  ` + orderColumnsO + `,
+  t.service_date::text, t.start_time::text, t.end_time::text, b.timezone
 FROM orders o
 JOIN timeslots t
   ON t.id = o.timeslot_id
  AND t.branch_id = o.branch_id
+JOIN branches b ON b.id = o.branch_id
 WHERE o.branch_id = $1
   AND t.service_date = $2::date
+  AND b.tenant_id = $3
 ORDER BY t.start_time ASC, o.created_at ASC;
 `
 
-	rows, err := r.db.QueryContext(ctx, q, branchID, date)
+	rows, err := db.QueryContext(ctx, q, branchID, date, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -216,16 +951,14 @@ ORDER BY t.start_time ASC, o.created_at ASC;
 
 	out := make([]model.Order, 0, 32)
 	for rows.Next() {
-		var o model.Order
-		if err := rows.Scan(
-			&o.ID,
-			&o.BranchID,
-			&o.TimeslotID,
-			&o.CustomerName,
-			&o.Status,
-			&o.CreatedAt,
-			&o.UpdatedAt,
-		); err != nil {
+		var (
+			o    model.Order
+			slot slotClock
+		)
+		if err := scanOrder(rows, &o, &slot.date, &slot.start, &slot.end, &slot.tz); err != nil {
+			return nil, err
+		}
+		if err := slot.apply(&o); err != nil {
 			return nil, err
 		}
 		out = append(out, o)
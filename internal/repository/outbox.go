@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/idlistic/go-backend-api-sample/internal/requestid"
+)
+
+// outboxEvent is a domain event to publish once the transaction commits.
+type outboxEvent struct {
+	tenantID      int64
+	typ           string // webhook.Event*
+	aggregateType string
+	aggregateID   string
+	payload       any
+}
+
+// insertOutboxEvent writes e inside the caller's transaction and queues a
+// delivery for every active endpoint of the tenant subscribed to it, so an
+// event exists if and only if its change committed.
+func insertOutboxEvent(ctx context.Context, tx *sql.Tx, e outboxEvent) error {
+	payload, err := json.Marshal(e.payload)
+	if err != nil {
+		return err
+	}
+
+	const q = `
+WITH ev AS (
+  INSERT INTO outbox_events (tenant_id, event_type, aggregate_type, aggregate_id, payload, request_id)
+  VALUES ($1, $2, $3, $4, $5::jsonb, NULLIF($6, ''))
+  RETURNING id, tenant_id, event_type
+)
+INSERT INTO webhook_deliveries (event_id, endpoint_id)
+SELECT ev.id, w.id
+FROM ev
+JOIN webhook_endpoints w
+  ON w.tenant_id = ev.tenant_id
+ AND w.is_active
+ AND (cardinality(w.event_types) = 0 OR ev.event_type = ANY(w.event_types));
+`
+	_, err = tx.ExecContext(ctx, q,
+		e.tenantID, e.typ, e.aggregateType, e.aggregateID, string(payload), requestid.FromContext(ctx),
+	)
+	return err
+}
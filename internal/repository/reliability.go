@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+var (
+	ErrCustomerBlocked          = errors.New("customer may not book at this branch")
+	ErrConfirmationWindowClosed = errors.New("slot starts too soon to confirm the booking")
+	ErrOrderNotConfirmable      = errors.New("order cannot be confirmed")
+	ErrOrderNotMarkable         = errors.New("order cannot be marked as no-show")
+	ErrSlotNotStarted           = errors.New("timeslot has not started yet")
+)
+
+// customerReliability counts a customer's incidents across the tenant under
+// policy p: no-shows, and cancellations by the customer closer than
+// p.LateCancelMinutes to the start, for slots starting in the last
+// p.WindowDays days or later.
+func customerReliability(ctx context.Context, q queryer, tid int64, customerID string, p model.ReliabilityPolicy, now time.Time) (model.Reliability, error) {
+	const reliabilityQ = `
+SELECT
+  count(*)::int,
+  count(*) FILTER (WHERE o.status = 'no_show')::int,
+  count(*) FILTER (
+    WHERE o.status = 'cancelled'
+      AND o.cancelled_by_type = 'customer'
+      AND o.cancelled_at > s.starts_at - make_interval(mins => $4)
+  )::int
+FROM orders o
+JOIN timeslots t ON t.id = o.timeslot_id
+JOIN branches b ON b.id = o.branch_id
+CROSS JOIN LATERAL (
+  SELECT (t.service_date + t.start_time) AT TIME ZONE b.timezone AS starts_at
+) s
+WHERE o.customer_id = $1
+  AND b.tenant_id = $2
+  AND s.starts_at >= $3::timestamptz - make_interval(days => $5);
+`
+	rec := model.Reliability{CustomerID: customerID, WindowDays: p.WindowDays}
+	if err := q.QueryRowContext(ctx, reliabilityQ,
+		customerID, tid, now, p.LateCancelMinutes, p.WindowDays,
+	).Scan(&rec.Orders, &rec.NoShows, &rec.LateCancels); err != nil {
+		return model.Reliability{}, err
+	}
+	rec.Incidents = rec.NoShows + rec.LateCancels
+	rec.Standing = p.StandingFor(rec.Incidents)
+	return rec, nil
+}
+
+// checkConfirmWindow rejects bookings that would have to be confirmed after
+// the confirmation deadline of their slot.
+func checkConfirmWindow(p model.ReliabilityPolicy, slot slotClock, now time.Time) error {
+	startsAt, _, err := slotInstants(slot.tz, slot.date, slot.start, slot.end)
+	if err != nil {
+		return err
+	}
+	if !now.Before(confirmDeadline(p, startsAt)) {
+		return ErrConfirmationWindowClosed
+	}
+	return nil
+}
+
+func confirmDeadline(p model.ReliabilityPolicy, startsAt time.Time) time.Time {
+	return startsAt.Add(-time.Duration(p.ConfirmDeadlineMinutes) * time.Minute)
+}
+
+// Reliability returns a customer's record under the policy of a branch.
+func (r *OrderRepository) Reliability(ctx context.Context, branchID int64, customerID string) (model.Reliability, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Reliability{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.Reliability{}, err
+	}
+	defer done()
+
+	branch, err := getBranch(ctx, db, tid, branchID, false)
+	if err != nil {
+		return model.Reliability{}, err
+	}
+	return customerReliability(ctx, db, tid, customerID, branch.ReliabilityPolicy, time.Now())
+}
+
+// lockOrderSlotQ locks an order of tenant $2 and reads its slot and the
+// branch reliability policy.
+const lockOrderSlotQ = `
+SELECT ` + orderColumnsO + `,
+  t.service_date::text, t.start_time::text, t.end_time::text, b.timezone,
+  b.confirm_deadline_minutes
+FROM orders o
+JOIN timeslots t ON t.id = o.timeslot_id
+JOIN branches b ON b.id = o.branch_id
+WHERE o.id = $1 AND b.tenant_id = $2
+FOR UPDATE OF o;
+`
+
+// Confirm confirms an unconfirmed order before its confirmation deadline.
+// Customers can only confirm their own orders.
+func (r *OrderRepository) Confirm(ctx context.Context, actor model.Actor, orderID int64) (model.Order, error) {
+	return r.transition(ctx, actor, orderID, func(o model.Order, p model.ReliabilityPolicy, now time.Time) error {
+		if err := checkOwnership(actor, o); err != nil {
+			return err
+		}
+		if o.Status != "unconfirmed" || !now.Before(confirmDeadline(p, o.StartsAt)) {
+			return ErrOrderNotConfirmable
+		}
+		return nil
+	}, orderTransition{
+		typ:    model.OrderConfirmed,
+		action: "order.confirm",
+		query: `
+UPDATE orders
+SET status = 'created',
+    confirmed_at = now(),
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + orderColumns + `;
+`,
+	})
+}
+
+// MarkNoShow records that the customer of an open order did not come. The
+// slot must have started; the seat stays taken.
+func (r *OrderRepository) MarkNoShow(ctx context.Context, actor model.Actor, orderID int64) (model.Order, error) {
+	return r.transition(ctx, actor, orderID, func(o model.Order, _ model.ReliabilityPolicy, now time.Time) error {
+		if o.Status != "created" && o.Status != "unconfirmed" {
+			return ErrOrderNotMarkable
+		}
+		if now.Before(o.StartsAt) {
+			return ErrSlotNotStarted
+		}
+		return nil
+	}, orderTransition{
+		typ:    model.OrderNoShow,
+		action: "order.no_show",
+		query: `
+UPDATE orders
+SET status = 'no_show',
+    no_show_at = now(),
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + orderColumns + `;
+`,
+	})
+}
+
+// orderTransition is a status change that does not move seats.
+type orderTransition struct {
+	typ    model.OrderEventType
+	action string // audit action
+	query  string // UPDATE of order $1 returning orderColumns
+}
+
+// transition locks an order, lets check veto the change, applies it and
+// records it in the order history and the audit log.
+func (r *OrderRepository) transition(
+	ctx context.Context,
+	actor model.Actor,
+	orderID int64,
+	check func(o model.Order, p model.ReliabilityPolicy, now time.Time) error,
+	t orderTransition,
+) (model.Order, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Order{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Order{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var (
+		before model.Order
+		slot   slotClock
+		policy model.ReliabilityPolicy
+	)
+	if err := scanOrder(tx.QueryRowContext(ctx, lockOrderSlotQ, orderID, tid), &before,
+		&slot.date, &slot.start, &slot.end, &slot.tz, &policy.ConfirmDeadlineMinutes,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Order{}, ErrOrderNotFound
+		}
+		return model.Order{}, err
+	}
+	if err := slot.apply(&before); err != nil {
+		return model.Order{}, err
+	}
+	if err := check(before, policy, time.Now()); err != nil {
+		return model.Order{}, err
+	}
+
+	var out model.Order
+	if err := scanOrder(tx.QueryRowContext(ctx, t.query, orderID), &out); err != nil {
+		return model.Order{}, err
+	}
+	if err := slot.apply(&out); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := insertOrderEvent(ctx, tx, orderEvent{
+		orderID:   out.ID,
+		typ:       t.typ,
+		actor:     actor,
+		oldStatus: before.Status,
+		newStatus: out.Status,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     t.action,
+		EntityType: audit.EntityOrder,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Order{}, err
+	}
+	// no seat changes, but the front-desk timetable shows the status
+	if err := notifyAvailability(ctx, tx, out.BranchID, slot.date); err != nil {
+		return model.Order{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, err
+	}
+	return out, nil
+}
+
+// ReleaseUnconfirmed cancels, across all tenants, up to limit unconfirmed
+// orders whose confirmation deadline has passed, freeing their seats. It
+// returns how many were released; an order that fails is skipped and its
+// error joined into the one returned.
+func (r *OrderRepository) ReleaseUnconfirmed(ctx context.Context, limit int) (int, error) {
+	type due struct{ orderID, tenantID int64 }
+
+	tx, err := beginTxAs(ctx, r.db, allTenants, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	const dueQ = `
+SELECT o.id, b.tenant_id
+FROM orders o
+JOIN timeslots t ON t.id = o.timeslot_id
+JOIN branches b ON b.id = o.branch_id
+WHERE o.status = 'unconfirmed'
+  AND (t.service_date + t.start_time) AT TIME ZONE b.timezone
+      <= now() + make_interval(mins => b.confirm_deadline_minutes)
+ORDER BY o.id ASC
+LIMIT $1;
+`
+	rows, err := tx.QueryContext(ctx, dueQ, limit)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	var list []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.orderID, &d.tenantID); err != nil {
+			rows.Close()
+			_ = tx.Rollback()
+			return 0, err
+		}
+		list = append(list, d)
+	}
+	rows.Close()
+	_ = tx.Rollback()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	var errs []error
+	for _, d := range list {
+		// each order is cancelled in its own tenant, like any other
+		// cancellation; one confirmed in the meantime is no longer unconfirmed
+		tctx := tenant.WithTenant(ctx, model.Tenant{ID: d.tenantID})
+		_, err := r.cancel(tctx, d.orderID, CancelRequest{
+			Actor:  model.Actor{Type: model.ActorSystem},
+			Reason: model.CancelNotConfirmed,
+		}, []string{"unconfirmed"})
+		switch {
+		case errors.Is(err, ErrOrderNotCancellable):
+		case err != nil:
+			// carry on: the batch is ordered by id, so an order that keeps
+			// failing would otherwise hold back every later one
+			errs = append(errs, fmt.Errorf("order %d: %w", d.orderID, err))
+		default:
+			released++
+		}
+	}
+	return released, errors.Join(errs...)
+}
@@ -0,0 +1,442 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+var (
+	ErrResourceNotFound      = errors.New("resource not found")
+	ErrResourceNameTaken     = errors.New("resource name already exists in this branch")
+	ErrResourceNotAssigned   = errors.New("resource does not serve this timeslot")
+	ErrResourceUnavailable   = errors.New("resource is not available for this timeslot")
+	ErrResourceInUse         = errors.New("resource holds bookings in this timeslot")
+	ErrCapacityFromResources = errors.New("capacity is set by the timeslot's resources")
+)
+
+type ResourceRepository struct {
+	db *sql.DB
+}
+
+func NewResourceRepository(db *sql.DB) *ResourceRepository {
+	return &ResourceRepository{db: db}
+}
+
+// ResourceUpdate holds the fields to change; nil means "leave as is".
+// Availability, when set, replaces the whole weekly schedule.
+type ResourceUpdate struct {
+	Kind         *model.ResourceKind
+	Name         *string
+	IsActive     *bool
+	Availability *[]model.ResourceAvailability
+}
+
+const resourceColumns = `r.id, r.branch_id, r.kind, r.name, r.is_active, r.created_at, r.updated_at`
+
+func scanResource(row interface{ Scan(...any) error }, res *model.Resource) error {
+	return row.Scan(
+		&res.ID,
+		&res.BranchID,
+		&res.Kind,
+		&res.Name,
+		&res.IsActive,
+		&res.CreatedAt,
+		&res.UpdatedAt,
+	)
+}
+
+// resourceFree holds when resource r can serve slot t: it is active, its
+// weekly availability (if any) covers the slot, and no open booking holds it
+// at a time of the same date that overlaps t. A booking holds its resource
+// for its slot, or for its service's duration from the slot start.
+const resourceFree = `r.is_active
+  AND (NOT EXISTS (SELECT 1 FROM resource_availability ra WHERE ra.resource_id = r.id)
+    OR EXISTS (
+      SELECT 1
+      FROM resource_availability ra
+      WHERE ra.resource_id = r.id
+        AND ra.weekday = EXTRACT(DOW FROM t.service_date)
+        AND ra.start_time <= t.start_time
+        AND ra.end_time >= t.end_time))
+  AND NOT EXISTS (
+    SELECT 1
+    FROM orders ro
+    JOIN timeslots rt ON rt.id = ro.timeslot_id
+    WHERE ro.resource_id = r.id
+      AND ro.status IN ('created', 'unconfirmed', 'checked_in', 'no_show')
+      AND rt.service_date = t.service_date
+      AND rt.start_time < t.end_time
+      AND COALESCE(rt.start_time - time '00:00' + make_interval(mins => ro.duration_minutes),
+                   rt.end_time - time '00:00') > t.start_time - time '00:00')`
+
+func (r *ResourceRepository) List(ctx context.Context, branchID int64) ([]model.Resource, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT ` + resourceColumns + `
+FROM resources r
+JOIN branches b ON b.id = r.branch_id
+WHERE r.branch_id = $1 AND b.tenant_id = $2
+ORDER BY r.kind ASC, r.name ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.Resource, 0, 16)
+	for rows.Next() {
+		var res model.Resource
+		if err := scanResource(rows, &res); err != nil {
+			return nil, err
+		}
+		out = append(out, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := attachAvailability(ctx, db, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *ResourceRepository) Get(ctx context.Context, id int64) (model.Resource, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	defer done()
+
+	return getResource(ctx, db, tid, id, false)
+}
+
+func (r *ResourceRepository) Create(ctx context.Context, actor model.Actor, res model.Resource) (model.Resource, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := getBranch(ctx, tx, tid, res.BranchID, false); err != nil {
+		return model.Resource{}, err
+	}
+
+	const insertQ = `
+INSERT INTO resources AS r (branch_id, kind, name, is_active)
+VALUES ($1, $2, $3, $4)
+RETURNING ` + resourceColumns + `;
+`
+	var out model.Resource
+	if err := scanResource(tx.QueryRowContext(ctx, insertQ,
+		res.BranchID, string(res.Kind), res.Name, res.IsActive,
+	), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_resources_branch_name") {
+			return model.Resource{}, ErrResourceNameTaken
+		}
+		return model.Resource{}, err
+	}
+
+	if err := replaceAvailability(ctx, tx, out.ID, res.Availability); err != nil {
+		return model.Resource{}, err
+	}
+	out.Availability = res.Availability
+	if out.Availability == nil {
+		out.Availability = []model.ResourceAvailability{} // [] rather than null, as when read back
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "resource.create",
+		EntityType: audit.EntityResource,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		After:      out,
+	}); err != nil {
+		return model.Resource{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Resource{}, err
+	}
+	return out, nil
+}
+
+// Update changes a resource. Bookings it already holds are kept even when it
+// is deactivated or its availability no longer covers them; it just takes no
+// new ones.
+func (r *ResourceRepository) Update(ctx context.Context, actor model.Actor, id int64, u ResourceUpdate) (model.Resource, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	cur, err := getResource(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.Resource{}, err
+	}
+	before := cur
+
+	if u.Kind != nil {
+		cur.Kind = *u.Kind
+	}
+	if u.Name != nil {
+		cur.Name = *u.Name
+	}
+	if u.IsActive != nil {
+		cur.IsActive = *u.IsActive
+	}
+
+	const updateQ = `
+UPDATE resources AS r
+SET kind = $2,
+    name = $3,
+    is_active = $4,
+    updated_at = now()
+WHERE r.id = $1
+RETURNING ` + resourceColumns + `;
+`
+	var out model.Resource
+	if err := scanResource(tx.QueryRowContext(ctx, updateQ, id, string(cur.Kind), cur.Name, cur.IsActive), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_resources_branch_name") {
+			return model.Resource{}, ErrResourceNameTaken
+		}
+		return model.Resource{}, err
+	}
+
+	out.Availability = cur.Availability
+	if u.Availability != nil {
+		if err := replaceAvailability(ctx, tx, id, *u.Availability); err != nil {
+			return model.Resource{}, err
+		}
+		out.Availability = *u.Availability
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "resource.update",
+		EntityType: audit.EntityResource,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Resource{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Resource{}, err
+	}
+	return out, nil
+}
+
+// BranchOf returns the branch a resource belongs to, so callers can authorize
+// before acting on it.
+func (r *ResourceRepository) BranchOf(ctx context.Context, id int64) (int64, error) {
+	res, err := r.Get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return res.BranchID, nil
+}
+
+// getResource reads a resource of tenant tenantID; other tenants' resources
+// are not found.
+func getResource(ctx context.Context, q queryer, tenantID, id int64, forUpdate bool) (model.Resource, error) {
+	query := `
+SELECT ` + resourceColumns + `
+FROM resources r
+JOIN branches b ON b.id = r.branch_id
+WHERE r.id = $1 AND b.tenant_id = $2`
+	if forUpdate {
+		query += `
+FOR UPDATE OF r`
+	}
+
+	var res model.Resource
+	if err := scanResource(q.QueryRowContext(ctx, query, id, tenantID), &res); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Resource{}, ErrResourceNotFound
+		}
+		return model.Resource{}, err
+	}
+
+	items := []model.Resource{res}
+	if err := attachAvailability(ctx, q, items); err != nil {
+		return model.Resource{}, err
+	}
+	return items[0], nil
+}
+
+// attachAvailability loads the weekly schedule for every resource in one query.
+func attachAvailability(ctx context.Context, q queryer, resources []model.Resource) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(resources))
+	indexByID := make(map[int64]int, len(resources))
+	for i := range resources {
+		ids[i] = resources[i].ID
+		indexByID[resources[i].ID] = i
+		resources[i].Availability = make([]model.ResourceAvailability, 0, 7)
+	}
+
+	const availabilityQ = `
+SELECT resource_id, weekday, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+FROM resource_availability
+WHERE resource_id = ANY($1)
+ORDER BY resource_id ASC, weekday ASC, start_time ASC;
+`
+	rows, err := q.QueryContext(ctx, availabilityQ, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			resourceID int64
+			a          model.ResourceAvailability
+		)
+		if err := rows.Scan(&resourceID, &a.Weekday, &a.StartTime, &a.EndTime); err != nil {
+			return err
+		}
+		pos := indexByID[resourceID]
+		resources[pos].Availability = append(resources[pos].Availability, a)
+	}
+	return rows.Err()
+}
+
+func replaceAvailability(ctx context.Context, tx *sql.Tx, resourceID int64, availability []model.ResourceAvailability) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM resource_availability WHERE resource_id = $1;`, resourceID); err != nil {
+		return err
+	}
+
+	const insertQ = `
+INSERT INTO resource_availability (resource_id, weekday, start_time, end_time)
+VALUES ($1, $2, $3::time, $4::time);
+`
+	for _, a := range availability {
+		if _, err := tx.ExecContext(ctx, insertQ, resourceID, int(a.Weekday), a.StartTime, a.EndTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignResource picks the resource a booking of slotIDs (one slot, or the
+// consecutive slots of a service) will hold, or returns 0 when the slots have
+// no resources. A candidate must serve every slot and, when eligible is not
+// empty, be one of eligible. The slots' resources are locked in id order
+// first, so concurrent bookings of overlapping slots cannot take the same one.
+// want is the resource the customer asked for (0 = any); prefer is tried first
+// when any will do.
+func assignResource(ctx context.Context, tx *sql.Tx, slotIDs, eligible []int64, want, prefer int64) (int64, error) {
+	const lockQ = `
+SELECT r.id
+FROM resources r
+WHERE r.id IN (SELECT resource_id FROM timeslot_resources WHERE timeslot_id = ANY($1))
+ORDER BY r.id ASC
+FOR UPDATE;
+`
+	locked, err := queryIDs(ctx, tx, lockQ, slotIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	const candidatesQ = `
+SELECT resource_id
+FROM timeslot_resources
+WHERE timeslot_id = ANY($1)
+GROUP BY resource_id
+HAVING count(*) = $2
+ORDER BY resource_id ASC;
+`
+	ids, err := queryIDs(ctx, tx, candidatesQ, slotIDs, len(slotIDs))
+	if err != nil {
+		return 0, err
+	}
+	if len(eligible) > 0 {
+		ids = slices.DeleteFunc(ids, func(id int64) bool { return !slices.Contains(eligible, id) })
+	}
+
+	if want != 0 && !slices.Contains(ids, want) {
+		return 0, ErrResourceNotAssigned
+	}
+	if len(ids) == 0 {
+		if len(locked) == 0 && len(eligible) == 0 {
+			return 0, nil
+		}
+		return 0, ErrResourceNotAssigned
+	}
+
+	const freeQ = `
+SELECT r.id
+FROM resources r
+WHERE r.id = ANY($1)
+  AND ($2::bigint = 0 OR r.id = $2)
+  AND NOT EXISTS (
+    SELECT 1
+    FROM timeslots t
+    WHERE t.id = ANY($3)
+      AND NOT (` + resourceFree + `))
+ORDER BY r.id = $4 DESC, r.id ASC
+LIMIT 1;
+`
+	var id int64
+	err = tx.QueryRowContext(ctx, freeQ, ids, want, slotIDs, prefer).Scan(&id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && want != 0:
+		return 0, ErrResourceUnavailable
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, ErrTimeslotFullyBooked
+	}
+	return id, err
+}
+
+// queryIDs runs a query returning one id column.
+func queryIDs(ctx context.Context, q queryer, query string, args ...any) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
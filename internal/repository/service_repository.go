@@ -0,0 +1,629 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+var (
+	ErrServiceNotFound   = errors.New("service not found")
+	ErrServiceNameTaken  = errors.New("service name already exists in this branch")
+	ErrServiceInactive   = errors.New("service is inactive")
+	ErrServiceDoesNotFit = errors.New("service does not fit the consecutive timeslots")
+)
+
+type ServiceRepository struct {
+	db *sql.DB
+}
+
+func NewServiceRepository(db *sql.DB) *ServiceRepository {
+	return &ServiceRepository{db: db}
+}
+
+// ServiceUpdate holds the fields to change; nil means "leave as is".
+// ResourceIDs, when set, replaces the whole list.
+type ServiceUpdate struct {
+	Name            *string
+	DurationMinutes *int
+	Price           *string
+	IsActive        *bool
+	ResourceIDs     *[]int64
+}
+
+const serviceColumns = `s.id, s.branch_id, s.name, s.duration_minutes, s.price::text, s.is_active,
+  COALESCE((SELECT string_agg(sr.resource_id::text, ',' ORDER BY sr.resource_id)
+            FROM service_resources sr WHERE sr.service_id = s.id), ''),
+  s.created_at, s.updated_at`
+
+func scanService(row interface{ Scan(...any) error }, s *model.Service) error {
+	var resourceIDs string
+	if err := row.Scan(
+		&s.ID,
+		&s.BranchID,
+		&s.Name,
+		&s.DurationMinutes,
+		&s.Price,
+		&s.IsActive,
+		&resourceIDs,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	var err error
+	s.ResourceIDs, err = parseIDList(resourceIDs)
+	return err
+}
+
+// parseIDList parses a comma-separated id list as produced by string_agg.
+func parseIDList(s string) ([]int64, error) {
+	parts := splitList(s)
+	ids := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *ServiceRepository) List(ctx context.Context, branchID int64) ([]model.Service, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT ` + serviceColumns + `
+FROM services s
+JOIN branches b ON b.id = s.branch_id
+WHERE s.branch_id = $1 AND b.tenant_id = $2
+ORDER BY s.name ASC;
+`
+	rows, err := db.QueryContext(ctx, q, branchID, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.Service, 0, 16)
+	for rows.Next() {
+		var s model.Service
+		if err := scanService(rows, &s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *ServiceRepository) Get(ctx context.Context, id int64) (model.Service, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Service{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.Service{}, err
+	}
+	defer done()
+
+	return getService(ctx, db, tid, id, false)
+}
+
+func (r *ServiceRepository) Create(ctx context.Context, actor model.Actor, s model.Service) (model.Service, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Service{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Service{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := getBranch(ctx, tx, tid, s.BranchID, false); err != nil {
+		return model.Service{}, err
+	}
+
+	const insertQ = `
+INSERT INTO services AS s (branch_id, name, duration_minutes, price, is_active)
+VALUES ($1, $2, $3, $4::numeric, $5)
+RETURNING ` + serviceColumns + `;
+`
+	var out model.Service
+	if err := scanService(tx.QueryRowContext(ctx, insertQ,
+		s.BranchID, s.Name, s.DurationMinutes, s.Price, s.IsActive,
+	), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_services_branch_name") {
+			return model.Service{}, ErrServiceNameTaken
+		}
+		return model.Service{}, err
+	}
+
+	if err := replaceServiceResources(ctx, tx, out.ID, out.BranchID, s.ResourceIDs); err != nil {
+		return model.Service{}, err
+	}
+	if s.ResourceIDs != nil {
+		out.ResourceIDs = s.ResourceIDs
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "service.create",
+		EntityType: audit.EntityService,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		After:      out,
+	}); err != nil {
+		return model.Service{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Service{}, err
+	}
+	return out, nil
+}
+
+// Update changes a catalog entry. Existing bookings keep the duration they
+// were made with; deactivated services just take no new ones.
+func (r *ServiceRepository) Update(ctx context.Context, actor model.Actor, id int64, u ServiceUpdate) (model.Service, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Service{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Service{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	cur, err := getService(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.Service{}, err
+	}
+	before := cur
+
+	if u.Name != nil {
+		cur.Name = *u.Name
+	}
+	if u.DurationMinutes != nil {
+		cur.DurationMinutes = *u.DurationMinutes
+	}
+	if u.Price != nil {
+		cur.Price = *u.Price
+	}
+	if u.IsActive != nil {
+		cur.IsActive = *u.IsActive
+	}
+	if u.ResourceIDs != nil {
+		if err := replaceServiceResources(ctx, tx, id, cur.BranchID, *u.ResourceIDs); err != nil {
+			return model.Service{}, err
+		}
+	}
+
+	const updateQ = `
+UPDATE services AS s
+SET name = $2,
+    duration_minutes = $3,
+    price = $4::numeric,
+    is_active = $5,
+    updated_at = now()
+WHERE s.id = $1
+RETURNING ` + serviceColumns + `;
+`
+	var out model.Service
+	if err := scanService(tx.QueryRowContext(ctx, updateQ,
+		id, cur.Name, cur.DurationMinutes, cur.Price, cur.IsActive,
+	), &out); err != nil {
+		if pgErrorIs(err, pgUniqueViolation, "ux_services_branch_name") {
+			return model.Service{}, ErrServiceNameTaken
+		}
+		return model.Service{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "service.update",
+		EntityType: audit.EntityService,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.Service{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Service{}, err
+	}
+	return out, nil
+}
+
+// BranchOf returns the branch a service belongs to, so callers can authorize
+// before acting on it.
+func (r *ServiceRepository) BranchOf(ctx context.Context, id int64) (int64, error) {
+	s, err := r.Get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return s.BranchID, nil
+}
+
+// Starts lists the start times on date at which service id fits: every slot
+// it needs is active, has a free seat and can still be booked, and when the
+// slots have resources, one of them is free for the whole service.
+func (r *ServiceRepository) Starts(ctx context.Context, id int64, date string) ([]model.ServiceStart, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	svc, err := getService(ctx, db, tid, id, false)
+	if err != nil {
+		return nil, err
+	}
+	branch, err := getBranch(ctx, db, tid, svc.BranchID, false)
+	if err != nil {
+		return nil, err
+	}
+	if !svc.IsActive || !branch.IsActive {
+		return []model.ServiceStart{}, nil
+	}
+
+	slots, err := loadDaySlots(ctx, db, svc.BranchID, date, true)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	out := make([]model.ServiceStart, 0, len(slots))
+	for i := range slots {
+		chain := serviceChain(slots, i, svc.DurationMinutes)
+		if chain == nil {
+			continue
+		}
+
+		clock := slotClock{date: date, start: chain[0].start, end: chain[0].end, tz: branch.Timezone}
+		if checkBookingWindow(branch.BookingPolicy, clock, now) != nil {
+			continue
+		}
+
+		free, ok := chainFree(chain, svc.ResourceIDs)
+		if !ok {
+			continue
+		}
+
+		start := model.ServiceStart{
+			TimeslotID:  chain[0].id,
+			StartTime:   chain[0].start,
+			TimeslotIDs: make([]int64, len(chain)),
+			ResourceIDs: free,
+		}
+		if start.ResourceIDs == nil {
+			start.ResourceIDs = []int64{}
+		}
+		for j, s := range chain {
+			start.TimeslotIDs[j] = s.id
+		}
+		start.StartsAt, _, err = slotInstants(branch.Timezone, date, chain[0].start, chain[0].end)
+		if err != nil {
+			return nil, err
+		}
+		start.EndsAt = start.StartsAt.Add(time.Duration(svc.DurationMinutes) * time.Minute)
+		out = append(out, start)
+	}
+	return out, nil
+}
+
+// chainFree reports whether a service needing one of eligible (empty: any)
+// can be booked into chain: every slot is active with a seat left and, where
+// slots have resources, one of them is free throughout. It returns the
+// resources free for the whole chain.
+func chainFree(chain []daySlot, eligible []int64) ([]int64, bool) {
+	var free []int64
+	resourced := false
+	for j, s := range chain {
+		if !s.active || s.reserved >= s.capacity {
+			return nil, false
+		}
+		resourced = resourced || len(s.resources) > 0
+		if j == 0 {
+			free = slices.Clone(s.free)
+			continue
+		}
+		free = slices.DeleteFunc(free, func(id int64) bool { return !slices.Contains(s.free, id) })
+	}
+	if len(eligible) > 0 {
+		free = slices.DeleteFunc(free, func(id int64) bool { return !slices.Contains(eligible, id) })
+	}
+	if (resourced || len(eligible) > 0) && len(free) == 0 {
+		return nil, false
+	}
+	return free, true
+}
+
+// getService reads a service of tenant tenantID; other tenants' services are
+// not found.
+func getService(ctx context.Context, q queryer, tenantID, id int64, forUpdate bool) (model.Service, error) {
+	query := `
+SELECT ` + serviceColumns + `
+FROM services s
+JOIN branches b ON b.id = s.branch_id
+WHERE s.id = $1 AND b.tenant_id = $2`
+	if forUpdate {
+		query += `
+FOR UPDATE OF s`
+	}
+
+	var s model.Service
+	if err := scanService(q.QueryRowContext(ctx, query, id, tenantID), &s); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Service{}, ErrServiceNotFound
+		}
+		return model.Service{}, err
+	}
+	return s, nil
+}
+
+// replaceServiceResources sets the resources able to perform a service; they
+// must belong to the service's branch.
+func replaceServiceResources(ctx context.Context, tx *sql.Tx, serviceID, branchID int64, resourceIDs []int64) error {
+	const checkQ = `SELECT count(*) FROM resources WHERE id = ANY($1) AND branch_id = $2;`
+	var n int
+	if err := tx.QueryRowContext(ctx, checkQ, resourceIDs, branchID).Scan(&n); err != nil {
+		return err
+	}
+	if n != len(resourceIDs) {
+		return ErrResourceNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM service_resources WHERE service_id = $1;`, serviceID); err != nil {
+		return err
+	}
+	const insertQ = `
+INSERT INTO service_resources (service_id, resource_id)
+SELECT $1, unnest($2::bigint[]);
+`
+	_, err := tx.ExecContext(ctx, insertQ, serviceID, resourceIDs)
+	return err
+}
+
+// daySlot is a timeslot as seen when fitting a service into a day. resources
+// and free are only loaded for availability searches.
+type daySlot struct {
+	id                 int64
+	start, end         string // HH:MM:SS
+	capacity, reserved int
+	active             bool
+	resources, free    []int64
+}
+
+// loadDaySlots reads a branch's slots of one date ordered by start, then end,
+// with their assigned and free resources when withResources is set.
+func loadDaySlots(ctx context.Context, q queryer, branchID int64, date string, withResources bool) ([]daySlot, error) {
+	query := `
+SELECT t.id, t.start_time::text, t.end_time::text, t.capacity, t.reserved, t.is_active,
+       '', ''
+FROM timeslots t
+WHERE t.branch_id = $1 AND t.service_date = $2::date
+ORDER BY t.start_time ASC, t.end_time ASC`
+	if withResources {
+		query = `
+SELECT t.id, t.start_time::text, t.end_time::text, t.capacity, t.reserved, t.is_active,
+       COALESCE(res.ids, ''), COALESCE(res.free, '')
+FROM timeslots t
+CROSS JOIN LATERAL (
+  SELECT string_agg(r.id::text, ',' ORDER BY r.id) AS ids,
+         string_agg(r.id::text, ',' ORDER BY r.id) FILTER (WHERE ` + resourceFree + `) AS free
+  FROM timeslot_resources tr
+  JOIN resources r ON r.id = tr.resource_id
+  WHERE tr.timeslot_id = t.id
+) res
+WHERE t.branch_id = $1 AND t.service_date = $2::date
+ORDER BY t.start_time ASC, t.end_time ASC`
+	}
+
+	rows, err := q.QueryContext(ctx, query, branchID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []daySlot
+	for rows.Next() {
+		var (
+			s         daySlot
+			ids, free string
+		)
+		if err := rows.Scan(&s.id, &s.start, &s.end, &s.capacity, &s.reserved, &s.active, &ids, &free); err != nil {
+			return nil, err
+		}
+		if s.resources, err = parseIDList(ids); err != nil {
+			return nil, err
+		}
+		if s.free, err = parseIDList(free); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// serviceChain returns the slots a service of the given length occupies when
+// it starts with slots[first]: that slot and, while it has not ended yet, the
+// slot starting when the previous one ends. It is nil when no such chain
+// exists on that date.
+func serviceChain(slots []daySlot, first, minutes int) []daySlot {
+	begin, ok := clockSeconds(slots[first].start)
+	if !ok {
+		return nil
+	}
+	need := begin + minutes*60
+	if need > 24*60*60 {
+		return nil
+	}
+
+	chain := []daySlot{slots[first]}
+	for {
+		end, ok := clockSeconds(chain[len(chain)-1].end)
+		if !ok {
+			return nil
+		}
+		if end >= need {
+			return chain
+		}
+
+		next := slices.IndexFunc(slots, func(s daySlot) bool { return s.start == chain[len(chain)-1].end })
+		if next < 0 {
+			return nil
+		}
+		chain = append(chain, slots[next])
+	}
+}
+
+// clockSeconds converts HH:MM:SS (24:00:00 included) to seconds since midnight.
+func clockSeconds(clock string) (int, bool) {
+	var h, m, s int
+	if _, err := fmt.Sscanf(clock, "%d:%d:%d", &h, &m, &s); err != nil {
+		return 0, false
+	}
+	return h*3600 + m*60 + s, true
+}
+
+// findServiceChain returns the slots a service of the given length occupies
+// when it starts with slot firstID of branchID on date, or
+// ErrServiceDoesNotFit.
+func findServiceChain(ctx context.Context, q queryer, branchID int64, date string, firstID int64, minutes int) ([]daySlot, error) {
+	slots, err := loadDaySlots(ctx, q, branchID, date, false)
+	if err != nil {
+		return nil, err
+	}
+	first := slices.IndexFunc(slots, func(s daySlot) bool { return s.id == firstID })
+	if first < 0 {
+		return nil, ErrTimeslotNotFound
+	}
+	chain := serviceChain(slots, first, minutes)
+	if chain == nil {
+		return nil, ErrServiceDoesNotFit
+	}
+	return chain, nil
+}
+
+// lockServiceChain locks the slots a service of the given length occupies
+// when it starts with slot firstID, which the caller has already locked. The
+// remaining slots are locked in time order, like every booking locks slots, so
+// overlapping bookings cannot deadlock. It returns the chain in time order.
+func lockServiceChain(ctx context.Context, tx *sql.Tx, branchID int64, date string, firstID int64, minutes int) ([]daySlot, error) {
+	chain, err := findServiceChain(ctx, tx, branchID, date, firstID, minutes)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := lockSlots(ctx, tx, branchID, chainIDs(chain[1:]))
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(chain); i++ {
+		s := &chain[i]
+		l, ok := locked[s.id]
+		if !ok {
+			return nil, ErrTimeslotNotFound
+		}
+		s.capacity, s.reserved, s.active = l.capacity, l.reserved, l.active
+	}
+	return chain, nil
+}
+
+// lockSlots locks the slots ids of branchID in time order, like every booking
+// locks slots, and returns their seats by id. Slots that do not exist are
+// left out.
+func lockSlots(ctx context.Context, tx *sql.Tx, branchID int64, ids []int64) (map[int64]daySlot, error) {
+	const lockQ = `
+SELECT id, capacity, reserved, is_active
+FROM timeslots
+WHERE id = ANY($1) AND branch_id = $2
+ORDER BY service_date ASC, start_time ASC, end_time ASC, id ASC
+FOR UPDATE;
+`
+	rows, err := tx.QueryContext(ctx, lockQ, ids, branchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locked := make(map[int64]daySlot, len(ids))
+	for rows.Next() {
+		var s daySlot
+		if err := rows.Scan(&s.id, &s.capacity, &s.reserved, &s.active); err != nil {
+			return nil, err
+		}
+		locked[s.id] = s
+	}
+	return locked, rows.Err()
+}
+
+// orderSlots returns the slots an order occupies: its own, then those a
+// service booking continues into.
+func orderSlots(ctx context.Context, q queryer, o model.Order) ([]int64, error) {
+	const restQ = `
+SELECT ot.timeslot_id
+FROM order_timeslots ot
+JOIN timeslots t ON t.id = ot.timeslot_id
+WHERE ot.order_id = $1
+ORDER BY t.start_time ASC;
+`
+	rest, err := queryIDs(ctx, q, restQ, o.ID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]int64{o.TimeslotID}, rest...), nil
+}
+
+// insertOrderTimeslots records the slots after its first that a booking
+// occupies.
+func insertOrderTimeslots(ctx context.Context, tx *sql.Tx, orderID int64, slotIDs []int64) error {
+	if len(slotIDs) == 0 {
+		return nil
+	}
+	const insertQ = `
+INSERT INTO order_timeslots (order_id, timeslot_id)
+SELECT $1, unnest($2::bigint[]);
+`
+	_, err := tx.ExecContext(ctx, insertQ, orderID, slotIDs)
+	return err
+}
+
+// serviceResources returns the resources able to perform service id, empty
+// when any will do.
+func serviceResources(ctx context.Context, q queryer, id int64) ([]int64, error) {
+	return queryIDs(ctx, q, `SELECT resource_id FROM service_resources WHERE service_id = $1 ORDER BY resource_id ASC;`, id)
+}
+
+// chainIDs returns the ids of slots in order.
+func chainIDs(slots []daySlot) []int64 {
+	ids := make([]int64, len(slots))
+	for i := range slots {
+		ids[i] = slots[i].id
+	}
+	return ids
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+)
+
+// slot is an active slot with one free seat and no resources.
+func slot(id int64, start, end string) daySlot {
+	return daySlot{id: id, start: start, end: end, capacity: 1, active: true}
+}
+
+func TestServiceChain(t *testing.T) {
+	day := []daySlot{
+		slot(1, "09:00:00", "09:30:00"),
+		slot(2, "09:30:00", "10:00:00"),
+		slot(3, "09:30:00", "10:30:00"), // overlaps 2; a chain takes the first slot starting on time
+		slot(4, "10:00:00", "10:30:00"),
+		slot(5, "11:00:00", "11:30:00"), // after a gap
+		slot(6, "23:00:00", "23:30:00"),
+		slot(7, "23:30:00", "24:00:00"), // last slot of the day
+	}
+
+	tests := []struct {
+		name    string
+		first   int
+		minutes int
+		want    []int64 // nil: the service does not fit
+	}{
+		{"within one slot", 0, 20, []int64{1}},
+		{"exactly one slot", 0, 30, []int64{1}},
+		{"contiguous slots", 0, 60, []int64{1, 2}},
+		{"three contiguous slots", 0, 90, []int64{1, 2, 4}},
+		{"chain ending mid-slot", 0, 75, []int64{1, 2, 4}},
+		{"gap in the chain", 3, 60, nil},
+		{"gap right after the first slot", 0, 150, nil},
+		{"no slot after", 4, 45, nil},
+		{"up to the end of the day", 5, 60, []int64{6, 7}},
+		{"last slot of the day", 6, 30, []int64{7}},
+		{"past the last slot of the day", 5, 90, nil},
+		{"past midnight from the last slot", 6, 45, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chainIDs(serviceChain(day, tt.first, tt.minutes))
+			if tt.want == nil && len(got) != 0 || tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("serviceChain(%d, %d min) = %v, want %v", day[tt.first].id, tt.minutes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainFree(t *testing.T) {
+	inactive := slot(2, "09:30:00", "10:00:00")
+	inactive.active = false
+	full := slot(2, "09:30:00", "10:00:00")
+	full.reserved = 1
+	withRes := func(s daySlot, resources, free []int64) daySlot {
+		s.resources, s.free = resources, free
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		chain    []daySlot
+		eligible []int64
+		wantOK   bool
+		wantFree []int64
+	}{
+		{"open chain", []daySlot{slot(1, "09:00:00", "09:30:00"), slot(2, "09:30:00", "10:00:00")}, nil, true, nil},
+		{"inactive middle slot", []daySlot{slot(1, "09:00:00", "09:30:00"), inactive, slot(3, "10:00:00", "10:30:00")}, nil, false, nil},
+		{"full middle slot", []daySlot{slot(1, "09:00:00", "09:30:00"), full, slot(3, "10:00:00", "10:30:00")}, nil, false, nil},
+		{"resource free throughout", []daySlot{
+			withRes(slot(1, "09:00:00", "09:30:00"), []int64{10, 11}, []int64{10, 11}),
+			withRes(slot(2, "09:30:00", "10:00:00"), []int64{10, 11}, []int64{11}),
+		}, nil, true, []int64{11}},
+		{"no resource free throughout", []daySlot{
+			withRes(slot(1, "09:00:00", "09:30:00"), []int64{10, 11}, []int64{10}),
+			withRes(slot(2, "09:30:00", "10:00:00"), []int64{10, 11}, []int64{11}),
+		}, nil, false, nil},
+		{"free resource not eligible", []daySlot{
+			withRes(slot(1, "09:00:00", "09:30:00"), []int64{10, 11}, []int64{10, 11}),
+			withRes(slot(2, "09:30:00", "10:00:00"), []int64{10, 11}, []int64{11}),
+		}, []int64{10}, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			free, ok := chainFree(tt.chain, tt.eligible)
+			if ok != tt.wantOK || !slices.Equal(free, tt.wantFree) {
+				t.Errorf("chainFree = %v, %v; want %v, %v", free, ok, tt.wantFree, tt.wantOK)
+			}
+		})
+	}
+}
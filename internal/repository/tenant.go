@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+// ErrNoTenant means a tenant-scoped query ran without a tenant in ctx. It is
+// a wiring bug; failing closed keeps it from leaking other tenants' rows.
+var ErrNoTenant = errors.New("no tenant in context")
+
+// allTenants is the app.tenant_id value for maintenance jobs that work across
+// tenants, e.g. audit retention.
+const allTenants = "*"
+
+var rowLevelSecurity bool
+
+// EnableRowLevelSecurity makes every query run in a transaction that sets
+// app.tenant_id, for databases where migrations/rls has been applied. Call
+// it once at startup, before serving.
+func EnableRowLevelSecurity() {
+	rowLevelSecurity = true
+}
+
+func tenantID(ctx context.Context) (int64, error) {
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return 0, ErrNoTenant
+	}
+	return t.ID, nil
+}
+
+// beginTx starts a transaction carrying the tenant for row-level security.
+func beginTx(ctx context.Context, db *sql.DB, tenantID int64) (*sql.Tx, error) {
+	return beginTxAs(ctx, db, strconv.FormatInt(tenantID, 10), &sql.TxOptions{})
+}
+
+func beginTxAs(ctx context.Context, db *sql.DB, setting string, opts *sql.TxOptions) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if rowLevelSecurity {
+		if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true);`, setting); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// reader returns what read-only queries run on: the pool itself, or with
+// row-level security a read-only transaction carrying the tenant. Call done
+// when finished reading.
+func reader(ctx context.Context, db *sql.DB, tenantID int64) (q queryer, done func(), err error) {
+	if !rowLevelSecurity {
+		return db, func() {}, nil
+	}
+	tx, err := beginTxAs(ctx, db, strconv.FormatInt(tenantID, 10), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, func() { _ = tx.Rollback() }, nil
+}
+
+// TenantRepository resolves tenants. Lookups are not tenant-scoped: they run
+// before the tenant of a request is known.
+type TenantRepository struct {
+	db *sql.DB
+}
+
+func NewTenantRepository(db *sql.DB) *TenantRepository {
+	return &TenantRepository{db: db}
+}
+
+const tenantColumns = `id, slug, name, array_to_string(hosts, ','), is_active, created_at`
+
+func (r *TenantRepository) get(ctx context.Context, where string, arg any) (model.Tenant, error) {
+	var (
+		t     model.Tenant
+		hosts string
+	)
+	err := r.db.QueryRowContext(ctx, `
+SELECT `+tenantColumns+`
+FROM tenants
+WHERE is_active AND `+where+`;`, arg).Scan(
+		&t.ID, &t.Slug, &t.Name, &hosts, &t.IsActive, &t.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Tenant{}, tenant.ErrNotFound
+	}
+	if err != nil {
+		return model.Tenant{}, err
+	}
+	t.Hosts = splitList(hosts)
+	return t, nil
+}
+
+// ByHost returns the active tenant serving host (lower-case, without port).
+func (r *TenantRepository) ByHost(ctx context.Context, host string) (model.Tenant, error) {
+	return r.get(ctx, `$1 = ANY(hosts)`, host)
+}
+
+func (r *TenantRepository) BySlug(ctx context.Context, slug string) (model.Tenant, error) {
+	return r.get(ctx, `slug = $1`, slug)
+}
+
+func (r *TenantRepository) ByID(ctx context.Context, id int64) (model.Tenant, error) {
+	return r.get(ctx, `id = $1`, id)
+}
+
+func (r *TenantRepository) Count(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM tenants WHERE is_active;`).Scan(&n)
+	return n, err
+}
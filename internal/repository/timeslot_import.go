@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+// TimeslotImportRow is one well-formed import row; Line is its line in the
+// source file, for error reports.
+type TimeslotImportRow struct {
+	Line       int
+	BranchID   int64
+	Date       string // YYYY-MM-DD
+	Start, End string // HH:MM, branch-local
+	Capacity   int
+	IsActive   bool
+}
+
+// ImportRowError rejects a row; Field names the offending column and Code is
+// a problem.Field* code. Conflict is the slot an overlapping row runs into.
+type ImportRowError struct {
+	Line     int
+	Field    string
+	Code     string
+	Conflict *model.TimeslotConflict
+}
+
+// ImportOptions control how an import is applied.
+type ImportOptions struct {
+	// DryRun checks every row against the database and rolls back.
+	DryRun bool
+	// AllOrNothing rolls back when any row fails; otherwise failing rows are
+	// skipped and the rest applied.
+	AllOrNothing bool
+}
+
+// ImportResult reports an import. Created and Updated count the rows that
+// were, or in a dry run or rejected import would have been, written.
+type ImportResult struct {
+	Created int
+	Updated int
+	Errors  []ImportRowError
+	Applied bool
+}
+
+// Import upserts timeslots keyed on ux_timeslots_unique_slot (branch, date,
+// start, end): new slots are created, existing ones get the row's capacity
+// and is_active. Rows are checked against what only the database knows: the
+// branch exists in this tenant and is active, the clock exists in its time
+// zone, capacity does not drop below seats already reserved, and in branches
+// that do not allow it, the slot overlaps no other (earlier rows included).
+// Each branch's changes are audited as actorAt(branch).
+func (r *TimeslotRepository) Import(ctx context.Context, actorAt func(branchID int64) model.Actor, rows []TimeslotImportRow, opts ImportOptions) (ImportResult, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	type branchState struct {
+		branch           model.Branch
+		err              string // problem.Field* code when rows of this branch are rejected
+		created, updated int
+		dates            map[string]bool
+	}
+	branches := make(map[int64]*branchState)
+
+	const upsertQ = `
+INSERT INTO timeslots (branch_id, service_date, start_time, end_time, capacity, is_active)
+VALUES ($1, $2::date, $3::time, $4::time, $5, $6)
+ON CONFLICT (branch_id, service_date, start_time, end_time) DO UPDATE
+SET capacity = EXCLUDED.capacity,
+    is_active = EXCLUDED.is_active,
+    updated_at = now()
+WHERE timeslots.reserved <= EXCLUDED.capacity
+  AND (timeslots.capacity = EXCLUDED.capacity
+    OR NOT EXISTS (SELECT 1 FROM timeslot_resources tr WHERE tr.timeslot_id = timeslots.id))
+RETURNING (xmax = 0);
+`
+	// resourcedQ tells why an existing slot was left alone
+	const resourcedQ = `
+SELECT EXISTS (
+  SELECT 1
+  FROM timeslots t
+  JOIN timeslot_resources tr ON tr.timeslot_id = t.id
+  WHERE t.branch_id = $1 AND t.service_date = $2::date
+    AND t.start_time = $3::time AND t.end_time = $4::time
+);
+`
+	// branches are locked so that their no-overlap mode cannot change
+	// underneath, in id order so that concurrent imports cannot deadlock
+	for _, row := range rows {
+		branches[row.BranchID] = nil
+	}
+	ids := make([]int64, 0, len(branches))
+	for id := range branches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		st := &branchState{dates: make(map[string]bool)}
+		st.branch, err = getBranch(ctx, tx, tid, id, true)
+		switch {
+		case errors.Is(err, ErrBranchNotFound):
+			st.err = problem.FieldNotFound
+		case err != nil:
+			return ImportResult{}, err
+		case !st.branch.IsActive:
+			st.err = problem.FieldInactive
+		}
+		branches[id] = st
+	}
+
+	var res ImportResult
+	for _, row := range rows {
+		st := branches[row.BranchID]
+		if st.err != "" {
+			res.Errors = append(res.Errors, ImportRowError{Line: row.Line, Field: "branch", Code: st.err})
+			continue
+		}
+
+		loc, err := st.branch.Location()
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if !clockExists(loc, row.Date, row.Start) {
+			res.Errors = append(res.Errors, ImportRowError{Line: row.Line, Field: "start", Code: problem.FieldNonexistentTime})
+			continue
+		}
+		if !clockExists(loc, row.Date, row.End) {
+			res.Errors = append(res.Errors, ImportRowError{Line: row.Line, Field: "end", Code: problem.FieldNonexistentTime})
+			continue
+		}
+
+		check, err := checksOverlap(st.branch, row.Date)
+		if err != nil {
+			return ImportResult{}, err
+		}
+		if check {
+			overlap, err := overlappingSlot(ctx, tx, row.BranchID, row.Date, row.Start, row.End)
+			if err != nil {
+				return ImportResult{}, err
+			}
+			if overlap != nil {
+				res.Errors = append(res.Errors, ImportRowError{
+					Line: row.Line, Field: "start", Code: problem.FieldOverlaps, Conflict: &overlap.Conflict,
+				})
+				continue
+			}
+		}
+
+		// a violation aborts the transaction; the savepoint keeps it usable
+		// for looking up the slot in the way. It is taken for every row of a
+		// no-overlap branch: the trigger judges "today" by the database clock,
+		// which may already be past midnight when checksOverlap ran
+		savepoint := st.branch.NoOverlap
+		if savepoint {
+			if _, err := tx.ExecContext(ctx, `SAVEPOINT import_row;`); err != nil {
+				return ImportResult{}, err
+			}
+		}
+		var inserted bool
+		err = tx.QueryRowContext(ctx, upsertQ,
+			row.BranchID, row.Date, row.Start, row.End, row.Capacity, row.IsActive,
+		).Scan(&inserted)
+		violated := pgErrorIs(err, pgExclusionViolation, "ex_timeslots_no_overlap")
+		if violated {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT import_row;`); err != nil {
+				return ImportResult{}, err
+			}
+		}
+		if savepoint && (err == nil || violated || errors.Is(err, sql.ErrNoRows)) {
+			// release it right away: each open one is a subtransaction, and
+			// past 64 of them every later statement slows down
+			if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT import_row;`); err != nil {
+				return ImportResult{}, err
+			}
+		}
+		switch {
+		case violated:
+			// a slot was added concurrently
+			overlap, err := overlappingSlot(ctx, tx, row.BranchID, row.Date, row.Start, row.End)
+			if err != nil {
+				return ImportResult{}, err
+			}
+			if overlap == nil {
+				return ImportResult{}, ErrTimeslotOverlap
+			}
+			res.Errors = append(res.Errors, ImportRowError{
+				Line: row.Line, Field: "start", Code: problem.FieldOverlaps, Conflict: &overlap.Conflict,
+			})
+			continue
+		case errors.Is(err, sql.ErrNoRows):
+			// the slot exists and either draws its capacity from resources or
+			// has more seats reserved than the new capacity
+			var resourced bool
+			if err := tx.QueryRowContext(ctx, resourcedQ, row.BranchID, row.Date, row.Start, row.End).Scan(&resourced); err != nil {
+				return ImportResult{}, err
+			}
+			code := problem.FieldBelowReserved
+			if resourced {
+				code = problem.FieldSetByResources
+			}
+			res.Errors = append(res.Errors, ImportRowError{Line: row.Line, Field: "capacity", Code: code})
+			continue
+		case err != nil:
+			return ImportResult{}, err
+		case inserted:
+			st.created++
+			res.Created++
+		default:
+			st.updated++
+			res.Updated++
+		}
+		st.dates[row.Date] = true
+	}
+
+	if opts.DryRun || (opts.AllOrNothing && len(res.Errors) > 0) {
+		return res, nil
+	}
+
+	for _, id := range ids {
+		st := branches[id]
+		if st.created+st.updated == 0 {
+			continue
+		}
+		if err := audit.Record(ctx, tx, audit.Entry{
+			Actor:      actorAt(id),
+			Action:     "timeslot.import",
+			EntityType: audit.EntityBranch,
+			EntityID:   strconv.FormatInt(id, 10),
+			After: map[string]any{
+				"created": st.created,
+				"updated": st.updated,
+			},
+		}); err != nil {
+			return ImportResult{}, err
+		}
+		for date := range st.dates {
+			if err := notifyAvailability(ctx, tx, id, date); err != nil {
+				return ImportResult{}, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ImportResult{}, err
+	}
+	res.Applied = true
+	return res, nil
+}
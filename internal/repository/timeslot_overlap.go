@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+// ErrTimeslotOverlap is returned when a slot would overlap another one of a
+// branch in no-overlap mode. It is wrapped by *TimeslotOverlapError when the
+// other slot is known.
+var ErrTimeslotOverlap = errors.New("timeslot overlaps another timeslot of the branch")
+
+// TimeslotOverlapError names the slot that is in the way.
+type TimeslotOverlapError struct {
+	Conflict model.TimeslotConflict
+}
+
+func (e *TimeslotOverlapError) Error() string {
+	return ErrTimeslotOverlap.Error() + " (timeslot " + strconv.FormatInt(e.Conflict.ID, 10) + ")"
+}
+
+func (e *TimeslotOverlapError) Unwrap() error {
+	return ErrTimeslotOverlap
+}
+
+// overlappingSlot finds the earliest slot of branchID on date checked by
+// ex_timeslots_no_overlap that shares a moment with start–end. The slot with
+// exactly these times is skipped, as inserts leave it alone and upserts
+// update it in place.
+func overlappingSlot(ctx context.Context, q queryer, branchID int64, date, start, end string) (*TimeslotOverlapError, error) {
+	const overlapQ = `
+SELECT t.id, t.service_date::text, t.start_time::text, t.end_time::text
+FROM timeslots t
+WHERE t.branch_id = $1
+  AND t.service_date = $2::date
+  AND t.no_overlap
+  AND t.start_time < $4::time
+  AND t.end_time > $3::time
+  AND NOT (t.start_time = $3::time AND t.end_time = $4::time)
+ORDER BY t.start_time ASC, t.id ASC
+LIMIT 1;
+`
+	var c model.TimeslotConflict
+	err := q.QueryRowContext(ctx, overlapQ, branchID, date, start, end).Scan(&c.ID, &c.ServiceDate, &c.StartTime, &c.EndTime)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return &TimeslotOverlapError{Conflict: c}, nil
+}
+
+// checksOverlap reports whether a new slot of b on date falls under the
+// no-overlap mode. Slots dated before the branch's today are history and stay
+// unchecked, as in setNoOverlap and the insert trigger.
+func checksOverlap(b model.Branch, date string) (bool, error) {
+	if !b.NoOverlap {
+		return false, nil
+	}
+	loc, err := b.Location()
+	if err != nil {
+		return false, err
+	}
+	today, err := model.ResolveDate(loc, time.Now(), "today")
+	if err != nil {
+		return false, err
+	}
+	return date >= today, nil
+}
+
+// setNoOverlap switches a branch's no-overlap mode on its slots. Switching it
+// on checks the slots from the branch's today on and fails with the later slot
+// of the first overlapping pair; earlier slots are history and stay unchecked.
+// The caller must hold the branch row lock (getBranch with forUpdate): slot
+// inserts take it too, so none can pick up the old mode while it changes.
+func setNoOverlap(ctx context.Context, tx *sql.Tx, b model.Branch, on bool) error {
+	if !on {
+		_, err := tx.ExecContext(ctx, `UPDATE timeslots SET no_overlap = FALSE WHERE branch_id = $1 AND no_overlap;`, b.ID)
+		return err
+	}
+
+	loc, err := b.Location()
+	if err != nil {
+		return err
+	}
+	today, err := model.ResolveDate(loc, time.Now(), "today")
+	if err != nil {
+		return err
+	}
+
+	const pairQ = `
+SELECT l.id, l.service_date::text, l.start_time::text, l.end_time::text
+FROM timeslots e
+JOIN timeslots l
+  ON l.branch_id = e.branch_id
+ AND l.service_date = e.service_date
+ AND (l.start_time, l.id) > (e.start_time, e.id)
+ AND l.start_time < e.end_time
+WHERE e.branch_id = $1
+  AND e.service_date >= $2::date
+ORDER BY l.service_date ASC, l.start_time ASC, l.id ASC
+LIMIT 1;
+`
+	var c model.TimeslotConflict
+	err = tx.QueryRowContext(ctx, pairQ, b.ID, today).Scan(&c.ID, &c.ServiceDate, &c.StartTime, &c.EndTime)
+	switch {
+	case err == nil:
+		return &TimeslotOverlapError{Conflict: c}
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	const markQ = `
+UPDATE timeslots
+SET no_overlap = TRUE
+WHERE branch_id = $1 AND service_date >= $2::date;
+`
+	if _, err := tx.ExecContext(ctx, markQ, b.ID, today); err != nil {
+		return err
+	}
+	return nil
+}
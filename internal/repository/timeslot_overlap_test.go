@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/db"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+)
+
+// The tests below need a migrated database (DB_* as for the API) and run only
+// with DB_INTEGRATION=true. They work in a tenant of their own.
+
+func testTenant(t *testing.T) (context.Context, *BranchRepository, *TimeslotRepository) {
+	t.Helper()
+	if os.Getenv("DB_INTEGRATION") != "true" {
+		t.Skip("DB_INTEGRATION not set")
+	}
+	database, err := db.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	slug := "test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	var tn model.Tenant
+	if err := database.QueryRow(`INSERT INTO tenants (slug, name) VALUES ($1, $1) RETURNING id, slug;`, slug).Scan(&tn.ID, &tn.Slug); err != nil {
+		t.Fatal(err)
+	}
+	return tenant.WithTenant(context.Background(), tn), NewBranchRepository(database), NewTimeslotRepository(database)
+}
+
+func TestEnableNoOverlapWithOverlappingSlots(t *testing.T) {
+	ctx, branches, slots := testTenant(t)
+	actor := model.Actor{Type: model.ActorSystem}
+
+	b, err := branches.Create(ctx, actor, model.Branch{
+		Name:              "Overlaps",
+		Timezone:          "UTC",
+		BookingPolicy:     model.BookingPolicy{MaxAdvanceDays: 60},
+		ReliabilityPolicy: model.ReliabilityPolicy{WindowDays: 90},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1).Format("2006-01-02")
+	tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+
+	importRows := func(rows ...TimeslotImportRow) ImportResult {
+		t.Helper()
+		for i := range rows {
+			rows[i].Line, rows[i].BranchID, rows[i].Capacity, rows[i].IsActive = i+2, b.ID, 1, true
+		}
+		res, err := slots.Import(ctx, func(int64) model.Actor { return actor }, rows, ImportOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	enable := func() error {
+		on := true
+		_, err := branches.Update(ctx, actor, b.ID, BranchUpdate{NoOverlap: &on})
+		return err
+	}
+
+	importRows(
+		TimeslotImportRow{Date: yesterday, Start: "10:00", End: "11:00"},
+		TimeslotImportRow{Date: yesterday, Start: "10:30", End: "11:30"},
+		TimeslotImportRow{Date: tomorrow, Start: "10:00", End: "11:00"},
+		TimeslotImportRow{Date: tomorrow, Start: "10:30", End: "11:30"},
+	)
+
+	var overlap *TimeslotOverlapError
+	if err := enable(); !errors.As(err, &overlap) {
+		t.Fatalf("enable with overlapping slots: got %v, want *TimeslotOverlapError", err)
+	}
+	if c := overlap.Conflict; c.ServiceDate != tomorrow || c.StartTime != "10:30:00" {
+		t.Errorf("conflict = %+v, want %s 10:30:00", c, tomorrow)
+	}
+
+	// the mode stayed off; drop the later slot of the pair
+	if _, err := slots.db.Exec(`DELETE FROM timeslots WHERE id = $1;`, overlap.Conflict.ID); err != nil {
+		t.Fatal(err)
+	}
+	// yesterday's pair is history and does not block the mode
+	if err := enable(); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+
+	res := importRows(
+		TimeslotImportRow{Date: tomorrow, Start: "10:45", End: "11:15"},
+		TimeslotImportRow{Date: yesterday, Start: "10:15", End: "10:45"},
+	)
+	if res.Created != 1 || len(res.Errors) != 1 {
+		t.Fatalf("import = %+v, want 1 created and 1 error", res)
+	}
+	if e := res.Errors[0]; e.Line != 2 || e.Conflict == nil || e.Conflict.StartTime != "10:00:00" {
+		t.Errorf("error = %+v, want line 2 overlapping the 10:00 slot", e)
+	}
+
+	var flagged []bool
+	rows, err := slots.db.Query(`SELECT no_overlap FROM timeslots WHERE branch_id = $1 ORDER BY service_date, start_time;`, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f bool
+		if err := rows.Scan(&f); err != nil {
+			t.Fatal(err)
+		}
+		flagged = append(flagged, f)
+	}
+	// yesterday 10:00, 10:15, 10:30; tomorrow 10:00
+	want := []bool{false, false, false, true}
+	if len(flagged) != len(want) {
+		t.Fatalf("no_overlap = %v, want %v", flagged, want)
+	}
+	for i := range want {
+		if flagged[i] != want[i] {
+			t.Fatalf("no_overlap = %v, want %v", flagged, want)
+		}
+	}
+}
@@ -3,14 +3,84 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
 	"github.com/idlistic/go-backend-api-sample/internal/model"
 )
 
+var ErrCapacityBelowReserved = errors.New("capacity is below reserved seats")
+
 type TimeslotRepository struct {
 	db *sql.DB
 }
 
+// TimeslotUpdate holds the editable fields; nil means "leave as is".
+type TimeslotUpdate struct {
+	Capacity *int
+	IsActive *bool
+}
+
+// timeslotSelect reads the columns scanned by scanTimeslot; callers append WHERE/ORDER.
+// Resource IDs are read as comma-separated text.
+const timeslotSelect = `
+SELECT
+  t.id, t.branch_id, t.service_date::text, t.start_time::text, t.end_time::text,
+  t.capacity, t.reserved, t.is_active, t.created_at, t.updated_at,
+  b.timezone, COALESCE(res.ids, ''), res.free
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+CROSS JOIN LATERAL (
+  SELECT string_agg(r.id::text, ',' ORDER BY r.id) AS ids,
+         count(*) FILTER (WHERE ` + resourceFree + `) AS free
+  FROM timeslot_resources tr
+  JOIN resources r ON r.id = tr.resource_id
+  WHERE tr.timeslot_id = t.id
+) res`
+
+func scanTimeslot(row interface{ Scan(...any) error }, t *model.Timeslot) error {
+	var (
+		tz, resourceIDs string
+		free            int
+	)
+	if err := row.Scan(
+		&t.ID,
+		&t.BranchID,
+		&t.ServiceDate,
+		&t.StartTime,
+		&t.EndTime,
+		&t.Capacity,
+		&t.Reserved,
+		&t.IsActive,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+		&tz,
+		&resourceIDs,
+		&free,
+	); err != nil {
+		return err
+	}
+
+	t.ResourceIDs = make([]int64, 0, 4)
+	for _, s := range splitList(resourceIDs) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		t.ResourceIDs = append(t.ResourceIDs, id)
+	}
+	t.FreeResources = nil
+	if len(t.ResourceIDs) > 0 {
+		t.FreeResources = &free
+	}
+
+	var err error
+	t.StartsAt, t.EndsAt, err = slotInstants(tz, t.ServiceDate, t.StartTime, t.EndTime)
+	return err
+}
+
 func NewTimeslotRepository(db *sql.DB) *TimeslotRepository {
 	return &TimeslotRepository{db: db}
 }
@@ -21,17 +91,24 @@ func (r *TimeslotRepository) ListByBranchAndDate(
 	date string, // YYYY-MM-DD
 ) ([]model.Timeslot, error) {
 
-	const q = `
-SELECT
-  id, branch_id, service_date, start_time, end_time,
-  capacity, reserved, is_active, created_at, updated_at
-FROM timeslots
-WHERE branch_id = $1
-  AND service_date = $2::date
-ORDER BY start_time ASC;
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = timeslotSelect + `
+WHERE t.branch_id = $1
+  AND t.service_date = $2::date
+  AND b.tenant_id = $3
+ORDER BY t.start_time ASC;
 `
 
-	rows, err := r.db.QueryContext(ctx, q, branchID, date)
+	rows, err := db.QueryContext(ctx, q, branchID, date, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -41,18 +118,7 @@ ORDER BY start_time ASC;
 
 	for rows.Next() {
 		var t model.Timeslot
-		if err := rows.Scan(
-			&t.ID,
-			&t.BranchID,
-			&t.ServiceDate,
-			&t.StartTime,
-			&t.EndTime,
-			&t.Capacity,
-			&t.Reserved,
-			&t.IsActive,
-			&t.CreatedAt,
-			&t.UpdatedAt,
-		); err != nil {
+		if err := scanTimeslot(rows, &t); err != nil {
 			return nil, err
 		}
 		out = append(out, t)
@@ -64,3 +130,406 @@ ORDER BY start_time ASC;
 
 	return out, nil
 }
+
+// BranchOf returns the branch a timeslot belongs to, so callers can authorize
+// before acting on it.
+func (r *TimeslotRepository) BranchOf(ctx context.Context, id int64) (int64, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+
+	const q = `
+SELECT t.branch_id
+FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
+WHERE t.id = $1 AND b.tenant_id = $2;
+`
+	var branchID int64
+	err = db.QueryRowContext(ctx, q, id, tid).Scan(&branchID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrTimeslotNotFound
+	}
+	return branchID, err
+}
+
+// GenerateRequest describes slots to create from a branch's operating hours.
+type GenerateRequest struct {
+	BranchID    int64
+	From        string // YYYY-MM-DD or today/tomorrow/yesterday in branch-local time; "" = today
+	Days        int
+	SlotMinutes int
+	Capacity    int
+}
+
+// GenerateFromOperatingHours creates back-to-back slots of SlotMinutes inside the
+// opening interval of each day, for Days branch-local dates starting at From.
+// Slots that already exist are left untouched; the number created is returned.
+// Slots touching a wall clock skipped by a DST transition are not generated.
+// In a branch that does not allow overlapping slots, a slot overlapping an
+// existing one fails the whole run with a *TimeslotOverlapError.
+func (r *TimeslotRepository) GenerateFromOperatingHours(ctx context.Context, actor model.Actor, req GenerateRequest) (int, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// locked so that the no-overlap mode cannot change underneath
+	branch, err := getBranch(ctx, tx, tid, req.BranchID, true)
+	if err != nil {
+		return 0, err
+	}
+	if !branch.IsActive {
+		return 0, ErrBranchInactive
+	}
+
+	loc, err := branch.Location()
+	if err != nil {
+		return 0, err
+	}
+
+	from := req.From
+	if from == "" {
+		from = "today"
+	}
+	// "today" is the branch's date, not the DB server's CURRENT_DATE
+	if from, err = model.ResolveDate(loc, time.Now(), from); err != nil {
+		return 0, err
+	}
+	day, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, err
+	}
+
+	const insertQ = `
+INSERT INTO timeslots (branch_id, service_date, start_time, end_time, capacity)
+VALUES ($1, $2::date, $3::time, $4::time, $5)
+ON CONFLICT (branch_id, service_date, start_time, end_time) DO NOTHING;
+`
+	created := 0
+	for i := 0; i < req.Days; i++ {
+		d := day.AddDate(0, 0, i)
+		hours, ok := branch.HoursOn(d.Weekday())
+		if !ok {
+			continue
+		}
+
+		opensAt, _ := time.Parse("15:04", hours.OpenTime)
+		closesAt, _ := time.Parse("15:04", hours.CloseTime)
+		step := time.Duration(req.SlotMinutes) * time.Minute
+
+		date := d.Format("2006-01-02")
+		createdOnDate := 0
+		for start := opensAt; !start.Add(step).After(closesAt); start = start.Add(step) {
+			startClock, endClock := start.Format("15:04"), start.Add(step).Format("15:04")
+			if !clockExists(loc, date, startClock) || !clockExists(loc, date, endClock) {
+				continue
+			}
+
+			check, err := checksOverlap(branch, date)
+			if err != nil {
+				return 0, err
+			}
+			if check {
+				overlap, err := overlappingSlot(ctx, tx, req.BranchID, date, startClock, endClock)
+				if err != nil {
+					return 0, err
+				}
+				if overlap != nil {
+					return 0, overlap
+				}
+			}
+
+			res, err := tx.ExecContext(ctx, insertQ, req.BranchID, date, startClock, endClock, req.Capacity)
+			if pgErrorIs(err, pgExclusionViolation, "ex_timeslots_no_overlap") {
+				return 0, ErrTimeslotOverlap
+			}
+			if err != nil {
+				return 0, err
+			}
+			n, _ := res.RowsAffected()
+			createdOnDate += int(n)
+		}
+		if createdOnDate > 0 {
+			if err := notifyAvailability(ctx, tx, req.BranchID, date); err != nil {
+				return 0, err
+			}
+		}
+		created += createdOnDate
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "timeslot.generate",
+		EntityType: audit.EntityBranch,
+		EntityID:   strconv.FormatInt(req.BranchID, 10),
+		After: map[string]any{
+			"from":         from,
+			"days":         req.Days,
+			"slot_minutes": req.SlotMinutes,
+			"capacity":     req.Capacity,
+			"created":      created,
+		},
+	}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return created, nil
+}
+
+// Update changes capacity and/or is_active. Capacity can never drop below the
+// seats already reserved.
+func (r *TimeslotRepository) Update(ctx context.Context, actor model.Actor, id int64, u TimeslotUpdate) (model.Timeslot, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Timeslot{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Timeslot{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var before model.Timeslot
+	if err := scanTimeslot(tx.QueryRowContext(ctx, timeslotSelect+`
+WHERE t.id = $1 AND b.tenant_id = $2
+FOR UPDATE OF t;`, id, tid), &before); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Timeslot{}, ErrTimeslotNotFound
+		}
+		return model.Timeslot{}, err
+	}
+
+	capacity, isActive := before.Capacity, before.IsActive
+	if u.Capacity != nil {
+		capacity = *u.Capacity
+	}
+	if u.IsActive != nil {
+		isActive = *u.IsActive
+	}
+	if capacity != before.Capacity && len(before.ResourceIDs) > 0 {
+		return model.Timeslot{}, ErrCapacityFromResources
+	}
+	if capacity < before.Reserved {
+		return model.Timeslot{}, ErrCapacityBelowReserved
+	}
+
+	const updateQ = `
+UPDATE timeslots
+SET capacity = $2,
+    is_active = $3,
+    updated_at = now()
+WHERE id = $1;
+`
+	if _, err := tx.ExecContext(ctx, updateQ, id, capacity, isActive); err != nil {
+		return model.Timeslot{}, err
+	}
+
+	var after model.Timeslot
+	if err := scanTimeslot(tx.QueryRowContext(ctx, timeslotSelect+`
+WHERE t.id = $1;`, id), &after); err != nil {
+		return model.Timeslot{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "timeslot.update",
+		EntityType: audit.EntityTimeslot,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      after,
+	}); err != nil {
+		return model.Timeslot{}, err
+	}
+	if err := notifyAvailability(ctx, tx, after.BranchID, after.ServiceDate); err != nil {
+		return model.Timeslot{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Timeslot{}, err
+	}
+	return after, nil
+}
+
+// SetResources replaces the resources serving a timeslot. A slot with
+// resources has one seat per resource; an empty list leaves the capacity as
+// it is and lets it be edited again. Resources held by open bookings of the
+// slot cannot be removed, and open bookings made before the slot had
+// resources are each given one.
+func (r *TimeslotRepository) SetResources(ctx context.Context, actor model.Actor, id int64, resourceIDs []int64) (model.Timeslot, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.Timeslot{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.Timeslot{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var before model.Timeslot
+	if err := scanTimeslot(tx.QueryRowContext(ctx, timeslotSelect+`
+WHERE t.id = $1 AND b.tenant_id = $2
+FOR UPDATE OF t;`, id, tid), &before); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Timeslot{}, ErrTimeslotNotFound
+		}
+		return model.Timeslot{}, err
+	}
+
+	var found int
+	if err := tx.QueryRowContext(ctx, `
+SELECT count(*) FROM resources WHERE id = ANY($1) AND branch_id = $2;`,
+		resourceIDs, before.BranchID,
+	).Scan(&found); err != nil {
+		return model.Timeslot{}, err
+	}
+	if found != len(resourceIDs) {
+		return model.Timeslot{}, ErrResourceNotFound
+	}
+
+	var held bool
+	if err := tx.QueryRowContext(ctx, `
+SELECT EXISTS (
+  SELECT 1
+  FROM orders
+  WHERE timeslot_id = $1
+    AND status IN ('created', 'unconfirmed', 'checked_in', 'no_show')
+    AND resource_id IS NOT NULL
+    AND NOT resource_id = ANY($2)
+);`, id, resourceIDs).Scan(&held); err != nil {
+		return model.Timeslot{}, err
+	}
+	if held {
+		return model.Timeslot{}, ErrResourceInUse
+	}
+	if len(resourceIDs) > 0 && len(resourceIDs) < before.Reserved {
+		return model.Timeslot{}, ErrCapacityBelowReserved
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM timeslot_resources WHERE timeslot_id = $1;`, id); err != nil {
+		return model.Timeslot{}, err
+	}
+	if len(resourceIDs) > 0 {
+		const assignQ = `
+INSERT INTO timeslot_resources (timeslot_id, resource_id)
+SELECT $1, unnest($2::bigint[]);
+`
+		if _, err := tx.ExecContext(ctx, assignQ, id, resourceIDs); err != nil {
+			return model.Timeslot{}, err
+		}
+		const capacityQ = `
+UPDATE timeslots
+SET capacity = $2,
+    updated_at = now()
+WHERE id = $1;
+`
+		if _, err := tx.ExecContext(ctx, capacityQ, id, len(resourceIDs)); err != nil {
+			return model.Timeslot{}, err
+		}
+		if err := assignOpenOrders(ctx, tx, id); err != nil {
+			return model.Timeslot{}, err
+		}
+	}
+
+	var after model.Timeslot
+	if err := scanTimeslot(tx.QueryRowContext(ctx, timeslotSelect+`
+WHERE t.id = $1;`, id), &after); err != nil {
+		return model.Timeslot{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "timeslot.resources",
+		EntityType: audit.EntityTimeslot,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      after,
+	}); err != nil {
+		return model.Timeslot{}, err
+	}
+	if err := notifyAvailability(ctx, tx, after.BranchID, after.ServiceDate); err != nil {
+		return model.Timeslot{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Timeslot{}, err
+	}
+	return after, nil
+}
+
+// assignOpenOrders gives a resource to every open booking starting in a slot
+// that has none; service bookings need one free in all their slots. When there
+// are not enough free resources the seats already reserved cannot be served,
+// which is reported as ErrCapacityBelowReserved.
+func assignOpenOrders(ctx context.Context, tx *sql.Tx, slotID int64) error {
+	const pendingQ = `
+SELECT ` + orderColumns + `
+FROM orders
+WHERE timeslot_id = $1
+  AND status IN ('created', 'unconfirmed', 'checked_in', 'no_show')
+  AND resource_id IS NULL
+ORDER BY id ASC
+FOR UPDATE;
+`
+	rows, err := tx.QueryContext(ctx, pendingQ, slotID)
+	if err != nil {
+		return err
+	}
+	var pending []model.Order
+	for rows.Next() {
+		var o model.Order
+		if err := scanOrder(rows, &o); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range pending {
+		chain, err := orderSlots(ctx, tx, o)
+		if err != nil {
+			return err
+		}
+		var eligible []int64
+		if o.ServiceID != nil {
+			if eligible, err = serviceResources(ctx, tx, *o.ServiceID); err != nil {
+				return err
+			}
+		}
+
+		resourceID, err := assignResource(ctx, tx, chain, eligible, 0, 0)
+		if errors.Is(err, ErrTimeslotFullyBooked) || errors.Is(err, ErrResourceNotAssigned) {
+			return ErrCapacityBelowReserved
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE orders SET resource_id = $2, updated_at = now() WHERE id = $1;`, o.ID, resourceID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func clockExists(loc *time.Location, date, clock string) bool {
+	_, ok, err := model.LocalInstant(loc, date, clock)
+	return err == nil && ok
+}
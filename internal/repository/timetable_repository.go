@@ -22,31 +22,49 @@ func (r *TimetableRepository) GetOrdersTimetable(
 	date string, // YYYY-MM-DD
 ) ([]model.TimetableItem, error) {
 
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	// LEFT JOIN เพื่อให้ timeslot ที่ไม่มี order ก็ยังออกมา (orders = [])
+	// order ของ service ที่ยาวหลาย slot จะออกมาในทุก slot ที่จองไว้
 	const q = `
 SELECT
   t.id,
-  t.start_time,
-  t.end_time,
+  t.start_time::text,
+  t.end_time::text,
   t.capacity,
   t.reserved,
   t.is_active,
+  b.timezone,
 
   o.id AS order_id,
   o.customer_name,
   o.status,
-  o.created_at
+  o.created_at,
+  r.id,
+  r.name
 FROM timeslots t
+JOIN branches b ON b.id = t.branch_id
 LEFT JOIN orders o
-  ON o.timeslot_id = t.id
+  ON (o.timeslot_id = t.id
+      OR o.id IN (SELECT ot.order_id FROM order_timeslots ot WHERE ot.timeslot_id = t.id))
  AND o.branch_id = t.branch_id
- AND o.status = 'created'
+ AND o.status IN ('created', 'unconfirmed', 'checked_in', 'no_show')
+LEFT JOIN resources r ON r.id = o.resource_id
 WHERE t.branch_id = $1
   AND t.service_date = $2::date
+  AND b.tenant_id = $3
 ORDER BY t.start_time ASC, o.created_at ASC;
 `
 
-	rows, err := r.db.QueryContext(ctx, q, branchID, date)
+	rows, err := db.QueryContext(ctx, q, branchID, date, tid)
 	if err != nil {
 		return nil, err
 	}
@@ -64,11 +82,14 @@ ORDER BY t.start_time ASC, o.created_at ASC;
 			capacity  int
 			reserved  int
 			isActive  bool
+			tz        string
 
 			orderID       sql.NullInt64
 			customerName  sql.NullString
 			status        sql.NullString
 			createdAtTime sql.NullTime
+			resourceID    sql.NullInt64
+			resourceName  sql.NullString
 		)
 
 		if err := rows.Scan(
@@ -78,21 +99,36 @@ ORDER BY t.start_time ASC, o.created_at ASC;
 			&capacity,
 			&reserved,
 			&isActive,
+			&tz,
 			&orderID,
 			&customerName,
 			&status,
 			&createdAtTime,
+			&resourceID,
+			&resourceName,
 		); err != nil {
 			return nil, err
 		}
 
+		loc, err := loadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+
 		pos, ok := indexByTimeslot[tsID]
 		if !ok {
+			startsAt, endsAt, err := model.SlotInstants(loc, date, startTime, endTime)
+			if err != nil {
+				return nil, err
+			}
+
 			items = append(items, model.TimetableItem{
 				Timeslot: model.TimetableTimeslot{
 					ID:        tsID,
 					StartTime: startTime,
 					EndTime:   endTime,
+					StartsAt:  startsAt.Format(time.RFC3339),
+					EndsAt:    endsAt.Format(time.RFC3339),
 					Capacity:  capacity,
 					Reserved:  reserved,
 					IsActive:  isActive,
@@ -107,13 +143,15 @@ ORDER BY t.start_time ASC, o.created_at ASC;
 		if orderID.Valid {
 			createdAt := ""
 			if createdAtTime.Valid {
-				createdAt = createdAtTime.Time.UTC().Format(time.RFC3339)
+				createdAt = createdAtTime.Time.In(loc).Format(time.RFC3339)
 			}
 
 			items[pos].Orders = append(items[pos].Orders, model.TimetableOrder{
 				ID:           orderID.Int64,
 				CustomerName: customerName.String,
 				Status:       status.String,
+				ResourceID:   resourceID.Int64,
+				ResourceName: resourceName.String,
 				CreatedAt:    createdAt,
 			})
 		}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+var locations sync.Map // IANA name -> *time.Location
+
+// loadLocation is time.LoadLocation with a process-wide cache; it is called per row.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// slotInstants computes starts_at/ends_at for a slot of a branch in zone tz.
+func slotInstants(tz, date, start, end string) (time.Time, time.Time, error) {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return model.SlotInstants(loc, date, start, end)
+}
+
+// slotClock is the naive slot schedule as stored, plus the branch time zone.
+type slotClock struct {
+	date, start, end, tz string
+}
+
+// apply sets the order's starts_at/ends_at; service bookings end when the
+// service does, which may be in a later slot.
+func (c slotClock) apply(o *model.Order) error {
+	var err error
+	o.StartsAt, o.EndsAt, err = slotInstants(c.tz, c.date, c.start, c.end)
+	if err == nil && o.DurationMinutes != nil {
+		o.EndsAt = o.StartsAt.Add(time.Duration(*o.DurationMinutes) * time.Minute)
+	}
+	return err
+}
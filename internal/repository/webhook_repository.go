@@ -0,0 +1,528 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/webhook"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook endpoint not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+// WebhookRepository manages a tenant's endpoints and deliveries, and is the
+// dispatcher's queue (webhook.Store), which works across tenants.
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// NewWebhook describes an endpoint to register.
+type NewWebhook struct {
+	URL        string
+	EventTypes []string // empty = every event
+}
+
+// WebhookUpdate holds the fields to change; nil means "leave as is".
+type WebhookUpdate struct {
+	URL        *string
+	EventTypes *[]string
+	IsActive   *bool
+}
+
+const webhookColumns = `id, tenant_id, url, array_to_string(event_types, ','), is_active,
+  created_by, created_at, updated_at`
+
+func scanWebhook(row interface{ Scan(...any) error }, w *model.WebhookEndpoint) error {
+	var (
+		events    string
+		createdBy sql.NullString
+	)
+	if err := row.Scan(
+		&w.ID,
+		&w.TenantID,
+		&w.URL,
+		&events,
+		&w.IsActive,
+		&createdBy,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	w.EventTypes = splitList(events)
+	w.CreatedBy = nullString(createdBy)
+	return nil
+}
+
+const deliveryColumns = `d.id, d.event_id, d.endpoint_id, e.event_type, d.status, d.attempts,
+  d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at`
+
+func scanDelivery(row interface{ Scan(...any) error }, d *model.WebhookDelivery) error {
+	var (
+		code        sql.NullInt64
+		lastErr     sql.NullString
+		deliveredAt sql.NullTime
+	)
+	if err := row.Scan(
+		&d.ID,
+		&d.EventID,
+		&d.EndpointID,
+		&d.EventType,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&code,
+		&lastErr,
+		&deliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	d.LastStatusCode = nullInt64(code)
+	d.LastError = nullString(lastErr)
+	d.DeliveredAt = timePtr(deliveredAt)
+	return nil
+}
+
+// generateWebhookSecret returns a new signing secret.
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context) ([]model.WebhookEndpoint, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	const q = `
+SELECT ` + webhookColumns + `
+FROM webhook_endpoints
+WHERE tenant_id = $1
+ORDER BY id ASC;
+`
+	rows, err := db.QueryContext(ctx, q, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.WebhookEndpoint, 0, 8)
+	for rows.Next() {
+		var w model.WebhookEndpoint
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *WebhookRepository) Get(ctx context.Context, id int64) (model.WebhookEndpoint, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	defer done()
+
+	return getWebhook(ctx, db, tid, id, false)
+}
+
+func getWebhook(ctx context.Context, q queryer, tenantID, id int64, forUpdate bool) (model.WebhookEndpoint, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook_endpoints WHERE id = $1 AND tenant_id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	var w model.WebhookEndpoint
+	if err := scanWebhook(q.QueryRowContext(ctx, query, id, tenantID), &w); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.WebhookEndpoint{}, ErrWebhookNotFound
+		}
+		return model.WebhookEndpoint{}, err
+	}
+	return w, nil
+}
+
+// Create registers an endpoint and returns it with its signing secret, which
+// is not returned again.
+func (r *WebhookRepository) Create(ctx context.Context, actor model.Actor, n NewWebhook) (model.WebhookEndpoint, string, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const q = `
+INSERT INTO webhook_endpoints (tenant_id, url, secret, event_types, created_by)
+VALUES ($1, $2, $3, string_to_array($4, ','), NULLIF($5, ''))
+RETURNING ` + webhookColumns + `;
+`
+	var out model.WebhookEndpoint
+	if err := scanWebhook(tx.QueryRowContext(ctx, q,
+		tid, n.URL, secret, strings.Join(n.EventTypes, ","), actor.ID,
+	), &out); err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "webhook.create",
+		EntityType: audit.EntityWebhook,
+		EntityID:   strconv.FormatInt(out.ID, 10),
+		After:      out,
+	}); err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WebhookEndpoint{}, "", err
+	}
+	return out, secret, nil
+}
+
+// Update changes an endpoint. Deactivating it pauses its pending deliveries;
+// events raised meanwhile are not queued for it.
+func (r *WebhookRepository) Update(ctx context.Context, actor model.Actor, id int64, u WebhookUpdate) (model.WebhookEndpoint, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	before, err := getWebhook(ctx, tx, tid, id, true)
+	if err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+
+	cur := before
+	if u.URL != nil {
+		cur.URL = *u.URL
+	}
+	if u.EventTypes != nil {
+		cur.EventTypes = *u.EventTypes
+	}
+	if u.IsActive != nil {
+		cur.IsActive = *u.IsActive
+	}
+
+	const q = `
+UPDATE webhook_endpoints
+SET url = $2,
+    event_types = string_to_array($3, ','),
+    is_active = $4,
+    updated_at = now()
+WHERE id = $1
+RETURNING ` + webhookColumns + `;
+`
+	var out model.WebhookEndpoint
+	if err := scanWebhook(tx.QueryRowContext(ctx, q,
+		id, cur.URL, strings.Join(cur.EventTypes, ","), cur.IsActive,
+	), &out); err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "webhook.update",
+		EntityType: audit.EntityWebhook,
+		EntityID:   strconv.FormatInt(id, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WebhookEndpoint{}, err
+	}
+	return out, nil
+}
+
+// Deliveries returns an endpoint's deliveries, newest first, optionally only
+// those in status ("" = any).
+func (r *WebhookRepository) Deliveries(ctx context.Context, endpointID int64, status string, limit int) ([]model.WebhookDelivery, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, done, err := reader(ctx, r.db, tid)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if _, err := getWebhook(ctx, db, tid, endpointID, false); err != nil {
+		return nil, err
+	}
+
+	const q = `
+SELECT ` + deliveryColumns + `
+FROM webhook_deliveries d
+JOIN outbox_events e ON e.id = d.event_id
+WHERE d.endpoint_id = $1
+  AND ($2 = '' OR d.status = $2)
+ORDER BY d.id DESC
+LIMIT $3;
+`
+	rows, err := db.QueryContext(ctx, q, endpointID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]model.WebhookDelivery, 0, limit)
+	for rows.Next() {
+		var d model.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Replay queues a delivery again from scratch, whatever its status; the
+// receiver gets the same event id and can deduplicate.
+func (r *WebhookRepository) Replay(ctx context.Context, actor model.Actor, deliveryID int64) (model.WebhookDelivery, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const lockQ = `
+SELECT ` + deliveryColumns + `
+FROM webhook_deliveries d
+JOIN outbox_events e ON e.id = d.event_id
+JOIN webhook_endpoints w ON w.id = d.endpoint_id
+WHERE d.id = $1 AND w.tenant_id = $2
+FOR UPDATE OF d;
+`
+	var before model.WebhookDelivery
+	if err := scanDelivery(tx.QueryRowContext(ctx, lockQ, deliveryID, tid), &before); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.WebhookDelivery{}, ErrWebhookDeliveryNotFound
+		}
+		return model.WebhookDelivery{}, err
+	}
+
+	const q = `
+UPDATE webhook_deliveries d
+SET status = 'pending', attempts = 0, next_attempt_at = now(),
+    last_status_code = NULL, last_error = NULL, delivered_at = NULL, updated_at = now()
+FROM outbox_events e
+WHERE d.id = $1 AND e.id = d.event_id
+RETURNING ` + deliveryColumns + `;
+`
+	var out model.WebhookDelivery
+	if err := scanDelivery(tx.QueryRowContext(ctx, q, deliveryID), &out); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "webhook.replay",
+		EntityType: audit.EntityWebhook,
+		EntityID:   strconv.FormatInt(out.EndpointID, 10),
+		Before:     before,
+		After:      out,
+	}); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	return out, nil
+}
+
+// ReplayDead queues every dead-lettered delivery of an endpoint again and
+// returns how many there were.
+func (r *WebhookRepository) ReplayDead(ctx context.Context, actor model.Actor, endpointID int64) (int64, error) {
+	tid, err := tenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := beginTx(ctx, r.db, tid)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := getWebhook(ctx, tx, tid, endpointID, true); err != nil {
+		return 0, err
+	}
+
+	const q = `
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = now(),
+    last_status_code = NULL, last_error = NULL, updated_at = now()
+WHERE endpoint_id = $1 AND status = 'dead';
+`
+	res, err := tx.ExecContext(ctx, q, endpointID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := audit.Record(ctx, tx, audit.Entry{
+		Actor:      actor,
+		Action:     "webhook.replay_dead",
+		EntityType: audit.EntityWebhook,
+		EntityID:   strconv.FormatInt(endpointID, 10),
+		After:      map[string]any{"replayed": n},
+	}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Claim implements webhook.Store. Deliveries of inactive endpoints wait until
+// the endpoint is active again.
+func (r *WebhookRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	tx, err := beginTxAs(ctx, r.db, allTenants, &sql.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	const q = `
+UPDATE webhook_deliveries d
+SET attempts = d.attempts + 1,
+    next_attempt_at = now() + $2 * interval '1 second',
+    updated_at = now()
+FROM (
+  SELECT d.id
+  FROM webhook_deliveries d
+  JOIN webhook_endpoints w ON w.id = d.endpoint_id AND w.is_active
+  WHERE d.status = 'pending' AND d.next_attempt_at <= now()
+  ORDER BY d.next_attempt_at, d.id
+  LIMIT $1
+  FOR UPDATE OF d SKIP LOCKED
+) due, outbox_events e, webhook_endpoints w
+WHERE d.id = due.id AND e.id = d.event_id AND w.id = d.endpoint_id
+RETURNING d.id, d.attempts, e.id, e.event_type, e.payload, e.created_at, w.url, w.secret;
+`
+	rows, err := tx.QueryContext(ctx, q, limit, int64(lease/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]webhook.Delivery, 0, limit)
+	for rows.Next() {
+		var d webhook.Delivery
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.Attempt, &d.EventID, &d.EventType, &payload, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delivered implements webhook.Store.
+func (r *WebhookRepository) Delivered(ctx context.Context, id int64, statusCode int) error {
+	const q = `
+UPDATE webhook_deliveries
+SET status = 'delivered', delivered_at = now(), last_status_code = $2, last_error = NULL, updated_at = now()
+WHERE id = $1;
+`
+	return r.exec(ctx, q, id, statusCode)
+}
+
+// Failed implements webhook.Store.
+func (r *WebhookRepository) Failed(ctx context.Context, id int64, statusCode int, msg string, retryAt time.Time) error {
+	const q = `
+UPDATE webhook_deliveries
+SET status = CASE WHEN $4::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+    next_attempt_at = COALESCE($4, next_attempt_at),
+    last_status_code = NULLIF($2, 0),
+    last_error = $3,
+    updated_at = now()
+WHERE id = $1;
+`
+	return r.exec(ctx, q, id, statusCode, msg, nullTime(retryAt))
+}
+
+// exec runs a dispatcher write, which is not tenant-scoped.
+func (r *WebhookRepository) exec(ctx context.Context, q string, args ...any) error {
+	tx, err := beginTxAs(ctx, r.db, allTenants, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,37 +2,165 @@ package router
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/idlistic/go-backend-api-sample/internal/config"
 )
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
+// corsPolicy is the CORS configuration, parsed once at startup.
+type corsPolicy struct {
+	anyOrigin   bool            // "*" in the origin list
+	origins     map[string]bool // exact origins, e.g. "https://app.example.com"
+	wildcards   []originPattern // "https://*.example.com"
+	methods     map[string]bool
+	headers     map[string]bool // lower-cased
+	credentials bool
+
+	// pre-joined response header values
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern matches any subdomain (at any depth) of a host, with a fixed
+// scheme and optional port: "https://*.example.com" matches
+// "https://a.example.com" but not "https://example.com".
+type originPattern struct {
+	scheme string // "https://"
+	suffix string // ".example.com" or ".example.com:8443"
+}
 
-		allowed := map[string]bool{
-			"http://localhost:5173": true,
-			"http://127.0.0.1:5173": true,
+func (p originPattern) match(origin string) bool {
+	host, ok := strings.CutPrefix(origin, p.scheme)
+	if !ok || !strings.HasSuffix(host, p.suffix) {
+		return false
+	}
+	sub := strings.TrimSuffix(host, p.suffix)
+	return sub != "" && !strings.ContainsAny(sub, ":/")
+}
+
+func newCORSPolicy(c config.CORS) *corsPolicy {
+	p := &corsPolicy{
+		origins:       make(map[string]bool, len(c.AllowedOrigins)),
+		methods:       make(map[string]bool, len(c.AllowedMethods)),
+		headers:       make(map[string]bool, len(c.AllowedHeaders)),
+		credentials:   c.AllowCredentials,
+		allowMethods:  strings.Join(c.AllowedMethods, ", "),
+		allowHeaders:  strings.Join(c.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(c.ExposedHeaders, ", "),
+	}
+	if c.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+
+	for _, o := range c.AllowedOrigins {
+		switch {
+		case o == "*":
+			p.anyOrigin = true
+		case strings.Contains(o, "://*."):
+			scheme, host, _ := strings.Cut(o, "://*")
+			p.wildcards = append(p.wildcards, originPattern{scheme: scheme + "://", suffix: host})
+		default:
+			p.origins[strings.TrimSuffix(o, "/")] = true
 		}
+	}
+	for _, m := range c.AllowedMethods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range c.AllowedHeaders {
+		p.headers[strings.ToLower(h)] = true
+	}
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if w.match(origin) {
+			return true
+		}
+	}
+	return false
+}
 
-		if allowed[origin] {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Vary", "Origin")
-			w.Header().Set("Access-Control-Allow-Credentials", "true")
+// allowRequestHeaders reports whether every header of an
+// Access-Control-Request-Headers value is allowed.
+func (p *corsPolicy) allowRequestHeaders(list string) bool {
+	for _, h := range strings.Split(list, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && !p.headers[h] {
+			return false
 		}
+	}
+	return true
+}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "86400") // cache preflight 1 วัน
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	// credentials forbid "*", so the origin is echoed
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
 
-		if r.Method == http.MethodOptions {
-			reqHdr := r.Header.Get("Access-Control-Request-Headers")
-			if reqHdr != "" {
-				w.Header().Set("Access-Control-Allow-Headers", strings.Join([]string{"Content-Type, Authorization", reqHdr}, ", "))
+// withCORS applies p. Preflight requests are answered here, but only for
+// paths routed by routes; other OPTIONS requests fall through to next.
+// Disallowed origins, methods or headers get no CORS headers, which the
+// browser reports as a CORS failure.
+func withCORS(p *corsPolicy, routes *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+
+		if r.Method != http.MethodOptions || origin == "" || reqMethod == "" {
+			if !p.anyOrigin || p.credentials {
+				// the response depends on Origin; keep caches from mixing them up
+				w.Header().Add("Vary", "Origin")
+			}
+			if p.allowOrigin(origin) {
+				p.setOrigin(w.Header(), origin)
+				if p.exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", p.exposeHeaders)
+				}
 			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if _, pattern := routes.Handler(r); pattern == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !p.allowOrigin(origin) || !p.methods[reqMethod] ||
+			!p.allowRequestHeaders(r.Header.Get("Access-Control-Request-Headers")) {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		h := w.Header()
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", p.allowMethods)
+		if p.allowHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
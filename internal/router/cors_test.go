@@ -0,0 +1,159 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/idlistic/go-backend-api-sample/internal/config"
+)
+
+func testCORS(c config.CORS) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return withCORS(newCORSPolicy(c), mux, mux)
+}
+
+var defaultCORS = config.CORS{
+	AllowedOrigins:   []string{"https://app.example.com", "https://*.partner.test"},
+	AllowedMethods:   []string{"GET", "POST", "PATCH"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization"},
+	ExposedHeaders:   []string{"X-Request-ID"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func preflight(path, origin, method, headers string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestCORSPreflight(t *testing.T) {
+	h := testCORS(defaultCORS)
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+		wantOrigin string
+	}{
+		{"exact origin", preflight("/orders", "https://app.example.com", "POST", "content-type, authorization"), http.StatusNoContent, "https://app.example.com"},
+		{"wildcard subdomain", preflight("/orders", "https://kiosk.partner.test", "POST", ""), http.StatusNoContent, "https://kiosk.partner.test"},
+		{"nested subdomain", preflight("/orders", "https://a.b.partner.test", "GET", ""), http.StatusNoContent, "https://a.b.partner.test"},
+		{"wildcard does not match apex", preflight("/orders", "https://partner.test", "POST", ""), http.StatusNoContent, ""},
+		{"wildcard checks scheme", preflight("/orders", "http://kiosk.partner.test", "POST", ""), http.StatusNoContent, ""},
+		{"unknown origin", preflight("/orders", "https://evil.example", "POST", ""), http.StatusNoContent, ""},
+		{"method not allowed", preflight("/orders", "https://app.example.com", "DELETE", ""), http.StatusNoContent, ""},
+		{"header not allowed", preflight("/orders", "https://app.example.com", "POST", "X-Custom"), http.StatusNoContent, ""},
+		{"unknown route", preflight("/nope", "https://app.example.com", "POST", ""), http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, tt.req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			got := rec.Header().Get("Access-Control-Allow-Origin")
+			if got != tt.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" {
+				if v := rec.Header().Get("Access-Control-Allow-Methods"); v != "" {
+					t.Fatalf("Access-Control-Allow-Methods = %q on a rejected preflight", v)
+				}
+				return
+			}
+
+			hdr := rec.Header()
+			for k, want := range map[string]string{
+				"Access-Control-Allow-Methods":     "GET, POST, PATCH",
+				"Access-Control-Allow-Headers":     "Content-Type, Authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			} {
+				if got := hdr.Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSPreflightDoesNotEchoRequestedHeaders(t *testing.T) {
+	rec := httptest.NewRecorder()
+	testCORS(defaultCORS).ServeHTTP(rec, preflight("/orders", "https://app.example.com", "POST", "Content-Type"))
+
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, Authorization" {
+		t.Fatalf("Access-Control-Allow-Headers = %q", got)
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	h := testCORS(defaultCORS)
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantOrigin string
+	}{
+		{"allowed origin", "https://app.example.com", "https://app.example.com"},
+		{"wildcard origin", "https://kiosk.partner.test", "https://kiosk.partner.test"},
+		{"unknown origin", "https://evil.example", ""},
+		{"no origin", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (CORS must not block the request itself)", rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Vary"); got != "Origin" {
+				t.Fatalf("Vary = %q, want Origin", got)
+			}
+			wantExpose := ""
+			if tt.wantOrigin != "" {
+				wantExpose = "X-Request-ID"
+			}
+			if got := rec.Header().Get("Access-Control-Expose-Headers"); got != wantExpose {
+				t.Fatalf("Access-Control-Expose-Headers = %q, want %q", got, wantExpose)
+			}
+		})
+	}
+}
+
+func TestCORSAnyOriginWithoutCredentials(t *testing.T) {
+	c := defaultCORS
+	c.AllowedOrigins = []string{"*"}
+	c.AllowCredentials = false
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("Origin", "https://anywhere.test")
+	rec := httptest.NewRecorder()
+	testCORS(c).ServeHTTP(rec, r)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
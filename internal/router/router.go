@@ -1,27 +1,80 @@
 package router
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/idlistic/go-backend-api-sample/internal/analytics"
+	"github.com/idlistic/go-backend-api-sample/internal/apikey"
+	"github.com/idlistic/go-backend-api-sample/internal/audit"
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/availability"
+	"github.com/idlistic/go-backend-api-sample/internal/config"
 	"github.com/idlistic/go-backend-api-sample/internal/db"
 	"github.com/idlistic/go-backend-api-sample/internal/handler"
+	"github.com/idlistic/go-backend-api-sample/internal/ratelimit"
+	"github.com/idlistic/go-backend-api-sample/internal/reliability"
 	"github.com/idlistic/go-backend-api-sample/internal/repository"
+	"github.com/idlistic/go-backend-api-sample/internal/requestid"
+	"github.com/idlistic/go-backend-api-sample/internal/tenant"
+	"github.com/idlistic/go-backend-api-sample/internal/webhook"
 )
 
-func New() (http.Handler, func() error, error) {
+func New(cfg config.Config) (http.Handler, func() error, error) {
+	verifier, err := newVerifier(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	database, err := db.Open()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	branchRepo := repository.NewBranchRepository(database)
+	orderRepo := repository.NewOrderRepository(database)
+	branchHandler := handler.NewBranchHandler(branchRepo, orderRepo)
+
 	timeslotRepo := repository.NewTimeslotRepository(database)
-	timeslotHandler := handler.NewTimeslotHandler(timeslotRepo)
+	availabilityHub := availability.NewHub()
+	timeslotHandler := handler.NewTimeslotHandler(timeslotRepo, branchRepo, availabilityHub)
 
-	branchRepo := repository.NewBranchRepository(database)
-	branchHandler := handler.NewBranchHandler(branchRepo)
+	orderHandler := handler.NewOrderHandler(orderRepo, branchRepo)
 
-	orderRepo := repository.NewOrderRepository(database)
-	orderHandler := handler.NewOrderHandler(orderRepo)
+	resourceRepo := repository.NewResourceRepository(database)
+	resourceHandler := handler.NewResourceHandler(resourceRepo)
+
+	serviceRepo := repository.NewServiceRepository(database)
+	serviceHandler := handler.NewServiceHandler(serviceRepo, branchRepo)
+
+	timetableRepo := repository.NewTimetableRepository(database)
+	cors := newCORSPolicy(cfg.CORS)
+	timetableHandler := handler.NewTimetableHandler(timetableRepo, branchRepo, availabilityHub, cors.allowOrigin)
+
+	exportHandler := handler.NewExportHandler(orderRepo, timetableRepo, branchRepo)
+
+	analyticsRepo := repository.NewAnalyticsRepository(database)
+	reportHandler := handler.NewReportHandler(analyticsRepo, branchRepo)
+
+	apiKeyRepo := repository.NewAPIKeyRepository(database)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyRepo)
+
+	auditRepo := repository.NewAuditRepository(database)
+	auditHandler := handler.NewAuditHandler(auditRepo)
+
+	webhookRepo := repository.NewWebhookRepository(database)
+	webhookHandler := handler.NewWebhookHandler(webhookRepo, cfg.Development)
+
+	tenantRepo := repository.NewTenantRepository(database)
+	if cfg.TenantRLS {
+		repository.EnableRowLevelSecurity()
+	}
+	tenants := tenant.Middleware(tenantRepo, tenant.Config{
+		Fallback: cfg.TenantFallback,
+		Exempt:   []string{"/health"},
+	})
 
 	mux := http.NewServeMux()
 
@@ -30,13 +83,95 @@ func New() (http.Handler, func() error, error) {
 		w.Write([]byte("OK"))
 	})
 
+	// availability and branch details are public; everything else needs a bearer token
 	// GET /timeslots?branch_id=&date=
 	mux.HandleFunc("/timeslots", timeslotHandler.List)
-	mux.HandleFunc("/branches", branchHandler.List)
-	mux.HandleFunc("/orders", orderHandler.Handle)
+	mux.HandleFunc("/timeslots/stream", timeslotHandler.Stream) // GET /timeslots/stream?branch_id=&date= (SSE)
+	mux.Handle("/timeslots/generate", auth.Require(http.HandlerFunc(timeslotHandler.Generate)))
+	mux.Handle("/timeslots/import", auth.Require(http.HandlerFunc(timeslotHandler.Import))) // POST /timeslots/import?dry_run=&mode= (CSV)
+	mux.Handle("/timeslots/", auth.Require(http.HandlerFunc(timeslotHandler.HandleItem)))   // PATCH /timeslots/{id}, PUT /timeslots/{id}/resources
+	mux.Handle("/branches", auth.Require(http.HandlerFunc(branchHandler.Handle), http.MethodGet))
+	mux.Handle("/branches/", auth.Require(http.HandlerFunc(branchHandler.HandleItem), http.MethodGet)) // /branches/{id}, /archive, /calendar.ics (feed token), /calendar-token
+	mux.Handle("/orders", auth.Require(http.HandlerFunc(orderHandler.Handle)))
+	mux.Handle("/reliability", auth.Require(http.HandlerFunc(orderHandler.Reliability))) // GET ?branch_id=&customer_id=
+
+	mux.Handle("/orders/", auth.Require(http.HandlerFunc(orderHandler.HandleItem)))           // /orders/{id}/cancel, /reschedule, /check-in, /history, /orders/{id}.ics
+	mux.Handle("/timetable", auth.Require(http.HandlerFunc(timetableHandler.Get)))            // GET /timetable?branch_id=&date=
+	mux.Handle("/timetable/ws", auth.Require(http.HandlerFunc(timetableHandler.Socket)))      // WebSocket, see handler.TimetableSubprotocol
+	mux.Handle("/exports/orders", auth.Require(http.HandlerFunc(exportHandler.Orders)))       // GET ?branch_id=&from=&to=&format=csv|xlsx&columns=
+	mux.Handle("/exports/timetable", auth.Require(http.HandlerFunc(exportHandler.Timetable))) // same parameters
+
+	mux.Handle("/reports/utilization", auth.Require(http.HandlerFunc(reportHandler.Utilization))) // GET ?branch_id=&from=&to=&group=day|week
+	mux.Handle("/reports/bookings", auth.Require(http.HandlerFunc(reportHandler.Bookings)))       // same parameters
+	mux.Handle("/reports/heatmap", auth.Require(http.HandlerFunc(reportHandler.Heatmap)))         // GET ?branch_id=&from=&to=
+	mux.Handle("/reports/lead-times", auth.Require(http.HandlerFunc(reportHandler.LeadTimes)))    // same parameters
+
+	mux.Handle("/resources", auth.Require(http.HandlerFunc(resourceHandler.Handle), http.MethodGet))      // GET ?branch_id=, POST
+	mux.Handle("/resources/", auth.Require(http.HandlerFunc(resourceHandler.HandleItem), http.MethodGet)) // GET/PATCH /resources/{id}
+
+	mux.Handle("/services", auth.Require(http.HandlerFunc(serviceHandler.Handle), http.MethodGet))      // GET ?branch_id=, POST
+	mux.Handle("/services/", auth.Require(http.HandlerFunc(serviceHandler.HandleItem), http.MethodGet)) // GET/PATCH /services/{id}, GET /services/{id}/starts?date=
 
-	mux.HandleFunc("/orders/", orderHandler.Cancel) // for /orders/{id}/cancel
+	mux.Handle("/admin/audit", auth.Require(http.HandlerFunc(auditHandler.List)))
+	mux.Handle("/admin/api-keys", auth.Require(http.HandlerFunc(apiKeyHandler.Handle)))
+	mux.Handle("/admin/api-keys/", auth.Require(http.HandlerFunc(apiKeyHandler.HandleItem))) // /admin/api-keys/{id}, /rotate, /revoke
+	mux.Handle("/admin/webhooks", auth.Require(http.HandlerFunc(webhookHandler.Handle)))
+	mux.Handle("/admin/webhooks/", auth.Require(http.HandlerFunc(webhookHandler.HandleItem))) // /admin/webhooks/{id}, /deliveries, /replay
 
-	cleanup := func() error { return database.Close() }
-	return withCORS(mux), cleanup, nil
+	// background jobs stop when the server shuts down
+	jobs, stopJobs := context.WithCancel(context.Background())
+	go audit.RunRetention(jobs, auditRepo, cfg.AuditRetention, time.Hour)
+	go analytics.RunRefresh(jobs, analyticsRepo, cfg.AnalyticsRefresh)
+	go availability.Listen(jobs, database, availabilityHub)
+	go reliability.RunRelease(jobs, orderRepo, time.Minute)
+	if cfg.WebhookDispatch {
+		go webhook.NewDispatcher(webhookRepo, webhook.Config{
+			MaxAttempts:         cfg.WebhookMaxAttempts,
+			Timeout:             cfg.WebhookTimeout,
+			AllowPrivateTargets: cfg.Development,
+		}).Run(jobs)
+	}
+
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		limitStore = ratelimit.NewPostgresStore(database)
+	}
+	go ratelimit.RunPurge(jobs, limitStore, time.Hour, 10*time.Minute)
+	limiter := ratelimit.Middleware(limitStore, ratelimit.Config{
+		Read:       ratelimit.PerMinute(cfg.RateLimitReadPerMin, cfg.RateLimitReadBurst),
+		Write:      ratelimit.PerMinute(cfg.RateLimitWritePerMin, cfg.RateLimitWriteBurst),
+		TrustProxy: cfg.RateLimitTrustProxy,
+		Exempt:     []string{"/health"},
+	})
+	guard := ratelimit.Guard(limitStore, ratelimit.PerMinute(cfg.RateLimitAuthPerMin, cfg.RateLimitAuthBurst), cfg.RateLimitTrustProxy)
+
+	cleanup := func() error {
+		stopJobs()
+		return database.Close()
+	}
+	return requestid.Middleware(withCORS(cors, mux, guard(auth.Middleware(verifier, apikey.NewAuthenticator(apiKeyRepo))(tenants(limiter(mux)))))), cleanup, nil
+}
+
+// newVerifier builds the JWT verifier from config, or returns nil (reject all
+// tokens) when no keys are configured.
+func newVerifier(cfg config.Config) (*auth.Verifier, error) {
+	vc := auth.VerifierConfig{
+		HMACSecret: []byte(cfg.JWTSecret),
+		Issuer:     cfg.JWTIssuer,
+		Audience:   cfg.JWTAudience,
+		Leeway:     30 * time.Second,
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := auth.LoadJWKSFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		vc.RSAKeys = keys
+	}
+
+	if len(vc.HMACSecret) == 0 && len(vc.RSAKeys) == 0 {
+		log.Println("⚠️  no JWT keys configured (JWT_HS256_SECRET / JWT_JWKS_FILE); protected endpoints will reject all requests")
+		return nil, nil
+	}
+	return auth.NewVerifier(vc)
 }
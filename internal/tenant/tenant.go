@@ -0,0 +1,123 @@
+// Package tenant resolves which business a request belongs to and carries it
+// in the request context. Repositories scope every query to it.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+	"github.com/idlistic/go-backend-api-sample/internal/problem"
+)
+
+// ErrNotFound is returned by a Resolver for unknown or inactive tenants.
+var ErrNotFound = errors.New("tenant not found")
+
+var (
+	problemTenantNotFound = problem.New(http.StatusNotFound, problem.CodeTenantNotFound, "tenant not found")
+	problemTenantMismatch = problem.New(http.StatusForbidden, problem.CodeTenantMismatch, "credentials belong to another tenant")
+	problemInternal       = problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+)
+
+// Resolver looks tenants up; implemented by the tenant repository.
+type Resolver interface {
+	ByHost(ctx context.Context, host string) (model.Tenant, error)
+	BySlug(ctx context.Context, slug string) (model.Tenant, error)
+	ByID(ctx context.Context, id int64) (model.Tenant, error)
+	// Count returns the number of active tenants.
+	Count(ctx context.Context) (int, error)
+}
+
+type ctxKey struct{}
+
+// WithTenant stores t in ctx.
+func WithTenant(ctx context.Context, t model.Tenant) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns the tenant of the request, if resolved.
+func FromContext(ctx context.Context) (model.Tenant, bool) {
+	t, ok := ctx.Value(ctxKey{}).(model.Tenant)
+	return t, ok
+}
+
+// Config controls resolution.
+type Config struct {
+	// Fallback is the slug used when the host matches no tenant; "" rejects
+	// unknown hosts. Single-tenant deployments keep the default tenant here.
+	Fallback string
+	// Exempt paths are served without a tenant (e.g. health checks).
+	Exempt []string
+}
+
+// Middleware resolves the tenant and stores it in the request context. It
+// must run after auth.Middleware: an API key always belongs to exactly one
+// tenant, which wins over the host; a JWT must name the host's tenant in its
+// "tenant" claim, as its roles would otherwise hold on every tenant. Only a
+// deployment with a single tenant accepts tokens without the claim.
+func Middleware(res Resolver, cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range cfg.Exempt {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			ctx := r.Context()
+			p, authenticated := auth.FromContext(ctx)
+
+			var (
+				t   model.Tenant
+				err error
+			)
+			if authenticated && p.IsAPIKey() {
+				t, err = res.ByID(ctx, p.TenantID)
+			} else {
+				t, err = res.ByHost(ctx, hostname(r.Host))
+				if errors.Is(err, ErrNotFound) && cfg.Fallback != "" {
+					t, err = res.BySlug(ctx, cfg.Fallback)
+				}
+			}
+			switch {
+			case errors.Is(err, ErrNotFound):
+				problem.Write(w, r, problemTenantNotFound)
+				return
+			case err != nil:
+				problem.Write(w, r, problemInternal)
+				return
+			}
+
+			if authenticated && !p.IsAPIKey() && p.Tenant != t.Slug {
+				ok := false
+				if p.Tenant == "" {
+					n, err := res.Count(ctx)
+					if err != nil {
+						problem.Write(w, r, problemInternal)
+						return
+					}
+					ok = n == 1
+				}
+				if !ok {
+					problem.Write(w, r, problemTenantMismatch)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithTenant(ctx, t)))
+		})
+	}
+}
+
+// hostname strips the port and lower-cases the Host header.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
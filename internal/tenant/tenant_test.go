@@ -0,0 +1,96 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/idlistic/go-backend-api-sample/internal/auth"
+	"github.com/idlistic/go-backend-api-sample/internal/model"
+)
+
+type fakeResolver []model.Tenant
+
+func (f fakeResolver) find(match func(model.Tenant) bool) (model.Tenant, error) {
+	for _, t := range f {
+		if match(t) {
+			return t, nil
+		}
+	}
+	return model.Tenant{}, ErrNotFound
+}
+
+func (f fakeResolver) ByHost(_ context.Context, host string) (model.Tenant, error) {
+	return f.find(func(t model.Tenant) bool {
+		for _, h := range t.Hosts {
+			if h == host {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (f fakeResolver) BySlug(_ context.Context, slug string) (model.Tenant, error) {
+	return f.find(func(t model.Tenant) bool { return t.Slug == slug })
+}
+
+func (f fakeResolver) ByID(_ context.Context, id int64) (model.Tenant, error) {
+	return f.find(func(t model.Tenant) bool { return t.ID == id })
+}
+
+func (f fakeResolver) Count(context.Context) (int, error) {
+	return len(f), nil
+}
+
+var (
+	acme   = model.Tenant{ID: 1, Slug: "acme", Hosts: []string{"acme.test"}}
+	globex = model.Tenant{ID: 2, Slug: "globex", Hosts: []string{"globex.test"}}
+)
+
+func serve(res Resolver, host string, p *auth.Principal) (int, string) {
+	var got string
+	h := Middleware(res, Config{Fallback: "acme"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, _ := FromContext(r.Context())
+		got = t.Slug
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "http://"+host+"/orders", nil)
+	if p != nil {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), *p))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec.Code, got
+}
+
+func TestMiddlewareTenantClaim(t *testing.T) {
+	both := fakeResolver{acme, globex}
+
+	tests := []struct {
+		name     string
+		res      Resolver
+		host     string
+		p        *auth.Principal
+		wantCode int
+		wantSlug string
+	}{
+		{"anonymous", both, "globex.test", nil, http.StatusOK, "globex"},
+		{"matching claim", both, "globex.test", &auth.Principal{Subject: "u1", Tenant: "globex"}, http.StatusOK, "globex"},
+		{"cross-tenant token", both, "globex.test", &auth.Principal{Subject: "u1", Tenant: "acme"}, http.StatusForbidden, ""},
+		{"cross-tenant token on fallback", both, "unknown.test", &auth.Principal{Subject: "u1", Tenant: "globex"}, http.StatusForbidden, ""},
+		{"missing claim", both, "globex.test", &auth.Principal{Subject: "u1"}, http.StatusForbidden, ""},
+		{"missing claim on fallback", both, "unknown.test", &auth.Principal{Subject: "u1"}, http.StatusForbidden, ""},
+		{"missing claim, single tenant", fakeResolver{acme}, "unknown.test", &auth.Principal{Subject: "u1"}, http.StatusOK, "acme"},
+		{"api key wins over host", both, "acme.test", &auth.Principal{Subject: "key:7", APIKeyID: 7, TenantID: 2}, http.StatusOK, "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, slug := serve(tt.res, tt.host, tt.p)
+			if code != tt.wantCode || slug != tt.wantSlug {
+				t.Errorf("got %d %q, want %d %q", code, slug, tt.wantCode, tt.wantSlug)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delivery is one attempt to send an event to an endpoint.
+type Delivery struct {
+	ID        int64
+	Attempt   int // 1 for the first try
+	EventID   int64
+	EventType string
+	Payload   json.RawMessage
+	CreatedAt time.Time // when the event happened
+	URL       string
+	Secret    string
+}
+
+// Store is the delivery queue, implemented by the webhook repository.
+type Store interface {
+	// Claim leases up to limit due deliveries for lease and counts an attempt
+	// for each; a delivery whose dispatcher dies is retried once the lease ends.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error)
+	// Delivered records a successful attempt.
+	Delivered(ctx context.Context, id int64, statusCode int) error
+	// Failed records a failed attempt, to be retried at retryAt; a zero
+	// retryAt dead-letters the delivery.
+	Failed(ctx context.Context, id int64, statusCode int, msg string, retryAt time.Time) error
+}
+
+// Config tunes a Dispatcher; zero values take the defaults.
+type Config struct {
+	MaxAttempts int           // before dead-lettering; default 10
+	Timeout     time.Duration // per request; default 10s
+	Interval    time.Duration // between polls when idle; default 2s
+	BatchSize   int           // deliveries claimed per poll; default 20
+
+	// AllowPrivateTargets lets deliveries reach loopback, private and
+	// link-local addresses; for development only.
+	AllowPrivateTargets bool
+}
+
+// Dispatcher sends due deliveries. Several replicas may run one each: claims
+// never overlap.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+}
+
+func NewDispatcher(store Store, cfg Config) *Dispatcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 2 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = dialControl
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would dial the endpoint out of our sight
+	transport.DialContext = dialer.DialContext
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			// a redirect is a misconfigured endpoint, not somewhere to send signed payloads
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		cfg: cfg,
+	}
+}
+
+// Run dispatches until ctx is cancelled, polling every Interval while idle.
+func (d *Dispatcher) Run(ctx context.Context) {
+	t := time.NewTicker(d.cfg.Interval)
+	defer t.Stop()
+
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("webhook dispatch: %v", err)
+		}
+		if n == d.cfg.BatchSize {
+			continue // more may be due
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// DispatchOnce claims one batch, sends it and returns its size.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	batch, err := d.store.Claim(ctx, d.cfg.BatchSize, d.cfg.Timeout+30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, dl := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.deliver(ctx, dl); err != nil && ctx.Err() == nil {
+				log.Printf("webhook delivery %d: %v", dl.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(batch), nil
+}
+
+// envelope is the JSON body of every delivery.
+type envelope struct {
+	ID         int64           `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// deliver sends dl and records the outcome; the error is only about recording.
+func (d *Dispatcher) deliver(ctx context.Context, dl Delivery) error {
+	status, sendErr := d.send(ctx, dl)
+	if sendErr == nil {
+		return d.store.Delivered(ctx, dl.ID, status)
+	}
+
+	var retryAt time.Time
+	if dl.Attempt < d.cfg.MaxAttempts {
+		retryAt = time.Now().Add(Backoff(dl.Attempt))
+	} else {
+		log.Printf("webhook delivery %d dead after %d attempts: %v", dl.ID, dl.Attempt, sendErr)
+	}
+	return d.store.Failed(ctx, dl.ID, status, truncate(sendErr.Error(), 500), retryAt)
+}
+
+// send posts dl and returns the response status; any non-2xx is an error.
+func (d *Dispatcher) send(ctx context.Context, dl Delivery) (int, error) {
+	body, err := json.Marshal(envelope{
+		ID:         dl.EventID,
+		Type:       dl.EventType,
+		OccurredAt: dl.CreatedAt,
+		Data:       dl.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-backend-api-webhooks/1")
+	req.Header.Set(HeaderID, strconv.FormatInt(dl.EventID, 10))
+	req.Header.Set(HeaderEvent, dl.EventType)
+	req.Header.Set(HeaderSignature, Sign(dl.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
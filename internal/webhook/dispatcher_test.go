@@ -0,0 +1,242 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a Store holding deliveries in memory.
+type memStore struct {
+	mu       sync.Mutex
+	queue    []Delivery
+	outcomes map[int64]outcome
+}
+
+type outcome struct {
+	delivered bool
+	status    int
+	msg       string
+	retryAt   time.Time
+}
+
+func (s *memStore) Claim(_ context.Context, limit int, _ time.Duration) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(limit, len(s.queue))
+	batch := s.queue[:n]
+	s.queue = s.queue[n:]
+	return batch, nil
+}
+
+func (s *memStore) Delivered(_ context.Context, id int64, status int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[id] = outcome{delivered: true, status: status}
+	return nil
+}
+
+func (s *memStore) Failed(_ context.Context, id int64, status int, msg string, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outcomes[id] = outcome{status: status, msg: msg, retryAt: retryAt}
+	return nil
+}
+
+func newStore(ds ...Delivery) *memStore {
+	return &memStore{queue: ds, outcomes: make(map[int64]outcome)}
+}
+
+const testSecret = "whsec_test"
+
+func TestDispatcherDeliversSignedEvent(t *testing.T) {
+	var (
+		gotHeader http.Header
+		gotBody   []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		if err := Verify(testSecret, r.Header.Get(HeaderSignature), gotBody, time.Now(), 5*time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	occurred := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	store := newStore(Delivery{
+		ID: 1, Attempt: 1, EventID: 42, EventType: EventOrderCreated,
+		Payload: json.RawMessage(`{"id":7}`), CreatedAt: occurred,
+		URL: srv.URL, Secret: testSecret,
+	})
+	n, err := NewDispatcher(store, Config{AllowPrivateTargets: true}).DispatchOnce(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("DispatchOnce = %d, %v", n, err)
+	}
+
+	if o := store.outcomes[1]; !o.delivered || o.status != http.StatusNoContent {
+		t.Fatalf("outcome = %+v, want delivered with 204", o)
+	}
+	if got := gotHeader.Get(HeaderID); got != "42" {
+		t.Errorf("%s = %q, want 42", HeaderID, got)
+	}
+	if got := gotHeader.Get(HeaderEvent); got != EventOrderCreated {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+
+	var env struct {
+		ID         int64           `json:"id"`
+		Type       string          `json:"type"`
+		OccurredAt time.Time       `json:"occurred_at"`
+		Data       json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(gotBody, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.ID != 42 || env.Type != EventOrderCreated || !env.OccurredAt.Equal(occurred) || string(env.Data) != `{"id":7}` {
+		t.Fatalf("body = %s", gotBody)
+	}
+}
+
+func TestDispatcherRetriesThenDeadLetters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := newStore(
+		Delivery{ID: 1, Attempt: 1, EventID: 1, URL: srv.URL, Secret: testSecret},
+		Delivery{ID: 2, Attempt: 3, EventID: 2, URL: srv.URL, Secret: testSecret},
+	)
+	before := time.Now()
+	if _, err := NewDispatcher(store, Config{MaxAttempts: 3, AllowPrivateTargets: true}).DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	retry := store.outcomes[1]
+	if retry.delivered || retry.status != http.StatusInternalServerError {
+		t.Fatalf("first attempt outcome = %+v", retry)
+	}
+	if wait := retry.retryAt.Sub(before); wait < Backoff(1) || wait > Backoff(1)+time.Minute {
+		t.Fatalf("retry in %v, want about %v", wait, Backoff(1))
+	}
+
+	dead := store.outcomes[2]
+	if dead.delivered || !dead.retryAt.IsZero() {
+		t.Fatalf("last attempt outcome = %+v, want dead", dead)
+	}
+	if dead.msg == "" {
+		t.Fatal("dead delivery has no error message")
+	}
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("redirect was followed")
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer srv.Close()
+
+	store := newStore(Delivery{ID: 1, Attempt: 1, EventID: 1, URL: srv.URL, Secret: testSecret})
+	if _, err := NewDispatcher(store, Config{AllowPrivateTargets: true}).DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if o := store.outcomes[1]; o.delivered || o.status != http.StatusTemporaryRedirect {
+		t.Fatalf("outcome = %+v, want failed with 307", o)
+	}
+}
+
+func TestDispatcherRefusesPrivateTargets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("private target was reached")
+	}))
+	defer srv.Close()
+
+	store := newStore(Delivery{ID: 1, Attempt: 1, EventID: 1, URL: srv.URL, Secret: testSecret})
+	if _, err := NewDispatcher(store, Config{}).DispatchOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if o := store.outcomes[1]; o.delivered || o.status != 0 || !strings.Contains(o.msg, ErrForbiddenTarget.Error()) {
+		t.Fatalf("outcome = %+v, want refused", o)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host string
+		ok   bool
+	}{
+		{"203.0.113.10", true},
+		{"2001:db8::1", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"localhost", false},
+	}
+	for _, tt := range tests {
+		err := CheckHost(context.Background(), tt.host)
+		if tt.ok && err != nil || !tt.ok && !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("CheckHost(%q) = %v, want ok %v", tt.host, err, tt.ok)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":1}`)
+	sig := Sign(testSecret, now, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		at     time.Time
+		ok     bool
+	}{
+		{"valid", testSecret, sig, body, now, true},
+		{"within tolerance", testSecret, sig, body, now.Add(4 * time.Minute), true},
+		{"too old", testSecret, sig, body, now.Add(6 * time.Minute), false},
+		{"tampered body", testSecret, sig, []byte(`{"id":2}`), now, false},
+		{"wrong secret", "whsec_other", sig, body, now, false},
+		{"garbage", testSecret, "nonsense", body, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.at, 5*time.Minute)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Verify = %v, want ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		20: 6 * time.Hour,
+	} {
+		if got := Backoff(n); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrForbiddenTarget is returned for endpoints on loopback, private or
+// link-local addresses: deliveries must not reach into the API's own network,
+// e.g. the cloud metadata service at 169.254.169.254.
+var ErrForbiddenTarget = errors.New("webhook target address is not public")
+
+// forbidden reports whether addr is an address deliveries may not go to.
+func forbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast()
+}
+
+// CheckHost resolves host, a name or an IP literal, and fails with
+// ErrForbiddenTarget when any of its addresses is not public. The dispatcher
+// checks the address it dials again, as DNS may answer differently later.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if forbidden(addr) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if forbidden(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// dialControl is a net.Dialer Control function refusing forbidden addresses,
+// so that a name checked at registration cannot be pointed at one later.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if forbidden(ap.Addr()) {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'Asia/Bangkok',  -- IANA name, validated by the API
+  ADD COLUMN IF NOT EXISTS address TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS phone TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- one opening interval per weekday; weekday follows Go's time.Weekday (0 = Sunday)
+CREATE TABLE IF NOT EXISTS branch_operating_hours (
+  branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+  weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+  open_time TIME NOT NULL,
+  close_time TIME NOT NULL,
+
+  PRIMARY KEY (branch_id, weekday),
+  CHECK (close_time > open_time)
+);
+
+CREATE INDEX IF NOT EXISTS ix_branches_active
+  ON branches (is_active);
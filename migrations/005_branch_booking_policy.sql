@@ -0,0 +1,4 @@
+-- booking window, evaluated against the slot's branch-local start time
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS min_lead_minutes INT NOT NULL DEFAULT 0 CHECK (min_lead_minutes >= 0),
+  ADD COLUMN IF NOT EXISTS max_advance_days INT NOT NULL DEFAULT 60 CHECK (max_advance_days > 0);
@@ -0,0 +1,17 @@
+-- how long before a slot starts each actor type may still cancel (0 = until the start)
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS customer_cancel_deadline_minutes INT NOT NULL DEFAULT 120
+    CHECK (customer_cancel_deadline_minutes >= 0),
+  ADD COLUMN IF NOT EXISTS staff_cancel_deadline_minutes INT NOT NULL DEFAULT 0
+    CHECK (staff_cancel_deadline_minutes >= 0);
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS cancel_reason TEXT
+    CHECK (cancel_reason IN (
+      'customer_request', 'schedule_conflict', 'illness',
+      'branch_closed', 'staff_unavailable', 'duplicate_booking', 'other'
+    )),
+  ADD COLUMN IF NOT EXISTS cancel_note TEXT,
+  ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS cancelled_by_type TEXT CHECK (cancelled_by_type IN ('customer', 'staff', 'system')),
+  ADD COLUMN IF NOT EXISTS cancelled_by_id TEXT;
@@ -0,0 +1,42 @@
+-- append-only history of every order state change, written in the same
+-- transaction as the change itself
+CREATE TABLE IF NOT EXISTS order_events (
+  id BIGSERIAL PRIMARY KEY,
+  order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+
+  event_type TEXT NOT NULL CHECK (event_type IN ('created', 'cancelled', 'rescheduled')),
+
+  actor_type TEXT NOT NULL CHECK (actor_type IN ('customer', 'staff', 'system')),
+  actor_id TEXT,
+
+  old_status order_status,
+  new_status order_status NOT NULL,
+  old_timeslot_id BIGINT REFERENCES timeslots(id) ON DELETE RESTRICT,
+  new_timeslot_id BIGINT REFERENCES timeslots(id) ON DELETE RESTRICT,
+
+  reason TEXT,
+  note TEXT,
+  request_id TEXT,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_order_events_order_id
+  ON order_events (order_id, id);
+
+CREATE OR REPLACE FUNCTION order_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'order_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_order_events_append_only ON order_events;
+CREATE TRIGGER trg_order_events_append_only
+  BEFORE UPDATE OR DELETE ON order_events
+  FOR EACH ROW EXECUTE FUNCTION order_events_append_only();
+
+-- backfill a creation event for orders that predate the history table
+INSERT INTO order_events (order_id, event_type, actor_type, new_status, new_timeslot_id, created_at)
+SELECT o.id, 'created', 'system', 'created', o.timeslot_id, o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = o.id);
@@ -0,0 +1,28 @@
+-- generic trail of administrative and booking changes; rows are written in the
+-- same transaction as the change and only removed by the retention job
+CREATE TABLE IF NOT EXISTS audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  occurred_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+  actor_type TEXT NOT NULL,
+  actor_id TEXT,
+
+  action TEXT NOT NULL,        -- e.g. branch.update, timeslot.update, order.cancel
+  entity_type TEXT NOT NULL,   -- branch | timeslot | order
+  entity_id TEXT NOT NULL,
+
+  before JSONB,
+  after JSONB,
+  diff JSONB NOT NULL DEFAULT '{}'::jsonb,  -- {"field": {"from": .., "to": ..}}
+
+  request_id TEXT
+);
+
+CREATE INDEX IF NOT EXISTS ix_audit_log_entity
+  ON audit_log (entity_type, entity_id, occurred_at DESC);
+
+CREATE INDEX IF NOT EXISTS ix_audit_log_actor
+  ON audit_log (actor_id, occurred_at DESC);
+
+CREATE INDEX IF NOT EXISTS ix_audit_log_occurred_at
+  ON audit_log (occurred_at);
@@ -0,0 +1,6 @@
+-- subject ("sub" claim) of the customer who booked; NULL for legacy/staff-made orders
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS customer_id TEXT;
+
+CREATE INDEX IF NOT EXISTS ix_orders_customer_id
+  ON orders (customer_id, created_at DESC);
@@ -0,0 +1,12 @@
+-- front-desk check-in: a checked-in order keeps its seat but can no longer be
+-- cancelled or rescheduled
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'checked_in';
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS checked_in_at TIMESTAMPTZ;
+
+ALTER TABLE order_events
+  DROP CONSTRAINT IF EXISTS order_events_event_type_check;
+ALTER TABLE order_events
+  ADD CONSTRAINT order_events_event_type_check
+  CHECK (event_type IN ('created', 'cancelled', 'rescheduled', 'checked_in'));
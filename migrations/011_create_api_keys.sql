@@ -0,0 +1,35 @@
+-- machine credentials for partner integrations; only a SHA-256 hash of the key
+-- is stored, the plaintext is shown once at issue/rotation time
+CREATE TABLE IF NOT EXISTS api_keys (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+
+  prefix TEXT NOT NULL UNIQUE,     -- public lookup part of the key
+  key_hash BYTEA NOT NULL,         -- sha256 of the full key
+
+  -- stable identity across rotations; recorded as customer_id on orders
+  subject TEXT NOT NULL,
+
+  scopes TEXT[] NOT NULL DEFAULT '{}',
+  branch_ids BIGINT[] NOT NULL DEFAULT '{}',  -- empty = every branch
+  daily_quota INT CHECK (daily_quota IS NULL OR daily_quota > 0),
+
+  rotated_from BIGINT REFERENCES api_keys(id) ON DELETE RESTRICT,
+
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS ix_api_keys_subject
+  ON api_keys (subject);
+
+-- one counter row per key and UTC day
+CREATE TABLE IF NOT EXISTS api_key_usage (
+  api_key_id BIGINT NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+  day DATE NOT NULL,
+  requests BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (api_key_id, day)
+);
@@ -0,0 +1,11 @@
+-- token buckets shared by all API replicas when RATE_LIMIT_STORE=postgres;
+-- losing them on crash only resets limits, so the table is unlogged
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+  key TEXT PRIMARY KEY,                 -- <read|write>:<key|user|ip>:<id>
+  tokens DOUBLE PRECISION NOT NULL,
+  allowed BOOLEAN NOT NULL DEFAULT true, -- outcome of the last take
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ix_rate_limit_buckets_updated_at
+  ON rate_limit_buckets (updated_at);
@@ -0,0 +1,97 @@
+-- tenants own branches; timeslots, orders and their history belong to a tenant
+-- through their branch
+CREATE TABLE IF NOT EXISTS tenants (
+  id BIGSERIAL PRIMARY KEY,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  hosts TEXT[] NOT NULL DEFAULT '{}',   -- lower-case request hosts, e.g. {booking.example.com}
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_tenants_hosts
+  ON tenants USING GIN (hosts);
+
+-- everything that existed before multi-tenancy belongs to the default tenant
+INSERT INTO tenants (slug, name, hosts)
+VALUES ('default', 'Default', '{localhost,127.0.0.1}')
+ON CONFLICT (slug) DO NOTHING;
+
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS tenant_id BIGINT REFERENCES tenants(id) ON DELETE RESTRICT;
+UPDATE branches SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
+WHERE tenant_id IS NULL;
+ALTER TABLE branches
+  ALTER COLUMN tenant_id SET NOT NULL;
+
+-- branch names are unique per tenant; the index keeps its name so re-running
+-- 001 does not recreate the global one
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_indexes
+    WHERE indexname = 'ux_branches_name' AND indexdef LIKE '%(tenant_id, name)%'
+  ) THEN
+    DROP INDEX IF EXISTS ux_branches_name;
+    CREATE UNIQUE INDEX ux_branches_name ON branches (tenant_id, name);
+  END IF;
+END $$;
+
+ALTER TABLE api_keys
+  ADD COLUMN IF NOT EXISTS tenant_id BIGINT REFERENCES tenants(id) ON DELETE RESTRICT;
+UPDATE api_keys SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
+WHERE tenant_id IS NULL;
+ALTER TABLE api_keys
+  ALTER COLUMN tenant_id SET NOT NULL;
+
+-- NULL for system-wide entries, so existing entries are only backfilled once
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM information_schema.columns
+    WHERE table_name = 'audit_log' AND column_name = 'tenant_id'
+  ) THEN
+    ALTER TABLE audit_log
+      ADD COLUMN tenant_id BIGINT REFERENCES tenants(id) ON DELETE RESTRICT;
+    UPDATE audit_log SET tenant_id = (SELECT id FROM tenants WHERE slug = 'default');
+  END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS ix_audit_log_tenant
+  ON audit_log (tenant_id, id DESC);
+
+-- row-level security policies (enabled separately, see rls/enable_row_level_security.sql).
+-- The API sets app.tenant_id per transaction; '*' is reserved for maintenance
+-- jobs that work across tenants. Unset means no rows.
+CREATE OR REPLACE FUNCTION app_tenant_visible(tenant BIGINT) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+  SELECT CASE current_setting('app.tenant_id', true)
+    WHEN '*' THEN TRUE
+    WHEN '' THEN FALSE
+    ELSE tenant = current_setting('app.tenant_id', true)::bigint
+  END
+$$;
+
+DROP POLICY IF EXISTS tenant_isolation ON branches;
+CREATE POLICY tenant_isolation ON branches
+  USING (app_tenant_visible(tenant_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON branch_operating_hours;
+CREATE POLICY tenant_isolation ON branch_operating_hours
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON timeslots;
+CREATE POLICY tenant_isolation ON timeslots
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON orders;
+CREATE POLICY tenant_isolation ON orders
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON order_events;
+CREATE POLICY tenant_isolation ON order_events
+  USING (EXISTS (SELECT 1 FROM orders o WHERE o.id = order_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON audit_log;
+CREATE POLICY tenant_isolation ON audit_log
+  USING (app_tenant_visible(tenant_id));
@@ -0,0 +1,68 @@
+-- webhook endpoints registered by a tenant's admins; the secret signs every
+-- delivery (HMAC-SHA256) and is therefore stored in clear
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id) ON DELETE RESTRICT,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  event_types TEXT[] NOT NULL DEFAULT '{}',  -- empty = every event
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_webhook_endpoints_tenant
+  ON webhook_endpoints (tenant_id) WHERE is_active;
+
+-- transactional outbox: domain events written in the same transaction as the
+-- change they describe
+CREATE TABLE IF NOT EXISTS outbox_events (
+  id BIGSERIAL PRIMARY KEY,
+  tenant_id BIGINT NOT NULL REFERENCES tenants(id) ON DELETE RESTRICT,
+  event_type TEXT NOT NULL,       -- e.g. order.created
+  aggregate_type TEXT NOT NULL,   -- e.g. order
+  aggregate_id TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  request_id TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS ix_outbox_events_aggregate
+  ON outbox_events (aggregate_type, aggregate_id, id);
+
+-- one row per event and subscribed endpoint, fanned out with the event
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES outbox_events(id) ON DELETE CASCADE,
+  endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'pending'
+    CHECK (status IN ('pending', 'delivered', 'dead')),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_status_code INT,
+  last_error TEXT,
+  delivered_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (event_id, endpoint_id)
+);
+
+-- the dispatcher's work queue
+CREATE INDEX IF NOT EXISTS ix_webhook_deliveries_due
+  ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS ix_webhook_deliveries_endpoint
+  ON webhook_deliveries (endpoint_id, id DESC);
+
+DROP POLICY IF EXISTS tenant_isolation ON webhook_endpoints;
+CREATE POLICY tenant_isolation ON webhook_endpoints
+  USING (app_tenant_visible(tenant_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON outbox_events;
+CREATE POLICY tenant_isolation ON outbox_events
+  USING (app_tenant_visible(tenant_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+CREATE POLICY tenant_isolation ON webhook_deliveries
+  USING (EXISTS (SELECT 1 FROM webhook_endpoints w WHERE w.id = endpoint_id));
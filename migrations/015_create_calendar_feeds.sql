@@ -0,0 +1,13 @@
+-- per-branch iCalendar subscription feeds; calendar apps cannot send
+-- credentials, so the feed URL carries a token (stored hashed, one per branch)
+CREATE TABLE IF NOT EXISTS branch_calendar_feeds (
+  branch_id BIGINT PRIMARY KEY REFERENCES branches(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL UNIQUE,   -- sha256 of the token
+  created_by TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ
+);
+
+DROP POLICY IF EXISTS tenant_isolation ON branch_calendar_feeds;
+CREATE POLICY tenant_isolation ON branch_calendar_feeds
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
@@ -0,0 +1,98 @@
+-- reporting aggregates. Reports read these instead of scanning orders and
+-- timeslots; refresh_analytics() rebuilds them on a schedule
+-- (ANALYTICS_REFRESH_MINUTES) and analytics_refresh says how fresh they are.
+
+-- seats of active slots per branch, service date and starting hour
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_slot_hours AS
+SELECT
+  t.branch_id,
+  t.service_date,
+  EXTRACT(HOUR FROM t.start_time)::int AS hour,
+  count(*)::int AS slots,
+  sum(t.capacity)::int AS capacity,
+  sum(t.reserved)::int AS reserved,
+  count(*) FILTER (WHERE t.reserved >= t.capacity)::int AS full_slots
+FROM timeslots t
+WHERE t.is_active
+GROUP BY t.branch_id, t.service_date, EXTRACT(HOUR FROM t.start_time);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analytics_slot_hours
+  ON analytics_slot_hours (branch_id, service_date, hour);
+
+-- bookings and cancellations per branch-local day they happened on; orders
+-- cancelled before 006 have no cancelled_at and count on their last update
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_order_days AS
+SELECT
+  e.branch_id,
+  e.day,
+  sum(e.booked)::int AS bookings,
+  sum(e.cancelled)::int AS cancellations
+FROM (
+  SELECT o.branch_id, (o.created_at AT TIME ZONE b.timezone)::date AS day, 1 AS booked, 0 AS cancelled
+  FROM orders o
+  JOIN branches b ON b.id = o.branch_id
+  UNION ALL
+  SELECT o.branch_id, (COALESCE(o.cancelled_at, o.updated_at) AT TIME ZONE b.timezone)::date, 0, 1
+  FROM orders o
+  JOIN branches b ON b.id = o.branch_id
+  WHERE o.status = 'cancelled'
+) e
+GROUP BY e.branch_id, e.day;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analytics_order_days
+  ON analytics_order_days (branch_id, day);
+
+-- orders per branch, service date and lead-time bucket (slot start minus
+-- booking time, for the slot the order is in now). Buckets:
+-- 0 under 1h (including walk-ins booked after the start), 1 1-3h, 2 3-24h,
+-- 3 1-3 days, 4 3-7 days, 5 7-14 days, 6 14-30 days, 7 30 days or more
+CREATE MATERIALIZED VIEW IF NOT EXISTS analytics_lead_times AS
+SELECT
+  o.branch_id,
+  t.service_date,
+  CASE
+    WHEN l.lead < interval '1 hour' THEN 0
+    WHEN l.lead < interval '3 hours' THEN 1
+    WHEN l.lead < interval '24 hours' THEN 2
+    WHEN l.lead < interval '3 days' THEN 3
+    WHEN l.lead < interval '7 days' THEN 4
+    WHEN l.lead < interval '14 days' THEN 5
+    WHEN l.lead < interval '30 days' THEN 6
+    ELSE 7
+  END AS bucket,
+  count(*)::int AS orders
+FROM orders o
+JOIN timeslots t ON t.id = o.timeslot_id
+JOIN branches b ON b.id = o.branch_id
+CROSS JOIN LATERAL (
+  SELECT ((t.service_date + t.start_time) AT TIME ZONE b.timezone) - o.created_at AS lead
+) l
+GROUP BY o.branch_id, t.service_date, 3;
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_analytics_lead_times
+  ON analytics_lead_times (branch_id, service_date, bucket);
+
+CREATE TABLE IF NOT EXISTS analytics_refresh (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),   -- single row
+  refreshed_at TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO analytics_refresh (refreshed_at)
+VALUES (now())
+ON CONFLICT (id) DO NOTHING;
+
+-- Rebuilds every view without blocking readers. Replicas calling it at the
+-- same time skip instead of queueing (returns FALSE). SECURITY DEFINER lets the
+-- API role refresh views it does not own, across all tenants.
+CREATE OR REPLACE FUNCTION refresh_analytics() RETURNS BOOLEAN
+LANGUAGE plpgsql SECURITY DEFINER SET search_path = public AS $$
+BEGIN
+  IF NOT pg_try_advisory_xact_lock(hashtext('refresh_analytics')) THEN
+    RETURN FALSE;
+  END IF;
+  REFRESH MATERIALIZED VIEW CONCURRENTLY analytics_slot_hours;
+  REFRESH MATERIALIZED VIEW CONCURRENTLY analytics_order_days;
+  REFRESH MATERIALIZED VIEW CONCURRENTLY analytics_lead_times;
+  UPDATE analytics_refresh SET refreshed_at = now();
+  RETURN TRUE;
+END $$;
@@ -0,0 +1,42 @@
+-- attendance outcomes and per-customer reliability.
+-- no_show: the customer never came; staff mark it once the slot has started
+-- and the seat stays taken. unconfirmed: booked by a customer the branch asks
+-- to confirm; released if not confirmed in time.
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'no_show';
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'unconfirmed';
+
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS no_show_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMPTZ;
+
+-- not_confirmed is set by the system when it releases an unconfirmed order
+ALTER TABLE orders
+  DROP CONSTRAINT IF EXISTS orders_cancel_reason_check;
+ALTER TABLE orders
+  ADD CONSTRAINT orders_cancel_reason_check
+  CHECK (cancel_reason IN (
+    'customer_request', 'schedule_conflict', 'illness',
+    'branch_closed', 'staff_unavailable', 'duplicate_booking', 'other',
+    'not_confirmed'
+  ));
+
+ALTER TABLE order_events
+  DROP CONSTRAINT IF EXISTS order_events_event_type_check;
+ALTER TABLE order_events
+  ADD CONSTRAINT order_events_event_type_check
+  CHECK (event_type IN ('created', 'cancelled', 'rescheduled', 'checked_in', 'no_show', 'confirmed'));
+
+-- reliability policy: a customer's incidents are their no-shows plus their
+-- cancellations closer than late_cancel_minutes to the start, for slots of
+-- the last reliability_window_days. From confirm_threshold incidents on their
+-- bookings need confirmation, from block_threshold on they are refused
+-- (NULL = never).
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS reliability_window_days INT NOT NULL DEFAULT 90
+    CHECK (reliability_window_days > 0),
+  ADD COLUMN IF NOT EXISTS late_cancel_minutes INT NOT NULL DEFAULT 1440
+    CHECK (late_cancel_minutes >= 0),
+  ADD COLUMN IF NOT EXISTS confirm_threshold INT CHECK (confirm_threshold > 0),
+  ADD COLUMN IF NOT EXISTS block_threshold INT CHECK (block_threshold > 0),
+  ADD COLUMN IF NOT EXISTS confirm_deadline_minutes INT NOT NULL DEFAULT 120
+    CHECK (confirm_deadline_minutes >= 0);
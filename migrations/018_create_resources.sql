@@ -0,0 +1,58 @@
+-- staff members, rooms and equipment that serve timeslots
+CREATE TABLE IF NOT EXISTS resources (
+  id BIGSERIAL PRIMARY KEY,
+
+  branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE RESTRICT,
+  kind TEXT NOT NULL CHECK (kind IN ('staff', 'room', 'equipment')),
+  name TEXT NOT NULL,
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_resources_branch_name
+  ON resources (branch_id, lower(name));
+
+-- weekly availability in branch-local time, several intervals per weekday.
+-- A resource without rows is available whenever it is assigned.
+CREATE TABLE IF NOT EXISTS resource_availability (
+  resource_id BIGINT NOT NULL REFERENCES resources(id) ON DELETE CASCADE,
+  weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+  start_time TIME NOT NULL,
+  end_time TIME NOT NULL,
+
+  PRIMARY KEY (resource_id, weekday, start_time),
+  CHECK (end_time > start_time)
+);
+
+-- resources that can serve a timeslot; a slot with assigned resources has one
+-- seat per resource and every booking holds one of them
+CREATE TABLE IF NOT EXISTS timeslot_resources (
+  timeslot_id BIGINT NOT NULL REFERENCES timeslots(id) ON DELETE CASCADE,
+  resource_id BIGINT NOT NULL REFERENCES resources(id) ON DELETE RESTRICT,
+
+  PRIMARY KEY (timeslot_id, resource_id)
+);
+
+CREATE INDEX IF NOT EXISTS ix_timeslot_resources_resource
+  ON timeslot_resources (resource_id);
+
+-- the resource held by a booking; kept on cancelled orders for history
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS resource_id BIGINT REFERENCES resources(id) ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS ix_orders_resource
+  ON orders (resource_id) WHERE resource_id IS NOT NULL;
+
+DROP POLICY IF EXISTS tenant_isolation ON resources;
+CREATE POLICY tenant_isolation ON resources
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON resource_availability;
+CREATE POLICY tenant_isolation ON resource_availability
+  USING (EXISTS (SELECT 1 FROM resources r WHERE r.id = resource_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON timeslot_resources;
+CREATE POLICY tenant_isolation ON timeslot_resources
+  USING (EXISTS (SELECT 1 FROM timeslots t WHERE t.id = timeslot_id));
@@ -0,0 +1,55 @@
+-- per-branch service catalog; a booking of a service longer than one slot
+-- takes a seat in each of the consecutive slots it needs
+CREATE TABLE IF NOT EXISTS services (
+  id BIGSERIAL PRIMARY KEY,
+
+  branch_id BIGINT NOT NULL REFERENCES branches(id) ON DELETE RESTRICT,
+  name TEXT NOT NULL,
+  duration_minutes INT NOT NULL CHECK (duration_minutes BETWEEN 5 AND 1440),
+  price NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (price >= 0),
+  is_active BOOLEAN NOT NULL DEFAULT TRUE,
+
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS ux_services_branch_name
+  ON services (branch_id, lower(name));
+
+-- resources able to perform a service; a booking holds one of them.
+-- A service without rows needs no particular resource.
+CREATE TABLE IF NOT EXISTS service_resources (
+  service_id BIGINT NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+  resource_id BIGINT NOT NULL REFERENCES resources(id) ON DELETE RESTRICT,
+
+  PRIMARY KEY (service_id, resource_id)
+);
+
+-- duration_minutes is copied from the service at booking time, so later
+-- catalog edits do not move existing bookings
+ALTER TABLE orders
+  ADD COLUMN IF NOT EXISTS service_id BIGINT REFERENCES services(id) ON DELETE RESTRICT,
+  ADD COLUMN IF NOT EXISTS duration_minutes INT CHECK (duration_minutes > 0);
+
+-- the slots after orders.timeslot_id that a service booking also occupies
+CREATE TABLE IF NOT EXISTS order_timeslots (
+  order_id BIGINT NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  timeslot_id BIGINT NOT NULL REFERENCES timeslots(id) ON DELETE RESTRICT,
+
+  PRIMARY KEY (order_id, timeslot_id)
+);
+
+CREATE INDEX IF NOT EXISTS ix_order_timeslots_timeslot
+  ON order_timeslots (timeslot_id);
+
+DROP POLICY IF EXISTS tenant_isolation ON services;
+CREATE POLICY tenant_isolation ON services
+  USING (EXISTS (SELECT 1 FROM branches b WHERE b.id = branch_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON service_resources;
+CREATE POLICY tenant_isolation ON service_resources
+  USING (EXISTS (SELECT 1 FROM services s WHERE s.id = service_id));
+
+DROP POLICY IF EXISTS tenant_isolation ON order_timeslots;
+CREATE POLICY tenant_isolation ON order_timeslots
+  USING (EXISTS (SELECT 1 FROM orders o WHERE o.id = order_id));
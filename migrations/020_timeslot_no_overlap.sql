@@ -0,0 +1,34 @@
+-- optional per-branch "no overlap" mode: no two slots of the branch may share
+-- any moment (back-to-back slots are fine)
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE branches
+  ADD COLUMN IF NOT EXISTS no_overlap BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- an exclusion constraint only sees the row itself, so each slot carries the
+-- mode: set from the branch on insert, and by the API when the mode changes.
+-- Slots dated before the branch's today are history and stay unchecked; the
+-- API locks the branch row around slot inserts and mode changes
+ALTER TABLE timeslots
+  ADD COLUMN IF NOT EXISTS no_overlap BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE OR REPLACE FUNCTION timeslots_no_overlap() RETURNS trigger AS $$
+BEGIN
+  SELECT b.no_overlap AND NEW.service_date >= (now() AT TIME ZONE b.timezone)::date
+  INTO NEW.no_overlap
+  FROM branches b WHERE b.id = NEW.branch_id;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_timeslots_no_overlap ON timeslots;
+CREATE TRIGGER trg_timeslots_no_overlap
+  BEFORE INSERT ON timeslots
+  FOR EACH ROW EXECUTE FUNCTION timeslots_no_overlap();
+
+ALTER TABLE timeslots DROP CONSTRAINT IF EXISTS ex_timeslots_no_overlap;
+ALTER TABLE timeslots ADD CONSTRAINT ex_timeslots_no_overlap
+  EXCLUDE USING gist (
+    branch_id WITH =,
+    tsrange(service_date + start_time, service_date + end_time) WITH &&
+  ) WHERE (no_overlap);
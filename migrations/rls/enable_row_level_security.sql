@@ -0,0 +1,29 @@
+-- Opt-in second line of defense for multi-tenancy: Postgres row-level security
+-- on top of the tenant filters in every repository query.
+--
+-- Policies are created by 013_create_tenants.sql. RLS never applies to
+-- superusers or table owners, so run the API as a separate role, e.g.:
+--
+--   CREATE ROLE go_backend_api_app LOGIN PASSWORD '...';
+--   GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO go_backend_api_app;
+--   GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO go_backend_api_app;
+--
+-- and start it with TENANT_RLS=true so reads also run in a transaction that
+-- carries app.tenant_id. api_keys and tenants are not covered: they are read
+-- before the tenant of a request is known.
+ALTER TABLE branches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE branch_operating_hours ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timeslots ENABLE ROW LEVEL SECURITY;
+ALTER TABLE orders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_endpoints ENABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE branch_calendar_feeds ENABLE ROW LEVEL SECURITY;
+ALTER TABLE resources ENABLE ROW LEVEL SECURITY;
+ALTER TABLE resource_availability ENABLE ROW LEVEL SECURITY;
+ALTER TABLE timeslot_resources ENABLE ROW LEVEL SECURITY;
+ALTER TABLE services ENABLE ROW LEVEL SECURITY;
+ALTER TABLE service_resources ENABLE ROW LEVEL SECURITY;
+ALTER TABLE order_timeslots ENABLE ROW LEVEL SECURITY;
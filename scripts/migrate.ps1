@@ -10,6 +10,23 @@ docker exec -i $Container psql -U $DbUser -d $DbName `
   -f /migrations/001_create_branches.sql `
   -f /migrations/002_create_timeslots.sql `
   -f /migrations/003_create_orders.sql `
+  -f /migrations/004_extend_branches.sql `
+  -f /migrations/005_branch_booking_policy.sql `
+  -f /migrations/006_order_cancellation.sql `
+  -f /migrations/007_create_order_events.sql `
+  -f /migrations/008_create_audit_log.sql `
+  -f /migrations/009_order_customer.sql `
+  -f /migrations/010_order_check_in.sql `
+  -f /migrations/011_create_api_keys.sql `
+  -f /migrations/012_create_rate_limit_buckets.sql `
+  -f /migrations/013_create_tenants.sql `
+  -f /migrations/014_create_webhooks.sql `
+  -f /migrations/015_create_calendar_feeds.sql `
+  -f /migrations/016_create_analytics.sql `
+  -f /migrations/017_order_attendance.sql `
+  -f /migrations/018_create_resources.sql `
+  -f /migrations/019_create_services.sql `
+  -f /migrations/020_timeslot_no_overlap.sql `
   -f /seed/seed.sql
 
 Write-Host "✅ Migration completed"
@@ -1,15 +1,29 @@
-INSERT INTO branches (name)
-VALUES ('Chiang Mai - Branch 1')
-ON CONFLICT (name) DO NOTHING;
+-- demo data belongs to the default tenant (created by 013_create_tenants.sql)
+INSERT INTO branches (tenant_id, name, timezone, address, phone)
+SELECT id, 'Chiang Mai - Branch 1', 'Asia/Bangkok', 'Nimmanhaemin Rd, Chiang Mai 50200', '+66 53 000 000'
+FROM tenants WHERE slug = 'default'
+ON CONFLICT (tenant_id, name) DO NOTHING;
 
--- Create a few demo timeslots for today and tomorrow
+-- Open every day 09:00-18:00 (weekday 0 = Sunday)
+INSERT INTO branch_operating_hours (branch_id, weekday, open_time, close_time)
+SELECT b.id, d.weekday, TIME '09:00', TIME '18:00'
+FROM branches b
+CROSS JOIN generate_series(0, 6) AS d(weekday)
+JOIN tenants tn ON tn.id = b.tenant_id AND tn.slug = 'default'
+WHERE b.name = 'Chiang Mai - Branch 1'
+ON CONFLICT (branch_id, weekday) DO NOTHING;
+
+-- Create a few demo timeslots for today and tomorrow (branch-local dates, not the DB server's CURRENT_DATE)
 WITH b AS (
-  SELECT id AS branch_id FROM branches WHERE name = 'Chiang Mai - Branch 1'
+  SELECT id AS branch_id, (now() AT TIME ZONE timezone)::date AS today
+  FROM branches
+  WHERE name = 'Chiang Mai - Branch 1'
+    AND tenant_id = (SELECT id FROM tenants WHERE slug = 'default')
 )
 INSERT INTO timeslots (branch_id, service_date, start_time, end_time, capacity, reserved, is_active)
-SELECT b.branch_id, CURRENT_DATE, TIME '10:00', TIME '11:00', 3, 0, TRUE FROM b
+SELECT b.branch_id, b.today, TIME '10:00', TIME '11:00', 3, 0, TRUE FROM b
 UNION ALL
-SELECT b.branch_id, CURRENT_DATE, TIME '11:00', TIME '12:00', 3, 0, TRUE FROM b
+SELECT b.branch_id, b.today, TIME '11:00', TIME '12:00', 3, 0, TRUE FROM b
 UNION ALL
-SELECT b.branch_id, CURRENT_DATE + 1, TIME '10:00', TIME '11:00', 2, 0, TRUE FROM b
+SELECT b.branch_id, b.today + 1, TIME '10:00', TIME '11:00', 2, 0, TRUE FROM b
 ON CONFLICT (branch_id, service_date, start_time, end_time) DO NOTHING;